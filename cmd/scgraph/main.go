@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	apiV1 "txchain/pkg/api/v1"
+	"txchain/pkg/cc"
+)
+
+func main() {
+	if err := run(os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(w io.Writer) error {
+	registry, err := apiV1.NewCalendarChainRegistry()
+	if err != nil {
+		return err
+	}
+	analysis := registry.Analyze()
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHAIN\tHOPS\tORDERING")
+	for _, chain := range registry.Chains() {
+		var hops []string
+		for _, hop := range chain.Hops {
+			hops = append(hops, fmt.Sprintf("%s@%s", hop.Name, hop.Service))
+		}
+		ordering := "required"
+		if analysis.Safe(chain.Name) {
+			ordering = "none"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", chain.Name, strings.Join(hops, " -> "), ordering)
+	}
+	if err = tw.Flush(); err != nil {
+		return err
+	}
+
+	nodes := analysis.Graph.Nodes
+	for i, cycle := range analysis.Cycles {
+		fmt.Fprintf(w, "\nSC-cycle %d: %s\n", i+1, strings.Join(cycle.Chains, ", "))
+		tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		for _, edge := range cycle.Edges {
+			from, to := nodes[edge.From], nodes[edge.To]
+			if edge.Type == cc.SCEdgeConflict {
+				fmt.Fprintf(
+					tw, "  %s\t%s\t%s\t%s %s / %s %s\n",
+					edge.Type, from, to,
+					edge.FromAccess.Op, edge.FromAccess.Table,
+					edge.ToAccess.Op, edge.ToAccess.Table,
+				)
+			} else {
+				fmt.Fprintf(tw, "  %s\t%s\t%s\t\n", edge.Type, from, to)
+			}
+		}
+		if err = tw.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
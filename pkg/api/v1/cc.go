@@ -1,11 +1,15 @@
 package v1
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 	"txchain/pkg/cc"
 	"txchain/pkg/format"
 	"txchain/pkg/middleware"
 	"txchain/pkg/router"
+
+	"github.com/jackc/pgx/v5"
 )
 
 type RequestTestTxUpdateFilter struct {
@@ -57,11 +61,7 @@ func HandleTestTxUpdateFilter(cfg *router.Config) http.Handler {
 	})
 }
 
-type RequestTxAdvanceTimestamp struct {
-	Partition uint64 `json:"partition"`
-	Service   string `json:"service"`
-	Timestamp uint64 `json:"timestamp"`
-}
+type RequestTxAdvanceTimestamp = cc.TxAdvanceTimestamp
 
 type ResponseTxAdvanceTimestamp struct {
 }
@@ -69,15 +69,125 @@ type ResponseTxAdvanceTimestamp struct {
 func HandleTxAdvanceTimestamp(cfg *router.Config) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		req := middleware.UnmarshalRequest[RequestTxAdvanceTimestamp](r)
-		originMgr := cfg.TxMgr.OriginMgr
 
-		partition, service, timestamp := req.Partition, req.Service, req.Timestamp
-		ok := originMgr.Acquire(cc.NewWaitMsg(partition, service, timestamp))
-		if ok {
-			originMgr.Release(partition, service)
+		err := cfg.TxMgr.AdvanceReceiver(r.Context(), req.Partition, req.Service, req.Timestamp, req.Level)
+		if errors.Is(err, cc.ErrTxOriginCanceled) || errors.Is(err, cc.ErrTxOriginDuplicate) {
+			format.WriteJsonResponse(w, format.NewErrorResponse(ErrTxAdvanceTimestamp, err), http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil {
+			format.WriteJsonResponse(w, format.NewErrorResponse(ErrTxAdvanceTimestamp, err), http.StatusInternalServerError)
+			return
 		}
 
 		resp := ResponseTxAdvanceTimestamp{}
 		format.WriteJsonResponse(w, resp, http.StatusNoContent)
 	})
 }
+
+type RequestTxTimestampStatus = cc.TxTimestampQuery
+
+type ResponseTxTimestampStatus = cc.TxTimestampStatus
+
+// HandleTxTimestampStatus lets a receiver stuck behind a missing timestamp ask
+// the sender about the executor that owns it.
+func HandleTxTimestampStatus(cfg *router.Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := middleware.UnmarshalRequest[RequestTxTimestampStatus](r)
+
+		resp, err := cfg.TxMgr.TimestampStatus(req)
+		if err != nil {
+			format.WriteJsonResponse(w, format.NewErrorResponse(ErrTxTimestampStatus, err), http.StatusInternalServerError)
+			return
+		}
+		format.WriteJsonResponse(w, resp, http.StatusOK)
+	})
+}
+
+type RequestTxSenderWatermarks = cc.TxWatermarkQuery
+
+type ResponseTxSenderWatermarks = []cc.TxSenderWatermark
+
+// HandleTxSenderWatermarks tells a receiver which of its dedup results this
+// sender will never need again.
+func HandleTxSenderWatermarks(cfg *router.Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := middleware.UnmarshalRequest[RequestTxSenderWatermarks](r)
+
+		resp, err := cfg.TxMgr.SenderWatermarks(r.Context(), req)
+		if errors.Is(err, cc.ErrTxWatermarkPrt) {
+			format.WriteJsonResponse(w, format.NewErrorResponse(ErrTxSenderWatermarks, err), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			format.WriteJsonResponse(w, format.NewErrorResponse(ErrTxSenderWatermarks, err), http.StatusInternalServerError)
+			return
+		}
+		format.WriteJsonResponse(w, resp, http.StatusOK)
+	})
+}
+
+type RequestTxResendExecutor = cc.TxResendExecutor
+
+type ResponseTxResendExecutor struct {
+}
+
+func HandleTxResendExecutor(cfg *router.Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := middleware.UnmarshalRequest[RequestTxResendExecutor](r)
+
+		err := cfg.TxMgr.Resend(req.ExecID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			format.WriteJsonResponse(w, format.NewErrorResponse(ErrTxResendExecutor, err), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			format.WriteJsonResponse(w, format.NewErrorResponse(ErrTxResendExecutor, err), http.StatusInternalServerError)
+			return
+		}
+
+		resp := ResponseTxResendExecutor{}
+		format.WriteJsonResponse(w, resp, http.StatusNoContent)
+	})
+}
+
+type ResponseTxExecutorStatus = cc.TxExecutorStatus
+
+// HandleGetTxExecutor reports whether the downstream hops of a chain this
+// service coordinates finished.
+func HandleGetTxExecutor(cfg *router.Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		execID, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+		if err != nil {
+			format.WriteJsonResponse(w, format.NewErrorResponse(ErrInvalidRequestParam, err), http.StatusBadRequest)
+			return
+		}
+
+		resp, err := cfg.TxMgr.ExecutorStatus(execID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			format.WriteJsonResponse(w, format.NewErrorResponse(ErrTxExecutorStatus, err), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			format.WriteJsonResponse(w, format.NewErrorResponse(ErrTxExecutorStatus, err), http.StatusInternalServerError)
+			return
+		}
+		format.WriteJsonResponse(w, resp, http.StatusOK)
+	})
+}
+
+type RequestTxMetrics struct {
+}
+
+type ResponseTxMetrics struct {
+	Executor cc.TxExecutorMetrics `json:"executor"`
+}
+
+func HandleTxMetrics(cfg *router.Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := ResponseTxMetrics{
+			Executor: cfg.TxMgr.ExecMgr.Metrics(),
+		}
+		format.WriteJsonResponse(w, resp, http.StatusOK)
+	})
+}
@@ -0,0 +1,77 @@
+package v1
+
+import (
+	"txchain/pkg/cc"
+	"txchain/pkg/router"
+)
+
+const (
+	TableUsers     = "Users"
+	TableEvents    = "Events"
+	TableEventLogs = "EventLogs"
+)
+
+const (
+	ChainTxCreateEvent = "tx_create_event"
+	ChainTxUpdateEvent = "tx_update_event"
+	ChainTxDeleteEvent = "tx_delete_event"
+	ChainTxJoinEvent   = "tx_join_event"
+	ChainTxLeaveEvent  = "tx_leave_event"
+)
+
+// CalendarChains declares the hops of every calendar tx handler in the order
+// they are issued.
+func CalendarChains() []*cc.TxChain {
+	return []*cc.TxChain{
+		cc.NewTxChain(ChainTxCreateEvent).
+			Hop(cc.NewTxHop("create_event", router.ServiceEvent).Write(TableEvents)).
+			Hop(cc.NewTxHop("create_event_log", router.ServiceEventLog).Append(TableEventLogs)).
+			Hop(cc.NewTxHop("add_user_host_event", router.ServiceUser).Write(TableUsers)),
+		cc.NewTxChain(ChainTxUpdateEvent).
+			Hop(cc.NewTxHop("update_event", router.ServiceEvent).Write(TableEvents)).
+			Hop(cc.NewTxHop("create_event_log", router.ServiceEventLog).Append(TableEventLogs)),
+		cc.NewTxChain(ChainTxDeleteEvent).
+			Hop(cc.NewTxHop("remove_user_host_event", router.ServiceUser).Write(TableUsers)).
+			Hop(cc.NewTxHop("get_event", router.ServiceEvent).Read(TableEvents)).
+			Hop(cc.NewTxHop("delete_event", router.ServiceEvent).Write(TableEvents)).
+			Hop(cc.NewTxHop("create_event_log", router.ServiceEventLog).Append(TableEventLogs)),
+		cc.NewTxChain(ChainTxJoinEvent).
+			Hop(cc.NewTxHop("add_event_participant", router.ServiceEvent).Write(TableEvents)).
+			Hop(cc.NewTxHop("create_event_log", router.ServiceEventLog).Append(TableEventLogs)),
+		cc.NewTxChain(ChainTxLeaveEvent).
+			Hop(cc.NewTxHop("remove_event_participant", router.ServiceEvent).Write(TableEvents)).
+			Hop(cc.NewTxHop("create_event_log", router.ServiceEventLog).Append(TableEventLogs)),
+	}
+}
+
+func NewCalendarChainRegistry() (*cc.TxChainRegistry, error) {
+	registry := cc.NewTxChainRegistry()
+	if err := registry.Declare(CalendarChains()...); err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
+
+// CalendarChainLevel is the weakest serialization level of a calendar chain.
+func CalendarChainLevel(name string) cc.SerializationLevel {
+	registry, err := NewCalendarChainRegistry()
+	if err != nil {
+		return cc.SerializationLevelOriginOrdering
+	}
+	return registry.Analyze().Level(name)
+}
+
+// CalendarChainReceivers returns the receiver of every hop of a calendar chain,
+// which is also the order the coordinator reserves timestamps in.
+func CalendarChainReceivers(name string) []string {
+	var receivers []string
+	for _, chain := range CalendarChains() {
+		if chain.Name != name {
+			continue
+		}
+		for _, hop := range chain.Hops {
+			receivers = append(receivers, hop.Service)
+		}
+	}
+	return receivers
+}
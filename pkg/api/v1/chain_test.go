@@ -0,0 +1,35 @@
+package v1
+
+import (
+	"testing"
+	"txchain/pkg/cc"
+	"txchain/pkg/router"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalendarChainReceivers(t *testing.T) {
+	require.Equal(t,
+		[]string{router.ServiceEvent, router.ServiceEventLog, router.ServiceUser},
+		CalendarChainReceivers(ChainTxCreateEvent),
+	)
+	require.Equal(t,
+		[]string{router.ServiceUser, router.ServiceEvent, router.ServiceEvent, router.ServiceEventLog},
+		CalendarChainReceivers(ChainTxDeleteEvent),
+	)
+	require.Empty(t, CalendarChainReceivers("unknown"))
+}
+
+func TestCalendarChainLevel(t *testing.T) {
+	registry, err := NewCalendarChainRegistry()
+	require.NoError(t, err)
+	analysis := registry.Analyze()
+	for _, chain := range registry.Chains() {
+		expected := cc.SerializationLevelNone
+		if !analysis.Safe(chain.Name) {
+			expected = cc.SerializationLevelOriginOrdering
+		}
+		require.Equal(t, expected, CalendarChainLevel(chain.Name), chain.Name)
+	}
+	require.Equal(t, cc.SerializationLevelOriginOrdering, CalendarChainLevel("unknown"))
+}
@@ -36,6 +36,12 @@ var (
 	ErrTxJoinEvent   = errors.New("tx: failed to join event")
 	ErrTxLeaveEvent  = errors.New("tx: failed to leave event")
 
+	ErrTxAdvanceTimestamp = errors.New("tx: failed to advance timestamp")
+	ErrTxTimestampStatus  = errors.New("tx: failed to get timestamp status")
+	ErrTxResendExecutor   = errors.New("tx: failed to resend executor")
+	ErrTxSenderWatermarks = errors.New("tx: failed to get sender watermarks")
+	ErrTxExecutorStatus   = errors.New("tx: failed to get executor status")
+
 	ErrTestTxFilterType = errors.New("test tx: invalid tx filter type")
 	ErrTestTxFilterOp   = errors.New("test tx: invalid tx filter operation")
 
@@ -1,9 +1,12 @@
 package v1
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"slices"
 	"testing"
 	"time"
+	"txchain/pkg/cc"
 	"txchain/pkg/database"
 
 	"github.com/stretchr/testify/require"
@@ -132,3 +135,60 @@ func TestEventAPI(t *testing.T) {
 	_, err = GetRequestGetEvent(client, server.URL, reqGetEvent)
 	require.Error(t, err)
 }
+
+func TestEventAPIReplayedHop(t *testing.T) {
+	pgc, err := database.NewContainerTableEvents(t, "17.1")
+	defer func() {
+		if pgc != nil {
+			tctr.CleanupContainer(t, pgc.Container)
+		}
+	}()
+	require.NoError(t, err)
+
+	r, err := DefaultEventRouter(
+		pgc.Endpoint(),
+		DefaultUserServerAddr,
+		DefaultEventServerAddr,
+		DefaultEventLogServerAddr,
+	)
+	require.NoError(t, err)
+
+	client := DefaultHTTPClient()
+	server := httptest.NewServer(r.Handler())
+	defer server.Close()
+
+	execCtx := &cc.TxExecutorContext{
+		CtrlCtx: &cc.TxControlContext{
+			Partition: 1,
+			Service:   "service-replay",
+		},
+		Timestamps: []uint64{1, 2},
+	}
+	req := RequestCreateEvent{
+		Event: &APIEvent{
+			EventName:    "Replayed Event",
+			HostID:       1,
+			StartAt:      time.Date(2000, 12, 25, 18, 0, 0, 0, time.Local),
+			EndAt:        time.Date(2000, 12, 25, 22, 0, 0, 0, time.Local),
+			Participants: []int64{},
+		},
+	}
+	hop := func(i int) (ResponseCreateEvent, error) {
+		stage := cc.NewHTTPStage[RequestCreateEvent, ResponseCreateEvent](
+			client, http.MethodPost, server.URL, PathCreateEvent, i, execCtx,
+		)
+		return stage.Do(req)
+	}
+
+	created, err := hop(0)
+	require.NoError(t, err)
+
+	// the re-delivered hop returns the recorded result without a new event
+	replayed, err := hop(0)
+	require.NoError(t, err)
+	require.Equal(t, created, replayed)
+
+	next, err := hop(1)
+	require.NoError(t, err)
+	require.Equal(t, created.EventID+1, next.EventID)
+}
@@ -1,5 +1,7 @@
 package v1
 
+import "txchain/pkg/cc"
+
 const (
 	PathGetUser             = "/api/v1/user"
 	PathGetUserID           = "/api/v1/user/id"
@@ -26,4 +28,10 @@ const (
 	PathTxDeleteEvent = "/api/v1/tx/event"
 	PathTxJoinEvent   = "/api/v1/tx/event/join"
 	PathTxLeaveEvent  = "/api/v1/tx/event/leave"
+
+	PathTxAdvanceTimestamp = cc.PathTxAdvanceTimestamp
+	PathTxTimestampStatus  = cc.PathTxTimestampStatus
+	PathTxResendExecutor   = cc.PathTxResendExecutor
+	PathTxMetrics          = "/api/v1/tx/cc/metrics"
+	PathTxExecutors        = cc.PathTxExecutors
 )
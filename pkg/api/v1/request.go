@@ -178,3 +178,7 @@ func PutRequestTxJoinEvent(client *http.Client, addr string, params *RequestTxJo
 func PutRequestTxLeaveEvent(client *http.Client, addr string, params *RequestTxLeaveEvent) (*ResponseTxLeaveEvent, error) {
 	return PutRequest[RequestTxLeaveEvent, ResponseTxLeaveEvent](client, addr, PathTxLeaveEvent, http.StatusNoContent, params)
 }
+
+func GetRequestTxMetrics(client *http.Client, addr string, params *RequestTxMetrics) (*ResponseTxMetrics, error) {
+	return GetRequest[RequestTxMetrics, ResponseTxMetrics](client, addr, PathTxMetrics, http.StatusOK, params)
+}
@@ -27,7 +27,9 @@ func DefaultHTTPClient() *http.Client {
 }
 
 func DefaultEnv() map[string]string {
-	return map[string]string{}
+	return map[string]string{
+		router.ConfigTxPeerToken: "test-peer-token",
+	}
 }
 
 func DefaultConfig(env map[string]string) (*router.Config, error) {
@@ -58,6 +60,8 @@ func DefaultUserRouter(
 	if err != nil {
 		return nil, err
 	}
+	// executes the hops after the first one
+	cfg.TxMgr.Start()
 	r := router.New(cfg)
 	routes := NewUserRoutes(cfg)
 	for _, route := range routes {
@@ -84,6 +88,8 @@ func DefaultEventRouter(
 	if err != nil {
 		return nil, err
 	}
+	// executes the hops after the first one
+	cfg.TxMgr.Start()
 	r := router.New(cfg)
 	routes := NewEventRoutes(cfg)
 	for _, route := range routes {
@@ -110,6 +116,8 @@ func DefaultEventLogRouter(
 	if err != nil {
 		return nil, err
 	}
+	// executes the hops after the first one
+	cfg.TxMgr.Start()
 	r := router.New(cfg)
 	routes := NewEventLogRoutes(cfg)
 	for _, route := range routes {
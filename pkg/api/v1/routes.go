@@ -37,10 +37,32 @@ func NewUserRoutes(cfg *router.Config) []router.Route {
 		{
 			event := tx.Prefix("/event")
 			{
-				event.Post("/", HandleTxCreateEvent(cfg)).Apply(middleware.ValidateBody[RequestTxCreateEvent])
-				event.Put("/", HandleTxUpdateEvent(cfg)).Apply(middleware.ValidateBody[RequestTxUpdateEvent])
-				event.Delete("/", HandleTxDeleteEvent(cfg)).Apply(middleware.ValidateBody[RequestTxDeleteEvent])
+				event.Post("/", HandleTxCreateEvent(cfg)).Apply(
+					middleware.ValidateBody[RequestTxCreateEvent],
+					TxCalendarCoordinator[RequestTxCreateEvent](cfg, router.ServiceUser, ChainTxCreateEvent),
+				)
+				event.Put("/", HandleTxUpdateEvent(cfg)).Apply(
+					middleware.ValidateBody[RequestTxUpdateEvent],
+					TxCalendarCoordinator[RequestTxUpdateEvent](cfg, router.ServiceUser, ChainTxUpdateEvent),
+				)
+				event.Delete("/", HandleTxDeleteEvent(cfg)).Apply(
+					middleware.ValidateBody[RequestTxDeleteEvent],
+					TxCalendarCoordinator[RequestTxDeleteEvent](cfg, router.ServiceUser, ChainTxDeleteEvent),
+				)
 			}
+
+			// control endpoints of the concurrency control, only for peers
+			txCC := tx.Prefix("/cc")
+			txCC.Apply(middleware.TxPeer(cfg.PeerToken))
+			{
+				txCC.Post("/advance", HandleTxAdvanceTimestamp(cfg)).Apply(middleware.ValidateBody[RequestTxAdvanceTimestamp])
+				txCC.Post("/status", HandleTxTimestampStatus(cfg)).Apply(middleware.ValidateBody[RequestTxTimestampStatus])
+				txCC.Post("/resend", HandleTxResendExecutor(cfg)).Apply(middleware.ValidateBody[RequestTxResendExecutor])
+				txCC.Post("/watermarks", HandleTxSenderWatermarks(cfg)).Apply(middleware.ValidateBody[RequestTxSenderWatermarks])
+				txCC.Get("/metrics", HandleTxMetrics(cfg))
+			}
+
+			tx.Get("/executors/{id}", HandleGetTxExecutor(cfg)).Apply(middleware.TxPeer(cfg.PeerToken))
 		}
 	}
 
@@ -71,9 +93,28 @@ func NewEventRoutes(cfg *router.Config) []router.Route {
 		{
 			event := tx.Prefix("/event")
 			{
-				event.Put("/join", HandleTxJoinEvent(cfg)).Apply(middleware.ValidateBody[RequestTxJoinEvent])
-				event.Put("/leave", HandleTxLeaveEvent(cfg)).Apply(middleware.ValidateBody[RequestTxLeaveEvent])
+				event.Put("/join", HandleTxJoinEvent(cfg)).Apply(
+					middleware.ValidateBody[RequestTxJoinEvent],
+					TxCalendarCoordinator[RequestTxJoinEvent](cfg, router.ServiceEvent, ChainTxJoinEvent),
+				)
+				event.Put("/leave", HandleTxLeaveEvent(cfg)).Apply(
+					middleware.ValidateBody[RequestTxLeaveEvent],
+					TxCalendarCoordinator[RequestTxLeaveEvent](cfg, router.ServiceEvent, ChainTxLeaveEvent),
+				)
 			}
+
+			// control endpoints of the concurrency control, only for peers
+			txCC := tx.Prefix("/cc")
+			txCC.Apply(middleware.TxPeer(cfg.PeerToken))
+			{
+				txCC.Post("/advance", HandleTxAdvanceTimestamp(cfg)).Apply(middleware.ValidateBody[RequestTxAdvanceTimestamp])
+				txCC.Post("/status", HandleTxTimestampStatus(cfg)).Apply(middleware.ValidateBody[RequestTxTimestampStatus])
+				txCC.Post("/resend", HandleTxResendExecutor(cfg)).Apply(middleware.ValidateBody[RequestTxResendExecutor])
+				txCC.Post("/watermarks", HandleTxSenderWatermarks(cfg)).Apply(middleware.ValidateBody[RequestTxSenderWatermarks])
+				txCC.Get("/metrics", HandleTxMetrics(cfg))
+			}
+
+			tx.Get("/executors/{id}", HandleGetTxExecutor(cfg)).Apply(middleware.TxPeer(cfg.PeerToken))
 		}
 	}
 
@@ -88,6 +129,22 @@ func NewEventLogRoutes(cfg *router.Config) []router.Route {
 	{
 		apiV1.Get("/event_logs", HandleGetEventLogs(cfg)).Apply(middleware.ValidateQuery[RequestGetEventLogs])
 		apiV1.Post("/event_log", HandleCreateEventLog(cfg)).Apply(middleware.ValidateBody[RequestCreateEventLog])
+
+		tx := apiV1.Prefix("/tx")
+		{
+			// control endpoints of the concurrency control, only for peers
+			txCC := tx.Prefix("/cc")
+			txCC.Apply(middleware.TxPeer(cfg.PeerToken))
+			{
+				txCC.Post("/advance", HandleTxAdvanceTimestamp(cfg)).Apply(middleware.ValidateBody[RequestTxAdvanceTimestamp])
+				txCC.Post("/status", HandleTxTimestampStatus(cfg)).Apply(middleware.ValidateBody[RequestTxTimestampStatus])
+				txCC.Post("/resend", HandleTxResendExecutor(cfg)).Apply(middleware.ValidateBody[RequestTxResendExecutor])
+				txCC.Post("/watermarks", HandleTxSenderWatermarks(cfg)).Apply(middleware.ValidateBody[RequestTxSenderWatermarks])
+				txCC.Get("/metrics", HandleTxMetrics(cfg))
+			}
+
+			tx.Get("/executors/{id}", HandleGetTxExecutor(cfg)).Apply(middleware.TxPeer(cfg.PeerToken))
+		}
 	}
 
 	return r.Routes()
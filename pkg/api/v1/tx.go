@@ -1,15 +1,131 @@
 package v1
 
 import (
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"time"
+	"txchain/pkg/cc"
 	"txchain/pkg/database"
 	"txchain/pkg/format"
 	"txchain/pkg/middleware"
 	"txchain/pkg/router"
 )
 
+// TxCalendarCoordinator reserves the timestamps of a calendar chain and
+// checkpoints its executor before the handler runs the first hop. The chain
+// is only unordered if the SC-graph analysis allows it.
+func TxCalendarCoordinator[T cc.Partition](cfg *router.Config, service, chain string) middleware.Middlerware {
+	option := middleware.TxCoordinatorOption{
+		Level: CalendarChainLevel(chain),
+		Addr:  coordinatorAddr(cfg, service),
+	}
+	return middleware.TxCoordinator[T](cfg.DBConn, cfg.TxMgr, cfg.Logger, service, CalendarChainReceivers(chain), option)
+}
+
+// coordinatorAddr is where recovery resends the requests of a coordinator:
+// its peer address, or the address the server listens on.
+func coordinatorAddr(cfg *router.Config, service string) string {
+	if addr, ok := cfg.Peers[service]; ok {
+		return addr
+	}
+	host, port := cfg.Getenv(router.ConfigServerHost), cfg.Getenv(router.ConfigServerPort)
+	if host == "" || host == "0.0.0.0" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// txHop sends the hop-th hop of a chain to its receiver. The first hop of a
+// recovered pending executor is a dry run: it only succeeds if the hop was
+// already committed. A hop that cannot succeed is given up, but its reserved
+// timestamp is still delivered so later hops of the receiver do not wait.
+func txHop[In, Out, Req, Resp any](
+	cfg *router.Config,
+	client *http.Client,
+	execCtx *cc.TxExecutorContext,
+	hop int,
+	method, path string,
+	build func(input In) (Req, error),
+	merge func(input In, resp Resp) (Out, In, error),
+) *cc.TypedTxExecutorStage[In, Out] {
+	var receiver string
+	if hop < len(execCtx.Receivers) {
+		receiver = execCtx.Receivers[hop]
+	}
+
+	stage := cc.NewHTTPStage[Req, Resp](client, method, cfg.Peers[receiver], path, hop, execCtx)
+	if hop == 0 {
+		stage.DryRun(execCtx.Recovered && execCtx.Status == cc.ExecStatusPending)
+	}
+
+	advance := cc.HTTPAdvancer(cfg.PeerClient, cfg.Peers)
+	complete := func(input In) (In, error) {
+		// no timestamp was reserved for the hop
+		if hop >= len(execCtx.Timestamps) {
+			return input, nil
+		}
+		ctrlCtx := execCtx.CtrlCtx
+		timestamp := execCtx.Timestamps[hop]
+		return input, advance(receiver, ctrlCtx.Partition, ctrlCtx.Service, timestamp, ctrlCtx.Level)
+	}
+
+	return cc.NewTypedExecutorStage[In, Out]().
+		Stage(cc.MapHTTPStage(stage, build, merge)).
+		CompleteStage(complete)
+}
+
+// the result of a chain comes from its first hop
+func txPass[In, Out, Resp any](input In, _ Resp) (Out, In, error) {
+	var out Out
+	return out, input, nil
+}
+
+// checkpoints of the commit stage before the chain is given up to recovery
+const txChainCheckpointAttempts = 3
+
+// runTxChain runs the first hop and hands the remaining hops to the executor
+// manager once the commit is durable. Recovered executors resume from their
+// checkpoint.
+func runTxChain[In, Out any](cfg *router.Config, executor *cc.TypedTxExecutor[In, Out]) (Out, error) {
+	result, err := executor.Run()
+	if err != nil {
+		return result, err
+	}
+
+	// the executor stays pending on failure, recovery finds the first hop
+	// committed through its dry run
+	if err = checkpointTxChain(executor.Executor()); err != nil {
+		log.Println("checkpoint tx chain:", executor.Context().ExecID, err)
+		return result, fmt.Errorf("%w: %v", cc.ErrTxExecCheckpoint, err)
+	}
+	cfg.TxMgr.ExecMgr.Send(executor.Executor())
+	return result, nil
+}
+
+func checkpointTxChain(executor *cc.TxExecutor) error {
+	retry := cc.ExponentialBackoffRetry(100 * time.Millisecond)
+	var err error
+	for attempt := range txChainCheckpointAttempts {
+		if attempt > 0 {
+			time.Sleep(retry(attempt))
+		}
+		if err = executor.Checkpoint(); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func newTxChainExecutor[In, Out any](cfg *router.Config, r *http.Request) (*cc.TypedTxExecutor[In, Out], error) {
+	execCtx, ok := cc.GetTxExecCtx(r.Context())
+	if !ok {
+		return nil, cc.ErrTxExecEmpty
+	}
+	return cc.NewTypedTxExecutor[In, Out](execCtx, cfg.TxMgr.Checkpointer())
+}
+
 type RequestTxCreateEvent struct {
 	UserID       int64     `json:"user_id" schema:"user_id"`
 	EventName    string    `json:"event_name" schema:"event_name"`
@@ -20,72 +136,87 @@ type RequestTxCreateEvent struct {
 	Participants []int64   `json:"participants" schema:"participants"`
 }
 
+func (req RequestTxCreateEvent) Keys() []any {
+	return []any{req.UserID}
+}
+
 type ResponseTxCreateEvent struct {
 	EventID int64 `json:"event_id" schema:"event_id"`
 }
 
+type txCreateEventState struct {
+	RequestTxCreateEvent
+	EventID int64 `json:"event_id"`
+}
+
+func (state txCreateEventState) event() *APIEvent {
+	return &APIEvent{
+		EventID:      state.EventID,
+		EventName:    state.EventName,
+		EventInfo:    state.EventInfo,
+		HostID:       state.UserID,
+		StartAt:      state.StartAt,
+		EndAt:        state.EndAt,
+		Location:     state.Location,
+		Participants: state.Participants,
+	}
+}
+
 func HandleTxCreateEvent(cfg *router.Config) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var err error
-
 		client := &http.Client{
 			Timeout: DefaultTimeout,
 		}
 
-		req := middleware.UnmarshalRequest[RequestTxCreateEvent](r)
-		serviceUser := cfg.Peers[router.ServiceUser]
-		serviceEvent := cfg.Peers[router.ServiceEvent]
-		serviceEventLog := cfg.Peers[router.ServiceEventLog]
-		log.Println(cfg.Peers)
-		log.Println(serviceUser, serviceEvent, serviceEventLog)
-		log.Println(cfg.Getenv(router.ConfigServiceUserAddr), cfg.Getenv(router.ConfigServiceEventAddr), cfg.Getenv(router.ConfigServiceEventLogAddr))
-
-		event := &APIEvent{
-			EventName:    req.EventName,
-			EventInfo:    req.EventInfo,
-			HostID:       req.UserID,
-			StartAt:      req.StartAt,
-			EndAt:        req.EndAt,
-			Location:     req.Location,
-			Participants: req.Participants,
-		}
-		reqCreateEvent := &RequestCreateEvent{
-			Event: event,
-		}
-
-		var respCreateEvent *ResponseCreateEvent
-		respCreateEvent, err = PostRequestCreateEvent(client, serviceEvent, reqCreateEvent)
+		executor, err := newTxChainExecutor[txCreateEventState, ResponseTxCreateEvent](cfg, r)
 		if err != nil {
 			format.WriteJsonResponse(w, format.NewErrorResponse(ErrTxCreateEvent, err), http.StatusInternalServerError)
 			return
 		}
-
-		event.EventID = respCreateEvent.EventID
-		reqCreateEventLog := &RequestCreateEventLog{
-			UserID:    event.HostID,
-			EventID:   event.EventID,
-			EventType: string(database.EventCreate),
-			Event:     event,
-		}
-		_, err = PostRequestCreateEventLog(client, serviceEventLog, reqCreateEventLog)
+		execCtx := executor.Context()
+
+		createEvent := txHop(cfg, client, execCtx, 0, http.MethodPost, PathCreateEvent,
+			func(state txCreateEventState) (RequestCreateEvent, error) {
+				return RequestCreateEvent{
+					Event: state.event(),
+				}, nil
+			},
+			func(state txCreateEventState, resp ResponseCreateEvent) (ResponseTxCreateEvent, txCreateEventState, error) {
+				state.EventID = resp.EventID
+				return ResponseTxCreateEvent{EventID: resp.EventID}, state, nil
+			},
+		)
+		createEventLog := txHop(cfg, client, execCtx, 1, http.MethodPost, PathCreateEventLog,
+			func(state txCreateEventState) (RequestCreateEventLog, error) {
+				return RequestCreateEventLog{
+					UserID:    state.UserID,
+					EventID:   state.EventID,
+					EventType: string(database.EventCreate),
+					Event:     state.event(),
+				}, nil
+			},
+			txPass[txCreateEventState, ResponseTxCreateEvent, ResponseCreateEventLog],
+		)
+		addUserHostEvent := txHop(cfg, client, execCtx, 2, http.MethodPut, PathAddUserHostEvent,
+			func(state txCreateEventState) (RequestAddUserHostEvent, error) {
+				return RequestAddUserHostEvent{
+					UserID:  state.UserID,
+					EventID: state.EventID,
+				}, nil
+			},
+			txPass[txCreateEventState, ResponseTxCreateEvent, ResponseAddUserHostEvent],
+		)
+
+		executor.
+			CommitStage(createEvent).
+			Stage(createEventLog).
+			Stage(addUserHostEvent)
+
+		resp, err := runTxChain(cfg, executor)
 		if err != nil {
 			format.WriteJsonResponse(w, format.NewErrorResponse(ErrTxCreateEvent, err), http.StatusInternalServerError)
 			return
 		}
-
-		reqAddUserHostEvent := &RequestAddUserHostEvent{
-			UserID:  event.HostID,
-			EventID: event.EventID,
-		}
-		_, err = PutRequestAddUserHostEvent(client, serviceUser, reqAddUserHostEvent)
-		if err != nil {
-			format.WriteJsonResponse(w, format.NewErrorResponse(ErrTxCreateEvent, err), http.StatusInternalServerError)
-			return
-		}
-
-		resp := &ResponseTxCreateEvent{
-			EventID: event.EventID,
-		}
 		format.WriteJsonResponse(w, resp, http.StatusCreated)
 	})
 }
@@ -100,52 +231,67 @@ type RequestTxUpdateEvent struct {
 	Location  string    `json:"location" schema:"location"`
 }
 
+func (req RequestTxUpdateEvent) Keys() []any {
+	return []any{req.EventID}
+}
+
+func (req RequestTxUpdateEvent) event() *APIEvent {
+	return &APIEvent{
+		EventID:   req.EventID,
+		EventName: req.EventName,
+		EventInfo: req.EventInfo,
+		HostID:    req.UserID,
+		StartAt:   req.StartAt,
+		EndAt:     req.EndAt,
+		Location:  req.Location,
+	}
+}
+
 type ResponseTxUpdateEvent struct {
 }
 
 func HandleTxUpdateEvent(cfg *router.Config) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var err error
-
 		client := &http.Client{
 			Timeout: DefaultTimeout,
 		}
 
-		req := middleware.UnmarshalRequest[RequestTxUpdateEvent](r)
-		serviceEvent := cfg.Peers[router.ServiceEvent]
-		serviceEventLog := cfg.Peers[router.ServiceEventLog]
-
-		event := &APIEvent{
-			EventID:   req.EventID,
-			EventName: req.EventName,
-			EventInfo: req.EventInfo,
-			HostID:    req.UserID,
-			StartAt:   req.StartAt,
-			EndAt:     req.EndAt,
-			Location:  req.Location,
-		}
-		reqUpdateEvent := &RequestUpdateEvent{
-			Event: event,
-		}
-		_, err = PutRequestUpdateEvent(client, serviceEvent, reqUpdateEvent)
+		executor, err := newTxChainExecutor[RequestTxUpdateEvent, ResponseTxUpdateEvent](cfg, r)
 		if err != nil {
 			format.WriteJsonResponse(w, format.NewErrorResponse(ErrTxUpdateEvent, err), http.StatusInternalServerError)
 			return
 		}
-
-		reqCreateEventLog := &RequestCreateEventLog{
-			UserID:    req.UserID,
-			EventID:   req.EventID,
-			EventType: string(database.EventUpdate),
-			Event:     event,
-		}
-		_, err = PostRequestCreateEventLog(client, serviceEventLog, reqCreateEventLog)
+		execCtx := executor.Context()
+
+		updateEvent := txHop(cfg, client, execCtx, 0, http.MethodPut, PathUpdateEvent,
+			func(req RequestTxUpdateEvent) (RequestUpdateEvent, error) {
+				return RequestUpdateEvent{
+					Event: req.event(),
+				}, nil
+			},
+			txPass[RequestTxUpdateEvent, ResponseTxUpdateEvent, ResponseUpdateEvent],
+		)
+		createEventLog := txHop(cfg, client, execCtx, 1, http.MethodPost, PathCreateEventLog,
+			func(req RequestTxUpdateEvent) (RequestCreateEventLog, error) {
+				return RequestCreateEventLog{
+					UserID:    req.UserID,
+					EventID:   req.EventID,
+					EventType: string(database.EventUpdate),
+					Event:     req.event(),
+				}, nil
+			},
+			txPass[RequestTxUpdateEvent, ResponseTxUpdateEvent, ResponseCreateEventLog],
+		)
+
+		executor.
+			CommitStage(updateEvent).
+			Stage(createEventLog)
+
+		resp, err := runTxChain(cfg, executor)
 		if err != nil {
 			format.WriteJsonResponse(w, format.NewErrorResponse(ErrTxUpdateEvent, err), http.StatusInternalServerError)
 			return
 		}
-
-		resp := &ResponseTxUpdateEvent{}
 		format.WriteJsonResponse(w, resp, http.StatusNoContent)
 	})
 }
@@ -155,64 +301,83 @@ type RequestTxDeleteEvent struct {
 	EventID int64 `json:"event_id" schema:"event_id"`
 }
 
+func (req RequestTxDeleteEvent) Keys() []any {
+	return []any{req.EventID}
+}
+
 type ResponseTxDeleteEvent struct {
 }
 
+type txDeleteEventState struct {
+	RequestTxDeleteEvent
+	// read before the event is deleted, for the event log
+	Event *APIEvent `json:"event"`
+}
+
 func HandleTxDeleteEvent(cfg *router.Config) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var err error
-
 		client := &http.Client{
 			Timeout: DefaultTimeout,
 		}
 
-		req := middleware.UnmarshalRequest[RequestTxDeleteEvent](r)
-		serviceUser := cfg.Peers[router.ServiceUser]
-		serviceEvent := cfg.Peers[router.ServiceEvent]
-		serviceEventLog := cfg.Peers[router.ServiceEventLog]
-
-		reqRemoveUserHostEvent := &RequestRemoveUserHostEvent{
-			UserID:  req.UserID,
-			EventID: req.EventID,
-		}
-		_, err = PutRequestRemoveUserHostEvent(client, serviceUser, reqRemoveUserHostEvent)
-		if err != nil {
-			format.WriteJsonResponse(w, format.NewErrorResponse(ErrTxDeleteEvent, err), http.StatusInternalServerError)
-			return
-		}
-
-		reqGetEvent := &RequestGetEvent{
-			EventID: req.EventID,
-		}
-		var respGetEvent *ResponseGetEvent
-		respGetEvent, err = GetRequestGetEvent(client, serviceEvent, reqGetEvent)
-		if err != nil {
-			format.WriteJsonResponse(w, format.NewErrorResponse(ErrTxDeleteEvent, err), http.StatusInternalServerError)
-			return
-		}
-
-		reqDeleteEvent := &RequestDeleteEvent{
-			EventID: req.EventID,
-		}
-		_, err = DeleteRequestDeleteEvent(client, serviceEvent, reqDeleteEvent)
+		executor, err := newTxChainExecutor[txDeleteEventState, ResponseTxDeleteEvent](cfg, r)
 		if err != nil {
 			format.WriteJsonResponse(w, format.NewErrorResponse(ErrTxDeleteEvent, err), http.StatusInternalServerError)
 			return
 		}
-
-		reqCreateEventLog := &RequestCreateEventLog{
-			UserID:    req.UserID,
-			EventID:   req.EventID,
-			EventType: string(database.EventDelete),
-			Event:     respGetEvent.Event,
-		}
-		_, err = PostRequestCreateEventLog(client, serviceEventLog, reqCreateEventLog)
+		execCtx := executor.Context()
+
+		removeUserHostEvent := txHop(cfg, client, execCtx, 0, http.MethodPut, PathRemoveUserHostEvent,
+			func(state txDeleteEventState) (RequestRemoveUserHostEvent, error) {
+				return RequestRemoveUserHostEvent{
+					UserID:  state.UserID,
+					EventID: state.EventID,
+				}, nil
+			},
+			txPass[txDeleteEventState, ResponseTxDeleteEvent, ResponseRemoveUserHostEvent],
+		)
+		getEvent := txHop(cfg, client, execCtx, 1, http.MethodGet, PathGetEvent,
+			func(state txDeleteEventState) (RequestGetEvent, error) {
+				return RequestGetEvent{
+					EventID: state.EventID,
+				}, nil
+			},
+			func(state txDeleteEventState, resp ResponseGetEvent) (ResponseTxDeleteEvent, txDeleteEventState, error) {
+				state.Event = resp.Event
+				return ResponseTxDeleteEvent{}, state, nil
+			},
+		)
+		deleteEvent := txHop(cfg, client, execCtx, 2, http.MethodDelete, PathDeleteEvent,
+			func(state txDeleteEventState) (RequestDeleteEvent, error) {
+				return RequestDeleteEvent{
+					EventID: state.EventID,
+				}, nil
+			},
+			txPass[txDeleteEventState, ResponseTxDeleteEvent, ResponseDeleteEvent],
+		)
+		createEventLog := txHop(cfg, client, execCtx, 3, http.MethodPost, PathCreateEventLog,
+			func(state txDeleteEventState) (RequestCreateEventLog, error) {
+				return RequestCreateEventLog{
+					UserID:    state.UserID,
+					EventID:   state.EventID,
+					EventType: string(database.EventDelete),
+					Event:     state.Event,
+				}, nil
+			},
+			txPass[txDeleteEventState, ResponseTxDeleteEvent, ResponseCreateEventLog],
+		)
+
+		executor.
+			CommitStage(removeUserHostEvent).
+			Stage(getEvent).
+			Stage(deleteEvent).
+			Stage(createEventLog)
+
+		resp, err := runTxChain(cfg, executor)
 		if err != nil {
 			format.WriteJsonResponse(w, format.NewErrorResponse(ErrTxDeleteEvent, err), http.StatusInternalServerError)
 			return
 		}
-
-		resp := &ResponseTxDeleteEvent{}
 		format.WriteJsonResponse(w, resp, http.StatusNoContent)
 	})
 }
@@ -223,44 +388,56 @@ type RequestTxJoinEvent struct {
 	ParticipantID int64 `json:"participant_id" schema:"participant_id"`
 }
 
+func (req RequestTxJoinEvent) Keys() []any {
+	return []any{req.EventID}
+}
+
 type ResponseTxJoinEvent struct {
 }
 
 func HandleTxJoinEvent(cfg *router.Config) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var err error
-
 		client := &http.Client{
 			Timeout: DefaultTimeout,
 		}
 
-		req := middleware.UnmarshalRequest[RequestTxJoinEvent](r)
-		serviceEvent := cfg.Peers[router.ServiceEvent]
-		serviceEventLog := cfg.Peers[router.ServiceEventLog]
-
-		reqAddEventParticipant := &RequestAddEventParticipant{
-			EventID:       req.EventID,
-			ParticipantID: req.ParticipantID,
-		}
-		_, err = PutRequestAddEventParticipant(client, serviceEvent, reqAddEventParticipant)
+		executor, err := newTxChainExecutor[RequestTxJoinEvent, ResponseTxJoinEvent](cfg, r)
 		if err != nil {
 			format.WriteJsonResponse(w, format.NewErrorResponse(ErrTxJoinEvent, err), http.StatusInternalServerError)
 			return
 		}
-
-		reqCreateEventLog := &RequestCreateEventLog{
-			UserID:    req.ParticipantID,
-			EventID:   req.EventID,
-			EventType: string(database.EventJoin),
-			Event:     &APIEvent{},
-		}
-		_, err = PostRequestCreateEventLog(client, serviceEventLog, reqCreateEventLog)
+		execCtx := executor.Context()
+
+		addEventParticipant := txHop(cfg, client, execCtx, 0, http.MethodPut, PathAddEventParticipant,
+			func(req RequestTxJoinEvent) (RequestAddEventParticipant, error) {
+				return RequestAddEventParticipant{
+					EventID:       req.EventID,
+					ParticipantID: req.ParticipantID,
+				}, nil
+			},
+			txPass[RequestTxJoinEvent, ResponseTxJoinEvent, ResponseAddEventParticipant],
+		)
+		createEventLog := txHop(cfg, client, execCtx, 1, http.MethodPost, PathCreateEventLog,
+			func(req RequestTxJoinEvent) (RequestCreateEventLog, error) {
+				return RequestCreateEventLog{
+					UserID:    req.ParticipantID,
+					EventID:   req.EventID,
+					EventType: string(database.EventJoin),
+					Event:     &APIEvent{},
+				}, nil
+			},
+			txPass[RequestTxJoinEvent, ResponseTxJoinEvent, ResponseCreateEventLog],
+		)
+
+		executor.
+			CommitStage(addEventParticipant).
+			Stage(createEventLog)
+
+		resp, err := runTxChain(cfg, executor)
 		if err != nil {
 			format.WriteJsonResponse(w, format.NewErrorResponse(ErrTxJoinEvent, err), http.StatusInternalServerError)
 			return
 		}
-
-		resp := &ResponseTxJoinEvent{}
 		format.WriteJsonResponse(w, resp, http.StatusNoContent)
 	})
 }
@@ -271,44 +448,56 @@ type RequestTxLeaveEvent struct {
 	ParticipantID int64 `json:"participant_id" schema:"participant_id"`
 }
 
+func (req RequestTxLeaveEvent) Keys() []any {
+	return []any{req.EventID}
+}
+
 type ResponseTxLeaveEvent struct {
 }
 
 func HandleTxLeaveEvent(cfg *router.Config) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var err error
-
 		client := &http.Client{
 			Timeout: DefaultTimeout,
 		}
 
-		req := middleware.UnmarshalRequest[RequestTxLeaveEvent](r)
-		serviceEvent := cfg.Peers[router.ServiceEvent]
-		serviceEventLog := cfg.Peers[router.ServiceEventLog]
-
-		reqRemoveEventParticipant := &RequestRemoveEventParticipant{
-			EventID:       req.EventID,
-			ParticipantID: req.ParticipantID,
-		}
-		_, err = PutRequestRemoveEventParticipant(client, serviceEvent, reqRemoveEventParticipant)
+		executor, err := newTxChainExecutor[RequestTxLeaveEvent, ResponseTxLeaveEvent](cfg, r)
 		if err != nil {
 			format.WriteJsonResponse(w, format.NewErrorResponse(ErrTxLeaveEvent, err), http.StatusInternalServerError)
 			return
 		}
-
-		reqCreateEventLog := &RequestCreateEventLog{
-			UserID:    req.ParticipantID,
-			EventID:   req.EventID,
-			EventType: string(database.EventLeave),
-			Event:     &APIEvent{},
-		}
-		_, err = PostRequestCreateEventLog(client, serviceEventLog, reqCreateEventLog)
+		execCtx := executor.Context()
+
+		removeEventParticipant := txHop(cfg, client, execCtx, 0, http.MethodPut, PathRemoveEventParticipant,
+			func(req RequestTxLeaveEvent) (RequestRemoveEventParticipant, error) {
+				return RequestRemoveEventParticipant{
+					EventID:       req.EventID,
+					ParticipantID: req.ParticipantID,
+				}, nil
+			},
+			txPass[RequestTxLeaveEvent, ResponseTxLeaveEvent, ResponseRemoveEventParticipant],
+		)
+		createEventLog := txHop(cfg, client, execCtx, 1, http.MethodPost, PathCreateEventLog,
+			func(req RequestTxLeaveEvent) (RequestCreateEventLog, error) {
+				return RequestCreateEventLog{
+					UserID:    req.ParticipantID,
+					EventID:   req.EventID,
+					EventType: string(database.EventLeave),
+					Event:     &APIEvent{},
+				}, nil
+			},
+			txPass[RequestTxLeaveEvent, ResponseTxLeaveEvent, ResponseCreateEventLog],
+		)
+
+		executor.
+			CommitStage(removeEventParticipant).
+			Stage(createEventLog)
+
+		resp, err := runTxChain(cfg, executor)
 		if err != nil {
 			format.WriteJsonResponse(w, format.NewErrorResponse(ErrTxLeaveEvent, err), http.StatusInternalServerError)
 			return
 		}
-
-		resp := &ResponseTxLeaveEvent{}
 		format.WriteJsonResponse(w, resp, http.StatusNoContent)
 	})
 }
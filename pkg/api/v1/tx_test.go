@@ -1,12 +1,15 @@
 package v1
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"slices"
 	"testing"
 	"time"
+	"txchain/pkg/cc"
 	"txchain/pkg/database"
+	"txchain/pkg/router"
 
 	"github.com/stretchr/testify/require"
 	tctr "github.com/testcontainers/testcontainers-go"
@@ -122,11 +125,13 @@ func TestCalendarTxAPI(t *testing.T) {
 		UserID: user.ID,
 	}
 	user.HostEvents = slices.Sorted(slices.Values(append(user.HostEvents, respTxCreateEvent.EventID)))
+	// the hops after the first one complete asynchronously
+	testEventuallyUserHostEvents(t, client, serverUser.URL, user.ID, user.HostEvents)
+	testEventuallyEventLogs(t, client, serverEventLog.URL, respTxCreateEvent.EventID, 1)
 	respGetUser, err := GetRequestGetUser(client, serverUser.URL, reqGetUser)
 	require.NoError(t, err)
 	require.Equal(t, user.ID, respGetUser.UserID)
 	require.Equal(t, user.Name, respGetUser.UserName)
-	require.Equal(t, user.HostEvents, slices.Sorted(slices.Values(respGetUser.HostEvents)))
 
 	reqGetEvent := &RequestGetEvent{
 		EventID: event1Create.EventID,
@@ -151,6 +156,7 @@ func TestCalendarTxAPI(t *testing.T) {
 	}
 	_, err = PutRequestTxJoinEvent(client, serverEvent.URL, reqTxJoinEvent)
 	require.NoError(t, err)
+	testEventuallyEventLogs(t, client, serverEventLog.URL, event1Create.EventID, 2)
 
 	// Update event via tx
 	event1Update := &APIEvent{
@@ -173,6 +179,7 @@ func TestCalendarTxAPI(t *testing.T) {
 	}
 	_, err = PutRequestTxUpdateEvent(client, serverUser.URL, reqTxUpdateEvent)
 	require.NoError(t, err)
+	testEventuallyEventLogs(t, client, serverEventLog.URL, event1Create.EventID, 3)
 
 	// Leave event via tx
 	var leaveParticipantID int64 = 20
@@ -183,6 +190,7 @@ func TestCalendarTxAPI(t *testing.T) {
 	}
 	_, err = PutRequestTxLeaveEvent(client, serverEvent.URL, reqTxLeaveEvent)
 	require.NoError(t, err)
+	testEventuallyEventLogs(t, client, serverEventLog.URL, event1Create.EventID, 4)
 
 	event1Update.Participants = []int64{10, 30, 40}
 	respGetEvent, err = GetRequestGetEvent(client, serverEvent.URL, reqGetEvent)
@@ -203,6 +211,7 @@ func TestCalendarTxAPI(t *testing.T) {
 	}
 	_, err = DeleteRequestTxDeleteEvent(client, serverUser.URL, reqTxDeleteEvent)
 	require.NoError(t, err)
+	testEventuallyEventLogs(t, client, serverEventLog.URL, event1Create.EventID, 5)
 
 	_, err = GetRequestGetEvent(client, serverEvent.URL, reqGetEvent)
 	require.Error(t, err)
@@ -289,3 +298,69 @@ func TestCalendarTxAPI(t *testing.T) {
 	require.Equal(t, event1DeleteLog.EventType, dbEvent1DeleteLog.EventType)
 	require.Equal(t, event1DeleteLog.Content, dbEvent1DeleteLog.Content)
 }
+
+func testEventuallyUserHostEvents(t *testing.T, client *http.Client, addr string, userID int64, hostEvents []int64) {
+	t.Helper()
+
+	reqGetUser := &RequestGetUser{
+		UserID: userID,
+	}
+	require.Eventually(t, func() bool {
+		respGetUser, err := GetRequestGetUser(client, addr, reqGetUser)
+		if err != nil {
+			return false
+		}
+		return slices.Equal(hostEvents, slices.Sorted(slices.Values(respGetUser.HostEvents)))
+	}, 10*time.Second, 100*time.Millisecond)
+}
+
+func testEventuallyEventLogs(t *testing.T, client *http.Client, addr string, eventID int64, count int) {
+	t.Helper()
+
+	reqGetEventLogs := &RequestGetEventLogs{
+		EventID: eventID,
+	}
+	require.Eventually(t, func() bool {
+		respGetEventLogs, err := GetRequestGetEventLogs(client, addr, reqGetEventLogs)
+		if err != nil {
+			return false
+		}
+		return len(respGetEventLogs.EventLogs) == count
+	}, 10*time.Second, 100*time.Millisecond)
+}
+
+func TestCoordinatorAddr(t *testing.T) {
+	env := map[string]string{
+		router.ConfigServerHost: "0.0.0.0",
+		router.ConfigServerPort: "8080",
+	}
+	cfg := &router.Config{
+		Getenv: func(key string) string { return env[key] },
+		Peers: map[string]string{
+			router.ServiceUser: "http://user-service:8080",
+		},
+	}
+	require.Equal(t, "http://user-service:8080", coordinatorAddr(cfg, router.ServiceUser))
+	require.Equal(t, "http://localhost:8080", coordinatorAddr(cfg, router.ServiceEvent))
+}
+
+func TestCheckpointTxChain(t *testing.T) {
+	failures := 2
+	attempts := 0
+	executor := cc.NewTxExecutor(&cc.TxExecutorContext{}, func(*cc.TxExecutorContext) error {
+		attempts++
+		if attempts <= failures {
+			return errors.New("checkpoint failed")
+		}
+		return nil
+	})
+
+	// a transient failure is retried
+	require.NoError(t, checkpointTxChain(executor))
+	require.Equal(t, 3, attempts)
+
+	// the chain is not sent without a durable commit
+	failures, attempts = txChainCheckpointAttempts+1, 0
+	require.Error(t, checkpointTxChain(executor))
+	require.Equal(t, txChainCheckpointAttempts, attempts)
+}
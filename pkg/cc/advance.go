@@ -0,0 +1,64 @@
+package cc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"txchain/pkg/format"
+)
+
+var (
+	ErrTxAdvanceUnknownReceiver = errors.New("unknown advance receiver")
+	ErrTxAdvanceRequest         = errors.New("failed to perform advance request")
+)
+
+const (
+	PathTxAdvanceTimestamp = "/api/v1/tx/cc/advance"
+)
+
+type TxAdvanceTimestamp struct {
+	Partition uint64             `json:"partition"`
+	Service   string             `json:"service"`
+	Timestamp uint64             `json:"timestamp"`
+	Level     SerializationLevel `json:"level"`
+}
+
+// HTTPAdvancer posts skip hops to the advance endpoint of the receiver's peer.
+func HTTPAdvancer(client *http.Client, peers map[string]string) AdvanceFunc {
+	return func(receiver string, partition uint64, service string, timestamp uint64, level SerializationLevel) error {
+		addr, ok := peers[receiver]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrTxAdvanceUnknownReceiver, receiver)
+		}
+
+		body := TxAdvanceTimestamp{
+			Partition: partition,
+			Service:   service,
+			Timestamp: timestamp,
+			Level:     level,
+		}
+		b, err := json.Marshal(body)
+		if err != nil {
+			return errors.Join(err, format.ErrJsonEncode)
+		}
+
+		req, err := http.NewRequest(http.MethodPost, addr+PathTxAdvanceTimestamp, bytes.NewReader(b))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("%w: %d", ErrTxAdvanceRequest, resp.StatusCode)
+		}
+		return nil
+	}
+}
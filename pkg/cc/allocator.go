@@ -0,0 +1,129 @@
+package cc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrTxTimestampReserve = errors.New("failed to reserve tx timestamps")
+)
+
+const (
+	DefaultTimestampBlockSize = 64
+)
+
+// TxTimestampAllocator hands out sender timestamps from blocks reserved per
+// (partition, receiver). A block is persisted once as (lo, ts] in
+// TxSenderClocks, so most chains only allocate in memory. Timestamps of a
+// block that are never allocated, because the process stopped, are delivered
+// as no-op hops on recovery.
+//
+// The caller must hold the sender partition lock across Reserve and Commit.
+type TxTimestampAllocator struct {
+	conn      TxBatchSender
+	clockMgr  *TxClockManager
+	reserved  *TxClockManager
+	blockSize uint64
+}
+
+func NewTxTimestampAllocator(conn TxBatchSender, clockMgr *TxClockManager) *TxTimestampAllocator {
+	return &TxTimestampAllocator{
+		conn:      conn,
+		clockMgr:  clockMgr,
+		reserved:  NewTxClockManager(clockMgr.partitions),
+		blockSize: DefaultTimestampBlockSize,
+	}
+}
+
+// BlockSize sets the timestamps reserved per round-trip. A block size of 1
+// persists every allocation.
+func (a *TxTimestampAllocator) BlockSize(blockSize uint64) *TxTimestampAllocator {
+	if blockSize > 0 {
+		a.blockSize = blockSize
+	}
+	return a
+}
+
+// Reserve returns the timestamps of the receivers of a new chain sent by
+// origin, and the last timestamp per receiver to pass to Commit. Blocks are
+// only persisted when a receiver runs out of reserved timestamps.
+func (a *TxTimestampAllocator) Reserve(
+	ctx context.Context,
+	partition uint64,
+	origin string,
+	receivers []string,
+) ([]uint64, map[string]uint64, error) {
+	next := map[string]uint64{}
+	timestamps := make([]uint64, 0, len(receivers))
+	for _, receiver := range receivers {
+		ts, ok := next[receiver]
+		if !ok {
+			ts = a.clockMgr.Get(partition, receiver)
+		}
+		next[receiver] = ts + 1
+		timestamps = append(timestamps, ts+1)
+	}
+
+	query := `
+		INSERT INTO TxSenderClocks (prt, svc, ts, lo, origin)
+		VALUES (@partition, @service, @timestamp, @lo, @origin)
+		ON CONFLICT (prt, svc)
+		DO UPDATE SET
+			ts = GREATEST(TxSenderClocks.ts, EXCLUDED.ts),
+			lo = EXCLUDED.lo,
+			origin = EXCLUDED.origin;
+	`
+	batch := &pgx.Batch{}
+	blocks := map[string]uint64{}
+	for receiver, ts := range next {
+		hi := a.reserved.Get(partition, receiver)
+		if ts <= hi {
+			continue
+		}
+		// everything up to the previous block has been allocated
+		blocks[receiver] = ts + a.blockSize - 1
+		batch.Queue(query, pgx.NamedArgs{
+			"partition": partition,
+			"service":   receiver,
+			"timestamp": blocks[receiver],
+			"lo":        hi,
+			"origin":    origin,
+		})
+	}
+	if len(blocks) == 0 {
+		return timestamps, next, nil
+	}
+
+	if err := a.conn.SendBatch(ctx, batch).Close(); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrTxTimestampReserve, err)
+	}
+	for receiver, hi := range blocks {
+		a.reserved.Set(partition, receiver, hi)
+	}
+	return timestamps, next, nil
+}
+
+// Commit allocates the timestamps returned by Reserve once the chain is
+// persisted. Timestamps that are reserved but not committed are handed out
+// again.
+func (a *TxTimestampAllocator) Commit(partition uint64, next map[string]uint64) {
+	for receiver, ts := range next {
+		a.clockMgr.Set(partition, receiver, ts)
+	}
+}
+
+// Restore resumes allocation after the persisted block. Its unused timestamps
+// are skipped by the recovery manager.
+func (a *TxTimestampAllocator) Restore(partition uint64, service string, timestamp uint64) {
+	a.clockMgr.Set(partition, service, timestamp)
+	a.reserved.Set(partition, service, timestamp)
+}
+
+// Reserved returns the highest persisted timestamp of a receiver.
+func (a *TxTimestampAllocator) Reserved(partition uint64, service string) uint64 {
+	return a.reserved.Get(partition, service)
+}
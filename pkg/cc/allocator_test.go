@@ -0,0 +1,202 @@
+package cc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"txchain/pkg/database"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+type testReserveSender struct {
+	blocks []pgx.NamedArgs
+	err    error
+}
+
+func (sender *testReserveSender) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	if sender.err == nil {
+		for _, query := range b.QueuedQueries {
+			sender.blocks = append(sender.blocks, query.Arguments[0].(pgx.NamedArgs))
+		}
+	}
+	return &testBatchResults{err: sender.err}
+}
+
+func TestTxTimestampAllocator(t *testing.T) {
+	const (
+		origin   = "service-tx"
+		serviceA = "service-a"
+		serviceB = "service-b"
+	)
+	sender := &testReserveSender{}
+	clockMgr := NewTxClockManager(4)
+	allocator := NewTxTimestampAllocator(sender, clockMgr).BlockSize(3)
+	ctx := context.Background()
+
+	// the first chain reserves a block for every receiver
+	timestamps, next, err := allocator.Reserve(ctx, 1, origin, []string{serviceA, serviceB, serviceA})
+	require.NoError(t, err)
+	require.Equal(t, []uint64{1, 1, 2}, timestamps)
+	require.Len(t, sender.blocks, 2)
+	for _, block := range sender.blocks {
+		require.Equal(t, uint64(0), block["lo"])
+		require.Equal(t, origin, block["origin"])
+	}
+	require.Equal(t, uint64(4), allocator.Reserved(1, serviceA))
+	require.Equal(t, uint64(3), allocator.Reserved(1, serviceB))
+	allocator.Commit(1, next)
+	require.Equal(t, uint64(2), clockMgr.Get(1, serviceA))
+
+	// later chains allocate in memory until a block runs out
+	timestamps, next, err = allocator.Reserve(ctx, 1, origin, []string{serviceA, serviceB})
+	require.NoError(t, err)
+	require.Equal(t, []uint64{3, 2}, timestamps)
+	require.Len(t, sender.blocks, 2)
+	allocator.Commit(1, next)
+
+	timestamps, next, err = allocator.Reserve(ctx, 1, origin, []string{serviceA})
+	require.NoError(t, err)
+	require.Equal(t, []uint64{4}, timestamps)
+	require.Len(t, sender.blocks, 2)
+	allocator.Commit(1, next)
+
+	// uncommitted timestamps are handed out again
+	timestamps, _, err = allocator.Reserve(ctx, 1, origin, []string{serviceA})
+	require.NoError(t, err)
+	require.Equal(t, []uint64{5}, timestamps)
+	require.Len(t, sender.blocks, 3)
+	require.Equal(t, uint64(4), sender.blocks[2]["lo"])
+	require.Equal(t, uint64(7), sender.blocks[2]["timestamp"])
+
+	timestamps, _, err = allocator.Reserve(ctx, 1, origin, []string{serviceA})
+	require.NoError(t, err)
+	require.Equal(t, []uint64{5}, timestamps)
+	require.Len(t, sender.blocks, 3)
+
+	// a failed reservation allocates nothing
+	sender.err = errors.New("connection reset")
+	_, _, err = allocator.Reserve(ctx, 2, origin, []string{serviceA})
+	require.ErrorIs(t, err, ErrTxTimestampReserve)
+	require.Zero(t, allocator.Reserved(2, serviceA))
+	require.Zero(t, clockMgr.Get(2, serviceA))
+
+	// recovery resumes after the persisted block
+	allocator.Restore(3, serviceB, 9)
+	sender.err = nil
+	timestamps, _, err = allocator.Reserve(ctx, 3, origin, []string{serviceB})
+	require.NoError(t, err)
+	require.Equal(t, []uint64{10}, timestamps)
+	require.Equal(t, uint64(9), sender.blocks[3]["lo"])
+}
+
+func TestTxRecoveryReservedTimestamps(t *testing.T) {
+	pgc, err := database.NewContainerTablesTx(t, "17.1")
+	defer func() {
+		if pgc != nil {
+			testcontainers.CleanupContainer(t, pgc.Container)
+		}
+	}()
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	conn, err := pgxpool.New(ctx, pgc.Endpoint())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	const (
+		origin   = "service-tx"
+		serviceA = "service-a"
+		serviceB = "service-b"
+	)
+	partitions := uint64(4)
+
+	// a chain took 1 of service-a and 1 of service-b, the rest of the blocks
+	// was reserved before the restart
+	allocator := NewTxTimestampAllocator(conn, NewTxClockManager(partitions)).BlockSize(4)
+	timestamps, next, err := allocator.Reserve(ctx, 2, origin, []string{serviceA, serviceB})
+	require.NoError(t, err)
+	execCtx := &TxExecutorContext{
+		CtrlCtx:    &TxControlContext{Partition: 2, Service: origin},
+		Receivers:  []string{serviceA, serviceB},
+		Timestamps: timestamps,
+		Status:     ExecStatusCompleted,
+	}
+	require.NoError(t, InsertCheckpointExecutorContext(conn, execCtx))
+	allocator.Commit(2, next)
+
+	// archived executors still used their timestamps
+	compactor := NewTxResultCompactor(conn, TxResultCompactorOption{
+		ExecutorRetention: time.Nanosecond,
+		Archive:           true,
+	})
+	n, err := compactor.CompactExecutors(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+
+	type advance struct {
+		receiver  string
+		partition uint64
+		service   string
+		timestamp uint64
+	}
+	advances := make(chan advance, 16)
+	execMgr := NewTxExecutorManager(ExponentialBackoffRetry(10 * time.Millisecond)).
+		Advancer(func(receiver string, partition uint64, service string, timestamp uint64, level SerializationLevel) error {
+			advances <- advance{receiver, partition, service, timestamp}
+			return nil
+		})
+	go execMgr.Run()
+	defer execMgr.Shutdown(ctx)
+
+	sendClockMgr := NewTxClockManager(partitions)
+	recovered := NewTxTimestampAllocator(conn, sendClockMgr)
+	recoveryMgr := NewTxRecoveryManager(conn, sendClockMgr, NewTxClockManager(partitions), execMgr).
+		Allocator(recovered)
+	require.NoError(t, recoveryMgr.Recover())
+
+	// allocation resumes after the blocks
+	require.Equal(t, uint64(4), sendClockMgr.Get(2, serviceA))
+	require.Equal(t, uint64(4), recovered.Reserved(2, serviceB))
+
+	var got []advance
+	for range 6 {
+		select {
+		case a := <-advances:
+			got = append(got, a)
+		case <-time.After(5 * time.Second):
+			t.Fatal("unused timestamps were not skipped")
+		}
+	}
+	require.ElementsMatch(t, []advance{
+		{serviceA, 2, origin, 2},
+		{serviceA, 2, origin, 3},
+		{serviceA, 2, origin, 4},
+		{serviceB, 2, origin, 2},
+		{serviceB, 2, origin, 3},
+		{serviceB, 2, origin, 4},
+	}, got)
+
+	// the blocks are closed and the skip executors take over
+	var open int
+	row := conn.QueryRow(ctx, `SELECT COUNT(*) FROM TxSenderClocks WHERE lo < ts;`)
+	require.NoError(t, row.Scan(&open))
+	require.Zero(t, open)
+	require.Eventually(t, func() bool {
+		execCtxs, err := GetAllTxExecutorCheckpoint(conn, ExecStatusAborted)
+		require.NoError(t, err)
+		return len(execCtxs) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the hops of the closed blocks are no longer needed
+	n, err = compactor.CompactHops(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(8), n)
+	n, err = compactor.CompactHops(ctx)
+	require.NoError(t, err)
+	require.Zero(t, n)
+}
@@ -0,0 +1,170 @@
+package cc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrTxCheckpointBatch    = errors.New("failed to write tx checkpoint batch")
+	ErrTxCheckpointShutdown = errors.New("tx checkpoint batcher did not stop in time")
+)
+
+const (
+	DefaultCheckpointWindow   = 2 * time.Millisecond
+	DefaultCheckpointMaxBatch = 256
+)
+
+// TxBatchSender is satisfied by both *pgxpool.Pool and pgx.Tx.
+type TxBatchSender interface {
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+}
+
+type TxCheckpointBatcherOption struct {
+	// how long the first checkpoint of a batch waits for others
+	Window time.Duration
+	// checkpoints written per batch
+	MaxBatch int
+}
+
+type checkpointRequest struct {
+	args []any
+	done chan error
+}
+
+// TxCheckpointBatcher group-commits the checkpoints of concurrent executors.
+// Checkpoints arriving within the window are written in one pgx.Batch, which
+// runs in a single implicit transaction, and every executor waits until its
+// batch is durable before its stage proceeds. Checkpoints are written one by
+// one while the batcher is not running.
+type TxCheckpointBatcher struct {
+	conn     TxBatchSender
+	window   time.Duration
+	maxBatch int
+	reqs     chan *checkpointRequest
+	running  atomic.Bool
+	lifecycle
+	batches     atomic.Uint64
+	checkpoints atomic.Uint64
+}
+
+func NewTxCheckpointBatcher(conn TxBatchSender, options ...TxCheckpointBatcherOption) *TxCheckpointBatcher {
+	var option TxCheckpointBatcherOption
+	if len(options) > 0 {
+		option = options[0]
+	}
+	if option.Window <= 0 {
+		option.Window = DefaultCheckpointWindow
+	}
+	if option.MaxBatch <= 0 {
+		option.MaxBatch = DefaultCheckpointMaxBatch
+	}
+
+	return &TxCheckpointBatcher{
+		conn:      conn,
+		window:    option.Window,
+		maxBatch:  option.MaxBatch,
+		reqs:      make(chan *checkpointRequest),
+		lifecycle: newLifecycle(),
+	}
+}
+
+func (b *TxCheckpointBatcher) Checkpointer() CheckpointFunc {
+	return b.Checkpoint
+}
+
+// Checkpoint returns once the checkpoint is durable.
+func (b *TxCheckpointBatcher) Checkpoint(execCtx *TxExecutorContext) error {
+	args, err := checkpointArgs(execCtx)
+	if err != nil {
+		return err
+	}
+
+	req := &checkpointRequest{
+		args: args,
+		done: make(chan error, 1),
+	}
+	if !b.running.Load() {
+		return b.flush([]*checkpointRequest{req})
+	}
+
+	select {
+	case b.reqs <- req:
+		return <-req.done
+	case <-b.stop:
+		return b.flush([]*checkpointRequest{req})
+	}
+}
+
+// Start runs the batcher in a new goroutine.
+func (b *TxCheckpointBatcher) Start() {
+	b.goLoop(b.run)
+}
+
+// Run batches checkpoints until Shutdown is called.
+func (b *TxCheckpointBatcher) Run() {
+	b.runLoop(b.run)
+}
+
+func (b *TxCheckpointBatcher) run() {
+	b.running.Store(true)
+	defer b.running.Store(false)
+
+	for {
+		var batch []*checkpointRequest
+		select {
+		case <-b.stop:
+			return
+		case req := <-b.reqs:
+			batch = append(batch, req)
+		}
+
+		timer := time.NewTimer(b.window)
+	collect:
+		for len(batch) < b.maxBatch {
+			select {
+			case req := <-b.reqs:
+				batch = append(batch, req)
+			case <-timer.C:
+				break collect
+			case <-b.stop:
+				break collect
+			}
+		}
+		timer.Stop()
+
+		err := b.flush(batch)
+		for _, req := range batch {
+			req.done <- err
+		}
+	}
+}
+
+// Shutdown waits for the batch being written. It should be called after the
+// executor manager stopped, later checkpoints are written one by one.
+func (b *TxCheckpointBatcher) Shutdown(ctx context.Context) error {
+	return b.shutdown(ctx, ErrTxCheckpointShutdown, nil)
+}
+
+// flush writes the batch in one implicit transaction. No checkpoint of a
+// failed batch is durable, so none of them queued its webhook.
+func (b *TxCheckpointBatcher) flush(reqs []*checkpointRequest) error {
+	batch := &pgx.Batch{}
+	for _, req := range reqs {
+		batch.Queue(updateCheckpointQuery, req.args...)
+	}
+
+	err := b.conn.SendBatch(context.Background(), batch).Close()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrTxCheckpointBatch, err)
+	}
+
+	b.batches.Add(1)
+	b.checkpoints.Add(uint64(len(reqs)))
+	return nil
+}
@@ -0,0 +1,118 @@
+package cc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+)
+
+type testBatchSender struct {
+	mu      sync.Mutex
+	batches [][]uint64
+	err     error
+}
+
+func (sender *testBatchSender) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	sender.mu.Lock()
+	defer sender.mu.Unlock()
+
+	var execIDs []uint64
+	for _, query := range b.QueuedQueries {
+		execIDs = append(execIDs, query.Arguments[0].(uint64))
+	}
+	sender.batches = append(sender.batches, execIDs)
+	return &testBatchResults{err: sender.err}
+}
+
+func (sender *testBatchSender) Batches() [][]uint64 {
+	sender.mu.Lock()
+	defer sender.mu.Unlock()
+	return sender.batches
+}
+
+type testBatchResults struct {
+	err error
+}
+
+func (results *testBatchResults) Exec() (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, results.err
+}
+
+func (results *testBatchResults) Query() (pgx.Rows, error) {
+	return nil, results.err
+}
+
+func (results *testBatchResults) QueryRow() pgx.Row {
+	return nil
+}
+
+func (results *testBatchResults) Close() error {
+	return results.err
+}
+
+func testConcurrentCheckpoints(t *testing.T, batcher *TxCheckpointBatcher, n int) {
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			execCtx := defaultExecCtx()
+			execCtx.ExecID = uint64(i + 1)
+			require.NoError(t, batcher.Checkpoint(execCtx))
+		}()
+	}
+	wg.Wait()
+}
+
+func TestTxCheckpointBatcher(t *testing.T) {
+	sender := &testBatchSender{}
+	batcher := NewTxCheckpointBatcher(sender, TxCheckpointBatcherOption{
+		Window:   100 * time.Millisecond,
+		MaxBatch: 4,
+	})
+
+	// checkpoints are written one by one until the batcher runs
+	execCtx := defaultExecCtx()
+	execCtx.ExecID = 100
+	require.NoError(t, batcher.Checkpoint(execCtx))
+	require.Equal(t, [][]uint64{{100}}, sender.Batches())
+
+	go batcher.Run()
+	require.Eventually(t, batcher.running.Load, time.Second, time.Millisecond)
+
+	testConcurrentCheckpoints(t, batcher, 10)
+	batches := sender.Batches()[1:]
+	require.Len(t, batches, 3)
+	var execIDs []uint64
+	for _, batch := range batches {
+		require.LessOrEqual(t, len(batch), 4)
+		execIDs = append(execIDs, batch...)
+	}
+	require.ElementsMatch(t, []uint64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, execIDs)
+	require.Equal(t, uint64(4), batcher.batches.Load())
+	require.Equal(t, uint64(11), batcher.checkpoints.Load())
+
+	// a failed batch fails every checkpoint in it
+	sender.mu.Lock()
+	sender.err = errors.New("connection reset")
+	sender.mu.Unlock()
+	err := batcher.Checkpoint(execCtx)
+	require.ErrorIs(t, err, ErrTxCheckpointBatch)
+
+	sender.mu.Lock()
+	sender.err = nil
+	sender.mu.Unlock()
+	require.NoError(t, batcher.Shutdown(context.Background()))
+	require.False(t, batcher.running.Load())
+
+	// and again one by one after shutdown
+	count := len(sender.Batches())
+	require.NoError(t, batcher.Checkpoint(execCtx))
+	require.Len(t, sender.Batches(), count+1)
+}
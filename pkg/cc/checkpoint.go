@@ -8,13 +8,25 @@ import (
 	"txchain/pkg/format"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 var (
-	ErrTxDryRun = errors.New("dry run a tx")
+	ErrTxDryRun            = errors.New("dry run a tx")
+	ErrTxExecutorDuplicate = errors.New("tx executor with the same idempotency key exists")
 )
 
+// TxExecer is satisfied by both *pgxpool.Pool and pgx.Tx.
+type TxExecer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+// TxQueryRower is satisfied by both *pgxpool.Pool and pgx.Tx.
+type TxQueryRower interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 type CheckpointFunc = func(execCtx *TxExecutorContext) error
 type CheckpointRetriverFunc = func(execID uint64) (ExecStatus, *TxExecutorContext, error)
 
@@ -52,6 +64,36 @@ func GetTxExecutorCheckpoint(conn *pgxpool.Pool, execID uint64) (ExecStatus, *Tx
 	return status, &execCtx, nil
 }
 
+// FindTxExecutorCheckpoint returns the executor from TxExecutor or, once the
+// compactor moved it, from TxExecutorArchive.
+func FindTxExecutorCheckpoint(conn *pgxpool.Pool, execID uint64) (ExecStatus, *TxExecutorContext, bool, error) {
+	query := `
+		SELECT status, checkpoint, FALSE
+		FROM TxExecutor
+		WHERE exec_id = $1
+		UNION ALL
+		SELECT status, checkpoint, TRUE
+		FROM TxExecutorArchive
+		WHERE exec_id = $1
+		LIMIT 1;
+	`
+
+	var status ExecStatus
+	var b []byte
+	var archived bool
+	var execCtx TxExecutorContext
+	row := conn.QueryRow(context.Background(), query, execID)
+	if err := row.Scan(&status, &b, &archived); err != nil {
+		return status, nil, archived, err
+	}
+	if err := json.Unmarshal(b, &execCtx); err != nil {
+		return status, nil, archived, err
+	}
+	// the first checkpoint is written before the id is assigned
+	execCtx.ExecID = execID
+	return status, &execCtx, archived, nil
+}
+
 func GetAllTxExecutorCheckpoint(conn *pgxpool.Pool, status ExecStatus) ([]*TxExecutorContext, error) {
 	query := `
 		SELECT checkpoint
@@ -84,47 +126,270 @@ func GetAllTxExecutorCheckpoint(conn *pgxpool.Pool, status ExecStatus) ([]*TxExe
 	return result, nil
 }
 
-func InsertCheckpointExecutorContext(conn *pgxpool.Pool, execCtx *TxExecutorContext) error {
+// GetUnfinishedTxExecutorCheckpoints returns the next page of executors that
+// are neither aborted nor completed, ordered by id and starting after execID.
+func GetUnfinishedTxExecutorCheckpoints(conn *pgxpool.Pool, execID uint64, limit int) ([]*TxExecutorContext, error) {
+	query := `
+		SELECT exec_id, checkpoint
+		FROM TxExecutor
+		WHERE status <> ALL(@finished) AND exec_id > @exec_id
+		ORDER BY exec_id
+		LIMIT @limit;
+	`
+	args := pgx.NamedArgs{
+		"finished": []int64{int64(ExecStatusAborted), int64(ExecStatusCompleted)},
+		"exec_id":  execID,
+		"limit":    limit,
+	}
+
+	var result []*TxExecutorContext
+	ctx := context.Background()
+	rows, err := conn.Query(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var b []byte
+		var execID uint64
+		var execCtx TxExecutorContext
+
+		if err := rows.Scan(&execID, &b); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &execCtx); err != nil {
+			return nil, err
+		}
+		// the first checkpoint is written before the id is assigned
+		execCtx.ExecID = execID
+
+		result = append(result, &execCtx)
+	}
+
+	return result, rows.Err()
+}
+
+// GetTxExecutorByTimestamp returns the executor that sends the hop at
+// timestamp to the receiver, or pgx.ErrNoRows once it was compacted.
+func GetTxExecutorByTimestamp(
+	conn *pgxpool.Pool,
+	partition uint64,
+	receiver string,
+	timestamp uint64,
+) (ExecStatus, *TxExecutorContext, error) {
+	query := `
+		SELECT e.exec_id, e.status, e.checkpoint
+		FROM TxExecutorHop h
+		JOIN TxExecutor e ON e.exec_id = h.exec_id
+		WHERE h.svc = @receiver AND h.prt = @partition AND h.ts = @timestamp
+		ORDER BY e.exec_id DESC
+		LIMIT 1;
+	`
+	args := pgx.NamedArgs{
+		"partition": partition,
+		"receiver":  receiver,
+		"timestamp": timestamp,
+	}
+
+	var execID uint64
+	var status ExecStatus
+	var b []byte
+	var execCtx TxExecutorContext
+	row := conn.QueryRow(context.Background(), query, args)
+	if err := row.Scan(&execID, &status, &b); err != nil {
+		return status, nil, err
+	}
+	if err := json.Unmarshal(b, &execCtx); err != nil {
+		return status, nil, err
+	}
+	execCtx.ExecID = execID
+	return status, &execCtx, nil
+}
+
+// GetUnfinishedTimestamps returns, per partition, the lowest timestamp that an
+// unfinished executor sends to the receiver.
+func GetUnfinishedTimestamps(
+	ctx context.Context,
+	conn *pgxpool.Pool,
+	receiver string,
+	partitions []uint64,
+) (map[uint64]uint64, error) {
+	query := `
+		SELECT h.prt, MIN(h.ts)
+		FROM TxExecutorHop h
+		JOIN TxExecutor e ON e.exec_id = h.exec_id
+		WHERE h.svc = @receiver
+			AND h.prt = ANY(@partitions)
+			AND e.status <> ALL(@finished)
+		GROUP BY h.prt;
+	`
+	args := pgx.NamedArgs{
+		"receiver":   receiver,
+		"partitions": partitions,
+		"finished":   []int64{int64(ExecStatusAborted), int64(ExecStatusCompleted)},
+	}
+
+	rows, err := conn.Query(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lowest := map[uint64]uint64{}
+	for rows.Next() {
+		var partition, timestamp uint64
+		if err = rows.Scan(&partition, &timestamp); err != nil {
+			return nil, err
+		}
+		lowest[partition] = timestamp
+	}
+	return lowest, rows.Err()
+}
+
+// InsertCheckpointExecutorContext assigns the id of a new executor and records
+// the timestamps of its hops. It fails with ErrTxExecutorDuplicate if the
+// coordinator already started a chain with the same idempotency key.
+func InsertCheckpointExecutorContext(conn TxQueryRower, execCtx *TxExecutorContext) error {
 	b, err := json.Marshal(execCtx)
 	if err != nil {
 		return err
 	}
 
 	query := `
-		INSERT INTO TxExecutor (status, checkpoint)
-		VALUES ($1, $2)
-		RETURNING exec_id;
+		WITH executor AS (
+			INSERT INTO TxExecutor (status, checkpoint, svc, idem_key)
+			VALUES (@status, @checkpoint, @service, @key)
+			ON CONFLICT (svc, idem_key) WHERE idem_key IS NOT NULL
+			DO NOTHING
+			RETURNING exec_id
+		), hops AS (
+			INSERT INTO TxExecutorHop (exec_id, prt, svc, ts)
+			SELECT e.exec_id, @partition, h.svc, h.ts
+			FROM executor e,
+				unnest(@receivers::TEXT[], @timestamps::BIGINT[]) AS h(svc, ts)
+			WHERE h.svc IS NOT NULL AND h.ts IS NOT NULL
+		)
+		SELECT exec_id FROM executor;
 	`
+	args := pgx.NamedArgs{
+		"status":     execCtx.Status,
+		"checkpoint": b,
+		"service":    "",
+		"key":        nil,
+		"partition":  uint64(0),
+		"receivers":  execCtx.Receivers,
+		"timestamps": execCtx.Timestamps,
+	}
+	if ctrlCtx := execCtx.CtrlCtx; ctrlCtx != nil {
+		args["service"] = ctrlCtx.Service
+		args["partition"] = ctrlCtx.Partition
+		if ctrlCtx.IdempotencyKey != "" {
+			args["key"] = ctrlCtx.IdempotencyKey
+		}
+	}
 
 	ctx := context.Background()
-	row := conn.QueryRow(ctx, query, execCtx.Status, b)
+	row := conn.QueryRow(ctx, query, args)
 	err = row.Scan(&execCtx.ExecID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrTxExecutorDuplicate
+	}
 	return err
 }
 
+// GetTxExecutorByIdempotencyKey returns the executor a client started with
+// key, including archived ones.
+func GetTxExecutorByIdempotencyKey(
+	conn *pgxpool.Pool,
+	service string,
+	key string,
+) (ExecStatus, *TxExecutorContext, bool, error) {
+	query := `
+		SELECT exec_id, status, checkpoint, FALSE
+		FROM TxExecutor
+		WHERE svc = @service AND idem_key = @key
+		UNION ALL
+		SELECT exec_id, status, checkpoint, TRUE
+		FROM TxExecutorArchive
+		WHERE svc = @service AND idem_key = @key
+		LIMIT 1;
+	`
+	args := pgx.NamedArgs{
+		"service": service,
+		"key":     key,
+	}
+
+	var execID uint64
+	var status ExecStatus
+	var b []byte
+	var archived bool
+	var execCtx TxExecutorContext
+	row := conn.QueryRow(context.Background(), query, args)
+	if err := row.Scan(&execID, &status, &b, &archived); err != nil {
+		return status, nil, archived, err
+	}
+	if err := json.Unmarshal(b, &execCtx); err != nil {
+		return status, nil, archived, err
+	}
+	execCtx.ExecID = execID
+	return status, &execCtx, archived, nil
+}
+
+// the terminal checkpoint of a chain with a webhook also queues its status in
+// the outbox, so the notification is neither lost nor holds up the executor
+const updateCheckpointQuery = `
+	WITH updated AS (
+		UPDATE TxExecutor
+		SET
+			status = $2,
+			checkpoint = $3,
+			updated_at = NOW()
+		WHERE exec_id = $1
+		RETURNING exec_id
+	)
+	INSERT INTO TxWebhookOutbox (exec_id, webhook, content)
+	SELECT exec_id, $4::TEXT, $5::JSONB
+	FROM updated
+	WHERE $4::TEXT <> ''
+	ON CONFLICT (exec_id) DO NOTHING;
+`
+
+// checkpointArgs returns the arguments of updateCheckpointQuery. The webhook
+// is only set once the chain completed or aborted.
+func checkpointArgs(execCtx *TxExecutorContext) ([]any, error) {
+	checkpoint, err := json.Marshal(execCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	var webhook string
+	var notification []byte
+	status := execCtx.Status
+	if execCtx.CtrlCtx.Webhook != "" && (status == ExecStatusCompleted || status == ExecStatusAborted) {
+		webhook = execCtx.CtrlCtx.Webhook
+		notification, err = json.Marshal(NewTxExecutorStatus(status, execCtx))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return []any{execCtx.ExecID, status, checkpoint, webhook, notification}, nil
+}
+
 func UpdateCheckpointExecutorContext(conn *pgxpool.Pool, execCtx *TxExecutorContext) error {
-	b, err := json.Marshal(execCtx)
+	args, err := checkpointArgs(execCtx)
 	if err != nil {
 		return err
 	}
 
-	query := `
-		UPDATE TxExecutor 
-		SET
-			status = $2, 
-			checkpoint = $3
-		WHERE exec_id = $1;
-	`
-
 	ctx := context.Background()
-	execID := execCtx.ExecID
-	_, err = conn.Exec(ctx, query, execID, execCtx.Status, b)
+	_, err = conn.Exec(ctx, updateCheckpointQuery, args...)
 	return err
 }
 
 func DeleteAllExecutorCheckpoints(conn *pgxpool.Pool) error {
 	query := `
-		TRUNCATE TABLE TxExecutor;
+		TRUNCATE TABLE TxExecutor, TxExecutorHop, TxWebhookOutbox;
 	`
 
 	ctx := context.Background()
@@ -135,6 +400,15 @@ func DeleteAllExecutorCheckpoints(conn *pgxpool.Pool) error {
 var _ database.TxHookFunc = TxDedupBeforeHook
 var _ database.TxHookFunc = TxDedupAfterHook
 
+// DedupTxHooks are passed to the store tables, so every mutating store api
+// replays the recorded result of a hop instead of executing it twice.
+func DedupTxHooks() database.TxHooks {
+	return database.TxHooks{
+		Before: TxDedupBeforeHook,
+		After:  TxDedupAfterHook,
+	}
+}
+
 func TxDedupBeforeHook(ctx context.Context, tx pgx.Tx) error {
 	stageCtx, ok := GetTxStageCtx(ctx)
 	// tx not enabled
@@ -148,10 +422,10 @@ func TxDedupBeforeHook(ctx context.Context, tx pgx.Tx) error {
 	query := `
 		SELECT content
 		FROM TxResult
-		WHERE prt = $1 AND svc = $2 AND ts = $3;
+		WHERE prt = $1 AND svc = $2 AND ts = $3 AND rollback = $4;
 	`
 
-	row := tx.QueryRow(ctx, query, stageCtx.Partition, stageCtx.Service, stageCtx.Timestamp)
+	row := tx.QueryRow(ctx, query, stageCtx.Partition, stageCtx.Service, stageCtx.Timestamp, stageCtx.Rollback)
 	err = row.Scan(&b)
 	// no previous tx result
 	if err != nil && errors.Is(err, pgx.ErrNoRows) {
@@ -162,8 +436,7 @@ func TxDedupBeforeHook(ctx context.Context, tx pgx.Tx) error {
 		return nil
 	}
 
-	var txResult any
-	if err = json.Unmarshal(b, &txResult); err != nil {
+	if err != nil {
 		return err
 	}
 
@@ -172,8 +445,9 @@ func TxDedupBeforeHook(ctx context.Context, tx pgx.Tx) error {
 		return format.ErrNoTraceCtx
 	}
 
-	// tx had already executed -> return previous result
-	database.SetResult(traceCtx, txResult)
+	// tx had already executed -> return previous result, decoded into the
+	// handler's type by database.UnwrapResult
+	database.SetResult(traceCtx, json.RawMessage(b))
 	return database.ErrTxAlreadyExecuted
 }
 
@@ -199,10 +473,100 @@ func TxDedupAfterHook(ctx context.Context, tx pgx.Tx) error {
 		return err
 	}
 	query := `
-		INSERT INTO TxResult (prt, svc, ts, content)
-		VALUES ($1, $2, $3, $4);
+		INSERT INTO TxResult (prt, svc, ts, rollback, content)
+		VALUES ($1, $2, $3, $4, $5);
+	`
+
+	_, err = tx.Exec(ctx, query, stageCtx.Partition, stageCtx.Service, stageCtx.Timestamp, stageCtx.Rollback, b)
+	if err != nil {
+		return err
+	}
+
+	// the receiver clock must advance in the same tx as the hop's effects;
+	// unordered hops may arrive above the clock and are recorded as done instead
+	if stageCtx.Level.Ordered() {
+		err = UpsertReceiverClock(ctx, tx, stageCtx.Partition, stageCtx.Service, stageCtx.Timestamp)
+	} else {
+		err = InsertReceiverDone(ctx, tx, stageCtx.Partition, stageCtx.Service, stageCtx.Timestamp)
+	}
+	if err != nil {
+		return err
+	}
+
+	SetReceiverClockPersisted(traceCtx)
+	return nil
+}
+
+// Receiver clocks never move backwards, so replaying an older hop is a no-op.
+func UpsertReceiverClock(
+	ctx context.Context,
+	conn TxExecer,
+	partition uint64,
+	service string,
+	timestamp uint64,
+) error {
+	query := `
+		INSERT INTO TxReceiverClocks (prt, svc, ts)
+		VALUES (@partition, @service, @timestamp)
+		ON CONFLICT (prt, svc)
+		DO UPDATE SET
+			ts = GREATEST(TxReceiverClocks.ts, EXCLUDED.ts);
+	`
+	args := pgx.NamedArgs{
+		"partition": partition,
+		"service":   service,
+		"timestamp": timestamp,
+	}
+
+	_, err := conn.Exec(ctx, query, args)
+	return err
+}
+
+// Sender clocks are only flushed upwards, an allocation persisted by a
+// concurrent coordinator is never overwritten.
+func UpsertSenderClock(
+	ctx context.Context,
+	conn TxExecer,
+	partition uint64,
+	service string,
+	timestamp uint64,
+) error {
+	query := `
+		INSERT INTO TxSenderClocks (prt, svc, ts)
+		VALUES (@partition, @service, @timestamp)
+		ON CONFLICT (prt, svc)
+		DO UPDATE SET
+			ts = GREATEST(TxSenderClocks.ts, EXCLUDED.ts);
 	`
+	args := pgx.NamedArgs{
+		"partition": partition,
+		"service":   service,
+		"timestamp": timestamp,
+	}
+
+	_, err := conn.Exec(ctx, query, args)
+	return err
+}
+
+func InsertReceiverDone(
+	ctx context.Context,
+	conn TxExecer,
+	partition uint64,
+	service string,
+	timestamp uint64,
+) error {
+	query := `
+		INSERT INTO TxReceiverDone (prt, svc, ts)
+		VALUES (@partition, @service, @timestamp)
+		ON CONFLICT (svc, prt, ts)
+		DO NOTHING;
+	`
+	args := pgx.NamedArgs{
+		"partition": partition,
+		"service":   service,
+		"timestamp": timestamp,
+	}
 
-	_, err = tx.Exec(ctx, query, stageCtx.Partition, stageCtx.Service, stageCtx.Timestamp, b)
+	_, err := conn.Exec(ctx, query, args)
 	return err
 }
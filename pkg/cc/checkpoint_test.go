@@ -3,6 +3,7 @@ package cc
 import (
 	"context"
 	"testing"
+	"time"
 	"txchain/pkg/database"
 	"txchain/pkg/format"
 
@@ -154,4 +155,133 @@ func TestTxDedupHooks(t *testing.T) {
 	require.EqualValues(t, Input{100}, structResult)
 	require.Equal(t, 6, beforeCount)
 	require.Equal(t, 3, afterCount)
+
+	// receiver clocks are written along with the tx results
+	for _, stageCtx := range []*TxStageContext{stringStageCtx, nilStageCtx, structStageCtx} {
+		var ts uint64
+		query := `
+			SELECT ts
+			FROM TxReceiverClocks
+			WHERE prt = $1 AND svc = $2;
+		`
+		row := conn.QueryRow(ctx, query, stageCtx.Partition, stageCtx.Service)
+		err = row.Scan(&ts)
+		require.NoError(t, err)
+		require.Equal(t, stageCtx.Timestamp, ts)
+	}
+}
+
+func testStoreConn(
+	t *testing.T,
+	newContainer func(t *testing.T, version string) (*database.PgContainer, error),
+) *pgxpool.Pool {
+	pgc, err := newContainer(t, "17.1")
+	t.Cleanup(func() {
+		if pgc != nil {
+			testcontainers.CleanupContainer(t, pgc.Container)
+		}
+	})
+	require.NoError(t, err)
+
+	conn, err := pgxpool.New(context.Background(), pgc.Endpoint())
+	require.NoError(t, err)
+	t.Cleanup(conn.Close)
+	return conn
+}
+
+func testCountRows(t *testing.T, conn *pgxpool.Pool, table string) int {
+	var count int
+	err := conn.QueryRow(context.Background(), "SELECT COUNT(*) FROM "+table+";").Scan(&count)
+	require.NoError(t, err)
+	return count
+}
+
+// testReplayStage runs the same stage twice. The replay must not execute the
+// store api again and hands back the result recorded by the first run.
+func testReplayStage[R any](
+	t *testing.T,
+	stageCtx *TxStageContext,
+	stage func(ctx context.Context) (R, error),
+) R {
+	ctx := SetTxStageCtx(format.InsertTraceContext(context.Background()), stageCtx)
+	result, err := stage(ctx)
+	require.NoError(t, err)
+
+	ctx = SetTxStageCtx(format.InsertTraceContext(context.Background()), stageCtx)
+	_, err = stage(ctx)
+	require.ErrorIs(t, err, database.ErrTxAlreadyExecuted)
+
+	traceCtx, ok := format.GetTraceContext(ctx)
+	require.True(t, ok)
+	recorded, ok := database.UnmarshalResult[R](traceCtx)
+	require.True(t, ok)
+	require.Equal(t, result, recorded)
+	return result
+}
+
+func TestTxDedupStoreTables(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("users", func(t *testing.T) {
+		conn := testStoreConn(t, database.NewContainerTableUsers)
+		table := database.NewTableUser(conn, DedupTxHooks())
+
+		stageCtx := &TxStageContext{Partition: 1, Service: "service-user", Timestamp: 1}
+		userID := testReplayStage(t, stageCtx, func(ctx context.Context) (int64, error) {
+			return table.CreateUser(ctx, "alice", []int64{})
+		})
+		require.Equal(t, 1, testCountRows(t, conn, "Users"))
+
+		stageCtx = &TxStageContext{Partition: 1, Service: "service-user", Timestamp: 2}
+		testReplayStage(t, stageCtx, func(ctx context.Context) (any, error) {
+			return table.UpdateName(ctx, userID, "bob")
+		})
+		name, err := table.GetName(ctx, userID)
+		require.NoError(t, err)
+		require.Equal(t, "bob", name)
+
+		// stores without a stage context are not deduplicated
+		_, err = table.CreateUser(format.InsertTraceContext(ctx), "carol", []int64{})
+		require.NoError(t, err)
+		require.Equal(t, 2, testCountRows(t, conn, "Users"))
+		require.Equal(t, 2, testCountRows(t, conn, "TxResult"))
+	})
+
+	t.Run("events", func(t *testing.T) {
+		conn := testStoreConn(t, database.NewContainerTableEvents)
+		table := database.NewTableEvent(conn, DedupTxHooks())
+
+		event := &database.Event{
+			Name:         "meeting",
+			HostID:       1,
+			StartAt:      time.Now().Add(time.Hour).UTC().Truncate(time.Second),
+			EndAt:        time.Now().Add(2 * time.Hour).UTC().Truncate(time.Second),
+			Participants: []int64{},
+		}
+		stageCtx := &TxStageContext{Partition: 2, Service: "service-event", Timestamp: 1}
+		eventID := testReplayStage(t, stageCtx, func(ctx context.Context) (int64, error) {
+			return table.CreateEvent(ctx, event)
+		})
+		require.Equal(t, 1, testCountRows(t, conn, "Events"))
+
+		stageCtx = &TxStageContext{Partition: 2, Service: "service-event", Timestamp: 2}
+		testReplayStage(t, stageCtx, func(ctx context.Context) (any, error) {
+			return table.DeleteEvent(ctx, eventID)
+		})
+		require.Equal(t, 0, testCountRows(t, conn, "Events"))
+		require.Equal(t, 2, testCountRows(t, conn, "TxResult"))
+	})
+
+	t.Run("event logs", func(t *testing.T) {
+		conn := testStoreConn(t, database.NewContainerTableEventLogs)
+		table := database.NewTableEventLog(conn, DedupTxHooks())
+
+		event := &database.Event{ID: 1, Name: "meeting", HostID: 1, Participants: []int64{}}
+		stageCtx := &TxStageContext{Partition: 3, Service: "service-event-log", Timestamp: 1}
+		testReplayStage(t, stageCtx, func(ctx context.Context) (int64, error) {
+			return table.CreateEventLog(ctx, event.ID, event.HostID, database.EventCreate, event)
+		})
+		require.Equal(t, 1, testCountRows(t, conn, "EventLogs"))
+		require.Equal(t, 1, testCountRows(t, conn, "TxResult"))
+	})
 }
@@ -1,7 +1,13 @@
 package cc
 
+import "sync"
+
+// TxClockManager is safe for concurrent use. Every partition has its own
+// lock, which is a leaf: it is never held while calling out, so it may be
+// taken under a partition lock of TxPartitionManager.
 type TxClockManager struct {
 	partitions uint64
+	locks      []sync.RWMutex
 	clocks     []map[string]uint64
 }
 
@@ -13,24 +19,53 @@ func NewTxClockManager(partitions uint64) *TxClockManager {
 	}
 	return &TxClockManager{
 		partitions: GenPartitions(partitions),
+		locks:      make([]sync.RWMutex, partitions),
 		clocks:     clocks,
 	}
 }
 
 func (mgr *TxClockManager) InitService(service string) {
 	for partition := range mgr.partitions {
+		mgr.locks[partition].Lock()
 		mgr.clocks[partition][service] = 0
+		mgr.locks[partition].Unlock()
 	}
 }
 
 func (mgr *TxClockManager) Get(partition uint64, service string) uint64 {
+	mgr.locks[partition].RLock()
+	defer mgr.locks[partition].RUnlock()
 	return mgr.clocks[partition][service]
 }
 
 func (mgr *TxClockManager) Set(partition uint64, service string, timestamp uint64) {
+	mgr.locks[partition].Lock()
+	defer mgr.locks[partition].Unlock()
 	mgr.clocks[partition][service] = timestamp
 }
 
 func (mgr *TxClockManager) Inc(partition uint64, service string) {
+	mgr.locks[partition].Lock()
+	defer mgr.locks[partition].Unlock()
 	mgr.clocks[partition][service]++
 }
+
+// Range calls f for a snapshot of every clock until f returns an error. f runs
+// without holding a lock and may block.
+func (mgr *TxClockManager) Range(f func(partition uint64, service string, timestamp uint64) error) error {
+	for partition := range mgr.partitions {
+		mgr.locks[partition].RLock()
+		clocks := make(map[string]uint64, len(mgr.clocks[partition]))
+		for service, timestamp := range mgr.clocks[partition] {
+			clocks[service] = timestamp
+		}
+		mgr.locks[partition].RUnlock()
+
+		for service, timestamp := range clocks {
+			if err := f(partition, service, timestamp); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
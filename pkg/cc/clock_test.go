@@ -1,6 +1,7 @@
 package cc
 
 import (
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -39,3 +40,56 @@ func TestTxClockManager(t *testing.T) {
 		}
 	}
 }
+
+func TestTxClockManagerConcurrency(t *testing.T) {
+	partitions := uint64(4)
+	clockMgr := NewTxClockManager(partitions)
+	services := []string{"service-a", "service-b"}
+	for _, service := range services {
+		clockMgr.InitService(service)
+	}
+
+	incs := 1000
+	var wg sync.WaitGroup
+	for partition := range partitions {
+		for _, service := range services {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				for range incs {
+					clockMgr.Inc(partition, service)
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				for range incs {
+					_ = clockMgr.Get(partition, service)
+				}
+			}()
+		}
+	}
+	// a new service and flushes race with the increments
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		clockMgr.InitService("service-c")
+		for partition := range partitions {
+			clockMgr.Set(partition, "service-c", 7)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range 100 {
+			require.NoError(t, clockMgr.Range(func(partition uint64, service string, timestamp uint64) error {
+				return nil
+			}))
+		}
+	}()
+	wg.Wait()
+
+	for partition := range partitions {
+		for _, service := range services {
+			require.Equal(t, uint64(incs), clockMgr.Get(partition, service))
+		}
+	}
+}
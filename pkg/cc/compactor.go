@@ -0,0 +1,384 @@
+package cc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrTxCompact         = errors.New("failed to compact tx results")
+	ErrTxCompactExec     = errors.New("failed to compact tx executors")
+	ErrTxCompactHops     = errors.New("failed to compact tx executor hops")
+	ErrTxCompactShutdown = errors.New("tx result compactor did not stop in time")
+	ErrTxWatermark       = errors.New("failed to query tx sender watermark")
+	ErrTxWatermarkPrt    = errors.New("invalid tx watermark partition")
+)
+
+const (
+	PathTxSenderWatermarks = "/api/v1/tx/cc/watermarks"
+)
+
+const (
+	DefaultCompactInterval   = time.Minute
+	DefaultResultRetention   = 10 * time.Minute
+	DefaultExecutorRetention = 24 * time.Hour
+	DefaultCompactBatchSize  = 1000
+)
+
+type TxResultCompactorOption struct {
+	// time between two compactions
+	Interval time.Duration
+	// minimum age of a result before it is compacted, it must cover the
+	// retries of the senders
+	Retention time.Duration
+	// minimum time since a finished executor was last checkpointed
+	ExecutorRetention time.Duration
+	// rows deleted per statement
+	BatchSize int
+	// move rows to TxResultArchive and TxExecutorArchive instead of deleting them
+	Archive bool
+}
+
+// TxWatermark is the highest timestamp of a (partition, service) pair whose
+// hops can never be delivered again.
+type TxWatermark struct {
+	Partition uint64
+	Service   string
+	Timestamp uint64
+}
+
+type TxWatermarkQuery struct {
+	Receiver   string   `json:"receiver"`
+	Partitions []uint64 `json:"partitions"`
+}
+
+// TxSenderWatermark is the timestamp up to which the sender finished every
+// hop to the receiver: the executors of those hops completed or aborted, so
+// they are never sent again.
+type TxSenderWatermark struct {
+	Partition uint64 `json:"partition"`
+	Timestamp uint64 `json:"timestamp"`
+}
+
+// TxWatermarkResolver asks a sender for its watermarks.
+type TxWatermarkResolver interface {
+	Watermarks(ctx context.Context, sender string, query TxWatermarkQuery) ([]TxSenderWatermark, error)
+}
+
+// TxResultCompactor removes the dedup results of hops below the watermarks.
+// A result is needed as long as its sender may resend the hop, so results are
+// only removed up to the watermark the sender confirmed, capped by the
+// receiver clock, and once the retention window passed. Without a resolver
+// for the senders no results are removed.
+// Aborted and completed executors are compacted once their retention passed.
+type TxResultCompactor struct {
+	conn          *pgxpool.Pool
+	receiver      string
+	resolver      TxWatermarkResolver
+	interval      time.Duration
+	retention     time.Duration
+	execRetention time.Duration
+	batchSize     int
+	archive       bool
+	lifecycle
+}
+
+func NewTxResultCompactor(conn *pgxpool.Pool, options ...TxResultCompactorOption) *TxResultCompactor {
+	var option TxResultCompactorOption
+	if len(options) > 0 {
+		option = options[0]
+	}
+	if option.Interval <= 0 {
+		option.Interval = DefaultCompactInterval
+	}
+	if option.Retention <= 0 {
+		option.Retention = DefaultResultRetention
+	}
+	if option.ExecutorRetention <= 0 {
+		option.ExecutorRetention = DefaultExecutorRetention
+	}
+	if option.BatchSize <= 0 {
+		option.BatchSize = DefaultCompactBatchSize
+	}
+
+	return &TxResultCompactor{
+		conn:          conn,
+		interval:      option.Interval,
+		retention:     option.Retention,
+		execRetention: option.ExecutorRetention,
+		batchSize:     option.BatchSize,
+		archive:       option.Archive,
+		lifecycle:     newLifecycle(),
+	}
+}
+
+// Senders sets the name of this service and the resolver that asks the
+// senders of its hops for their watermarks.
+func (c *TxResultCompactor) Senders(receiver string, resolver TxWatermarkResolver) *TxResultCompactor {
+	c.receiver = receiver
+	c.resolver = resolver
+	return c
+}
+
+// Start runs the compactor in a new goroutine.
+func (c *TxResultCompactor) Start() {
+	c.goLoop(c.run)
+}
+
+// Run compacts periodically until Shutdown is called.
+func (c *TxResultCompactor) Run() {
+	c.runLoop(c.run)
+}
+
+func (c *TxResultCompactor) run() {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), c.interval)
+			if _, err := c.Compact(ctx); err != nil {
+				log.Println("compact tx results:", err)
+			}
+			if _, err := c.CompactExecutors(ctx); err != nil {
+				log.Println("compact tx executors:", err)
+			}
+			if _, err := c.CompactHops(ctx); err != nil {
+				log.Println("compact tx executor hops:", err)
+			}
+			cancel()
+		}
+	}
+}
+
+func (c *TxResultCompactor) Shutdown(ctx context.Context) error {
+	return c.shutdown(ctx, ErrTxCompactShutdown, nil)
+}
+
+// Watermarks caps every receiver clock at the watermark its sender confirmed.
+// The pairs of senders that did not answer are left out and reported in the
+// error.
+func (c *TxResultCompactor) Watermarks(ctx context.Context) ([]TxWatermark, error) {
+	if c.resolver == nil {
+		return nil, nil
+	}
+
+	query := `
+		SELECT prt, svc, ts
+		FROM TxReceiverClocks;
+	`
+	rows, err := c.conn.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var clocks []TxWatermark
+	for rows.Next() {
+		var clock TxWatermark
+		if err = rows.Scan(&clock.Partition, &clock.Service, &clock.Timestamp); err != nil {
+			return nil, err
+		}
+		clocks = append(clocks, clock)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return ConfirmWatermarks(ctx, c.resolver, c.receiver, clocks)
+}
+
+// ConfirmWatermarks asks the sender of every receiver clock for its watermark
+// and caps the clock at it.
+func ConfirmWatermarks(
+	ctx context.Context,
+	resolver TxWatermarkResolver,
+	receiver string,
+	clocks []TxWatermark,
+) ([]TxWatermark, error) {
+	partitions := map[string][]uint64{}
+	for _, clock := range clocks {
+		partitions[clock.Service] = append(partitions[clock.Service], clock.Partition)
+	}
+
+	var errs error
+	confirmed := map[string]map[uint64]uint64{}
+	for sender, prts := range partitions {
+		query := TxWatermarkQuery{
+			Receiver:   receiver,
+			Partitions: prts,
+		}
+		senderWatermarks, err := resolver.Watermarks(ctx, sender, query)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("%w: %s: %v", ErrTxWatermark, sender, err))
+			continue
+		}
+		confirmed[sender] = map[uint64]uint64{}
+		for _, watermark := range senderWatermarks {
+			confirmed[sender][watermark.Partition] = watermark.Timestamp
+		}
+	}
+
+	var watermarks []TxWatermark
+	for _, clock := range clocks {
+		timestamp, ok := confirmed[clock.Service][clock.Partition]
+		if !ok {
+			continue
+		}
+		clock.Timestamp = min(clock.Timestamp, timestamp)
+		watermarks = append(watermarks, clock)
+	}
+	return watermarks, errs
+}
+
+// Compact runs one compaction and returns the number of removed results.
+// Done rows of unordered hops that the receiver clock already covers are
+// dropped as well.
+func (c *TxResultCompactor) Compact(ctx context.Context) (int64, error) {
+	// the confirmed watermarks are compacted even if some senders failed
+	watermarks, watermarkErr := c.Watermarks(ctx)
+
+	cutoff := time.Now().Add(-c.retention)
+	var total int64
+	for _, watermark := range watermarks {
+		n, err := c.compactResults(ctx, watermark, cutoff)
+		total += n
+		if err != nil {
+			return total, fmt.Errorf("%w: %v", ErrTxCompact, err)
+		}
+	}
+
+	doneQuery := `
+		DELETE FROM TxReceiverDone d
+		USING TxReceiverClocks c
+		WHERE d.prt = c.prt AND d.svc = c.svc AND d.ts <= c.ts;
+	`
+	if _, err := c.conn.Exec(ctx, doneQuery); err != nil {
+		return total, fmt.Errorf("%w: %v", ErrTxCompact, err)
+	}
+	if watermarkErr != nil {
+		return total, fmt.Errorf("%w: %v", ErrTxCompact, watermarkErr)
+	}
+	return total, nil
+}
+
+func (c *TxResultCompactor) compactResults(ctx context.Context, watermark TxWatermark, cutoff time.Time) (int64, error) {
+	deleteQuery := `
+		DELETE FROM TxResult
+		WHERE result_id IN (
+			SELECT result_id
+			FROM TxResult
+			WHERE prt = @partition AND svc = @service AND ts <= @timestamp AND created_at < @cutoff
+			LIMIT @limit
+		)
+	`
+	query := deleteQuery + ";"
+	if c.archive {
+		query = `
+			WITH moved AS (` + deleteQuery + `
+				RETURNING prt, svc, ts, rollback, content, created_at
+			)
+			INSERT INTO TxResultArchive (prt, svc, ts, rollback, content, created_at)
+			SELECT prt, svc, ts, rollback, content, created_at
+			FROM moved;
+		`
+	}
+	args := pgx.NamedArgs{
+		"partition": watermark.Partition,
+		"service":   watermark.Service,
+		"timestamp": watermark.Timestamp,
+		"cutoff":    cutoff,
+		"limit":     c.batchSize,
+	}
+
+	// small batches keep the row locks of concurrent hops short
+	return c.execBatches(ctx, query, args)
+}
+
+// CompactExecutors removes aborted and completed executors whose last
+// checkpoint is older than the executor retention and returns their number.
+func (c *TxResultCompactor) CompactExecutors(ctx context.Context) (int64, error) {
+	deleteQuery := `
+		DELETE FROM TxExecutor
+		WHERE exec_id IN (
+			SELECT exec_id
+			FROM TxExecutor
+			WHERE status = ANY(@statuses) AND updated_at < @cutoff
+			LIMIT @limit
+		)
+	`
+	query := deleteQuery + ";"
+	if c.archive {
+		query = `
+			WITH moved AS (` + deleteQuery + `
+				RETURNING exec_id, status, checkpoint, svc, idem_key, updated_at
+			)
+			INSERT INTO TxExecutorArchive (exec_id, status, checkpoint, svc, idem_key, updated_at)
+			SELECT exec_id, status, checkpoint, svc, idem_key, updated_at
+			FROM moved;
+		`
+	}
+	args := pgx.NamedArgs{
+		"statuses": []int64{int64(ExecStatusAborted), int64(ExecStatusCompleted)},
+		"cutoff":   time.Now().Add(-c.execRetention),
+		"limit":    c.batchSize,
+	}
+
+	n, err := c.execBatches(ctx, query, args)
+	if err != nil {
+		return n, fmt.Errorf("%w: %v", ErrTxCompactExec, err)
+	}
+	return n, nil
+}
+
+// CompactHops removes the hop timestamps of finished executors once their
+// block is closed, recovery only looks up the open blocks. It returns the
+// number of removed rows.
+func (c *TxResultCompactor) CompactHops(ctx context.Context) (int64, error) {
+	query := `
+		DELETE FROM TxExecutorHop
+		WHERE hop_id IN (
+			SELECT h.hop_id
+			FROM TxExecutorHop h
+			JOIN TxSenderClocks c ON c.svc = h.svc AND c.prt = h.prt
+			WHERE h.ts <= c.lo AND NOT EXISTS (
+				SELECT 1
+				FROM TxExecutor e
+				WHERE e.exec_id = h.exec_id AND e.status <> ALL(@finished)
+			)
+			LIMIT @limit
+		);
+	`
+	args := pgx.NamedArgs{
+		"finished": []int64{int64(ExecStatusAborted), int64(ExecStatusCompleted)},
+		"limit":    c.batchSize,
+	}
+
+	n, err := c.execBatches(ctx, query, args)
+	if err != nil {
+		return n, fmt.Errorf("%w: %v", ErrTxCompactHops, err)
+	}
+	return n, nil
+}
+
+func (c *TxResultCompactor) execBatches(ctx context.Context, query string, args pgx.NamedArgs) (int64, error) {
+	var total int64
+	for {
+		tag, err := c.conn.Exec(ctx, query, args)
+		if err != nil {
+			return total, err
+		}
+		total += tag.RowsAffected()
+		if tag.RowsAffected() < int64(c.batchSize) {
+			return total, nil
+		}
+	}
+}
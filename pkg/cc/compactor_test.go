@@ -0,0 +1,317 @@
+package cc
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+	"txchain/pkg/database"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func testInsertTxResult(t *testing.T, conn *pgxpool.Pool, partition uint64, service string, timestamp uint64, age time.Duration) {
+	query := `
+		INSERT INTO TxResult (prt, svc, ts, content, created_at)
+		VALUES ($1, $2, $3, '{"Value":null}', $4);
+	`
+	_, err := conn.Exec(context.Background(), query, partition, service, timestamp, time.Now().Add(-age))
+	require.NoError(t, err)
+}
+
+func testTxResultTimestamps(t *testing.T, conn *pgxpool.Pool, table string, partition uint64, service string) []uint64 {
+	query := `SELECT ts FROM ` + table + ` WHERE prt = $1 AND svc = $2 ORDER BY ts;`
+	rows, err := conn.Query(context.Background(), query, partition, service)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	timestamps := []uint64{}
+	for rows.Next() {
+		var ts uint64
+		require.NoError(t, rows.Scan(&ts))
+		timestamps = append(timestamps, ts)
+	}
+	require.NoError(t, rows.Err())
+	return timestamps
+}
+
+type testWatermarkResolver struct {
+	mu         sync.Mutex
+	watermarks map[string][]TxSenderWatermark
+	queries    []TxWatermarkQuery
+}
+
+func (resolver *testWatermarkResolver) Watermarks(ctx context.Context, sender string, query TxWatermarkQuery) ([]TxSenderWatermark, error) {
+	resolver.mu.Lock()
+	defer resolver.mu.Unlock()
+	resolver.queries = append(resolver.queries, query)
+	watermarks, ok := resolver.watermarks[sender]
+	if !ok {
+		return nil, ErrTxGapUnknownSender
+	}
+	return watermarks, nil
+}
+
+func TestConfirmWatermarks(t *testing.T) {
+	resolver := &testWatermarkResolver{
+		watermarks: map[string][]TxSenderWatermark{
+			"service-a": {{Partition: 1, Timestamp: 3}, {Partition: 2, Timestamp: 9}},
+		},
+	}
+	clocks := []TxWatermark{
+		{Partition: 1, Service: "service-a", Timestamp: 5},
+		{Partition: 2, Service: "service-a", Timestamp: 7},
+		// not confirmed by the sender
+		{Partition: 3, Service: "service-a", Timestamp: 7},
+		{Partition: 1, Service: "service-b", Timestamp: 4},
+	}
+
+	watermarks, err := ConfirmWatermarks(context.Background(), resolver, "service-c", clocks)
+	require.ErrorIs(t, err, ErrTxWatermark)
+	require.ErrorContains(t, err, "service-b")
+	require.Equal(t, []TxWatermark{
+		{Partition: 1, Service: "service-a", Timestamp: 3},
+		{Partition: 2, Service: "service-a", Timestamp: 7},
+	}, watermarks)
+
+	// one query per sender
+	require.ElementsMatch(t, []TxWatermarkQuery{
+		{Receiver: "service-c", Partitions: []uint64{1, 2, 3}},
+		{Receiver: "service-c", Partitions: []uint64{1}},
+	}, resolver.queries)
+}
+
+func TestTxManagerSenderWatermarks(t *testing.T) {
+	pgc, err := database.NewContainerTablesTx(t, "17.1")
+	defer func() {
+		if pgc != nil {
+			testcontainers.CleanupContainer(t, pgc.Container)
+		}
+	}()
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	conn, err := pgxpool.New(ctx, pgc.Endpoint())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	txMgr := NewTxManager(conn, 4, []string{"service-a", "service-b"})
+	txMgr.SenderClockMgr.Set(1, "service-b", 8)
+	txMgr.SenderClockMgr.Set(2, "service-b", 4)
+
+	insert := func(status ExecStatus, partition uint64, receivers []string, timestamps []uint64) *TxExecutorContext {
+		execCtx := &TxExecutorContext{
+			CtrlCtx:    &TxControlContext{Partition: partition, Service: "service-a"},
+			Receivers:  receivers,
+			Timestamps: timestamps,
+			Status:     status,
+		}
+		require.NoError(t, InsertCheckpointExecutorContext(conn, execCtx))
+		return execCtx
+	}
+	insert(ExecStatusCompleted, 1, []string{"service-b"}, []uint64{3})
+	pending := insert(ExecStatusCommitted, 1, []string{"service-c", "service-b"}, []uint64{2, 5})
+	insert(ExecStatusSkip, 1, []string{"service-b", "service-b"}, []uint64{6, 7})
+	insert(ExecStatusAborted, 2, []string{"service-b"}, []uint64{4})
+
+	query := TxWatermarkQuery{Receiver: "service-b", Partitions: []uint64{1, 2, 3}}
+	watermarks, err := txMgr.SenderWatermarks(ctx, query)
+	require.NoError(t, err)
+	require.Equal(t, []TxSenderWatermark{
+		// held back by the committed executor
+		{Partition: 1, Timestamp: 4},
+		{Partition: 2, Timestamp: 4},
+		{Partition: 3, Timestamp: 0},
+	}, watermarks)
+
+	pending.Status = ExecStatusCompleted
+	require.NoError(t, UpdateCheckpointExecutorContext(conn, pending))
+	watermarks, err = txMgr.SenderWatermarks(ctx, query)
+	require.NoError(t, err)
+	require.Equal(t, TxSenderWatermark{Partition: 1, Timestamp: 5}, watermarks[0])
+
+	_, err = txMgr.SenderWatermarks(ctx, TxWatermarkQuery{Receiver: "service-b", Partitions: []uint64{99}})
+	require.ErrorIs(t, err, ErrTxWatermarkPrt)
+}
+
+func TestTxResultCompactor(t *testing.T) {
+	pgc, err := database.NewContainerTablesTx(t, "17.1")
+	defer func() {
+		if pgc != nil {
+			testcontainers.CleanupContainer(t, pgc.Container)
+		}
+	}()
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	conn, err := pgxpool.New(ctx, pgc.Endpoint())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	const (
+		serviceA = "service-a"
+		serviceB = "service-b"
+	)
+	retention := time.Minute
+
+	// service-a delivered up to 5, the hop at 7 is ahead of the clock
+	for ts := uint64(1); ts <= 5; ts++ {
+		testInsertTxResult(t, conn, 3, serviceA, ts, time.Hour)
+	}
+	testInsertTxResult(t, conn, 3, serviceA, 7, time.Hour)
+	require.NoError(t, UpsertReceiverClock(ctx, conn, 3, serviceA, 5))
+
+	// service-b delivered up to 4, but 3 and 4 are young or reserved
+	testInsertTxResult(t, conn, 3, serviceB, 1, time.Hour)
+	testInsertTxResult(t, conn, 3, serviceB, 2, time.Hour)
+	testInsertTxResult(t, conn, 3, serviceB, 3, time.Hour)
+	testInsertTxResult(t, conn, 3, serviceB, 4, time.Second)
+	require.NoError(t, UpsertReceiverClock(ctx, conn, 3, serviceB, 4))
+	require.NoError(t, InsertReceiverDone(ctx, conn, 3, serviceB, 2))
+	require.NoError(t, InsertReceiverDone(ctx, conn, 3, serviceB, 6))
+
+	// results are kept without the watermarks of the senders
+	compactor := NewTxResultCompactor(conn, TxResultCompactorOption{Retention: retention})
+	n, err := compactor.Compact(ctx)
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	// service-a finished everything it sent, service-b is still sending 3
+	resolver := &testWatermarkResolver{
+		watermarks: map[string][]TxSenderWatermark{
+			serviceA: {{Partition: 3, Timestamp: 9}},
+			serviceB: {{Partition: 3, Timestamp: 2}},
+		},
+	}
+	compactor = NewTxResultCompactor(conn, TxResultCompactorOption{
+		Retention: retention,
+		BatchSize: 2,
+		Archive:   true,
+	}).Senders("service-c", resolver)
+
+	watermarks, err := compactor.Watermarks(ctx)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []TxWatermark{
+		{Partition: 3, Service: serviceA, Timestamp: 5},
+		{Partition: 3, Service: serviceB, Timestamp: 2},
+	}, watermarks)
+
+	n, err = compactor.Compact(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(7), n)
+
+	require.Equal(t, []uint64{7}, testTxResultTimestamps(t, conn, "TxResult", 3, serviceA))
+	require.Equal(t, []uint64{3, 4}, testTxResultTimestamps(t, conn, "TxResult", 3, serviceB))
+	require.Equal(t, []uint64{1, 2, 3, 4, 5}, testTxResultTimestamps(t, conn, "TxResultArchive", 3, serviceA))
+	require.Equal(t, []uint64{1, 2}, testTxResultTimestamps(t, conn, "TxResultArchive", 3, serviceB))
+	require.Equal(t, []uint64{6}, testTxResultTimestamps(t, conn, "TxReceiverDone", 3, serviceB))
+
+	// compaction is idempotent
+	n, err = compactor.Compact(ctx)
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	// once the sender finished the remaining old results are deleted, a
+	// sender that does not answer keeps its results
+	resolver.watermarks[serviceB] = []TxSenderWatermark{{Partition: 3, Timestamp: 9}}
+	delete(resolver.watermarks, serviceA)
+	testInsertTxResult(t, conn, 3, serviceA, 6, time.Hour)
+	require.NoError(t, UpsertReceiverClock(ctx, conn, 3, serviceA, 6))
+	compactor = NewTxResultCompactor(conn, TxResultCompactorOption{Retention: retention}).
+		Senders("service-c", resolver)
+	n, err = compactor.Compact(ctx)
+	require.ErrorIs(t, err, ErrTxCompact)
+	require.ErrorContains(t, err, serviceA)
+	require.Equal(t, int64(1), n)
+	require.Equal(t, []uint64{4}, testTxResultTimestamps(t, conn, "TxResult", 3, serviceB))
+	require.Equal(t, []uint64{1, 2}, testTxResultTimestamps(t, conn, "TxResultArchive", 3, serviceB))
+	require.Equal(t, []uint64{6, 7}, testTxResultTimestamps(t, conn, "TxResult", 3, serviceA))
+}
+
+func TestTxExecutorCompaction(t *testing.T) {
+	pgc, err := database.NewContainerTablesTx(t, "17.1")
+	defer func() {
+		if pgc != nil {
+			testcontainers.CleanupContainer(t, pgc.Container)
+		}
+	}()
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	conn, err := pgxpool.New(ctx, pgc.Endpoint())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	statuses := []ExecStatus{
+		ExecStatusPending,
+		ExecStatusCommitted,
+		ExecStatusAborted,
+		ExecStatusRollback,
+		ExecStatusForceComplete,
+		ExecStatusCompleted,
+		ExecStatusSkip,
+	}
+	execIDs := map[ExecStatus]uint64{}
+	for _, status := range statuses {
+		execCtx := defaultExecCtx()
+		execCtx.Status = status
+		require.NoError(t, InsertCheckpointExecutorContext(conn, execCtx))
+		execIDs[status] = execCtx.ExecID
+	}
+
+	// a finished executor within its retention is kept
+	young := defaultExecCtx()
+	young.Status = ExecStatusCompleted
+	require.NoError(t, InsertCheckpointExecutorContext(conn, young))
+
+	_, err = conn.Exec(ctx, `UPDATE TxExecutor SET updated_at = NOW() - INTERVAL '2 hours' WHERE exec_id <> $1;`, young.ExecID)
+	require.NoError(t, err)
+
+	compactor := NewTxResultCompactor(conn, TxResultCompactorOption{
+		ExecutorRetention: time.Hour,
+		BatchSize:         1,
+		Archive:           true,
+	})
+	n, err := compactor.CompactExecutors(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), n)
+
+	var archived []uint64
+	rows, err := conn.Query(ctx, `SELECT exec_id FROM TxExecutorArchive ORDER BY exec_id;`)
+	require.NoError(t, err)
+	for rows.Next() {
+		var execID uint64
+		require.NoError(t, rows.Scan(&execID))
+		archived = append(archived, execID)
+	}
+	rows.Close()
+	require.Equal(t, []uint64{execIDs[ExecStatusAborted], execIDs[ExecStatusCompleted]}, archived)
+
+	// recovery only pages through the unfinished executors
+	var recovered []ExecStatus
+	var after uint64
+	for {
+		execCtxs, err := GetUnfinishedTxExecutorCheckpoints(conn, after, 2)
+		require.NoError(t, err)
+		for _, execCtx := range execCtxs {
+			require.Equal(t, execIDs[execCtx.Status], execCtx.ExecID)
+			recovered = append(recovered, execCtx.Status)
+			after = execCtx.ExecID
+		}
+		if len(execCtxs) < 2 {
+			break
+		}
+	}
+	require.Equal(t, []ExecStatus{
+		ExecStatusPending,
+		ExecStatusCommitted,
+		ExecStatusRollback,
+		ExecStatusForceComplete,
+		ExecStatusSkip,
+	}, recovered)
+
+	_, _, err = GetTxExecutorCheckpoint(conn, young.ExecID)
+	require.NoError(t, err)
+}
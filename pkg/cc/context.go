@@ -5,6 +5,8 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"time"
+	"txchain/pkg/format"
 )
 
 var (
@@ -21,6 +23,23 @@ const (
 	contextKeyTxExecCtx
 )
 
+type traceKeyTx int
+
+const (
+	traceKeyRecvClockPersisted traceKeyTx = iota
+)
+
+// ReceiverClockPersisted reports whether the hop's receiver clock was already
+// written inside its lifecycle tx.
+func ReceiverClockPersisted(traceCtx *format.TraceContext) bool {
+	_, ok := traceCtx.Get(traceKeyRecvClockPersisted)
+	return ok
+}
+
+func SetReceiverClockPersisted(traceCtx *format.TraceContext) {
+	traceCtx.Set(traceKeyRecvClockPersisted, struct{}{})
+}
+
 func GetTxStageCtx(ctx context.Context) (*TxStageContext, bool) {
 	stageCtx, ok := ctx.Value(contextKeyTxStageCtx).(*TxStageContext)
 	return stageCtx, ok
@@ -48,12 +67,52 @@ func SetTxExecCtx(ctx context.Context, execCtx *TxExecutorContext) context.Conte
 	return context.WithValue(ctx, contextKeyTxExecCtx, execCtx)
 }
 
+type SerializationLevel string
+
+const (
+	// commutative or read-only hops are delivered as soon as they arrive
+	SerializationLevelNone SerializationLevel = "none"
+	// hops are delivered in timestamp order per (partition, sender)
+	SerializationLevelOriginOrdering SerializationLevel = "origin-ordering"
+)
+
+// Ordered reports whether hops must wait in the origin queue; an unset level
+// keeps the origin ordering.
+func (level SerializationLevel) Ordered() bool {
+	return level != SerializationLevelNone
+}
+
+// Stricter returns the level that orders more hops; an unset level is ignored.
+func (level SerializationLevel) Stricter(other SerializationLevel) SerializationLevel {
+	switch {
+	case other == "":
+		return level
+	case level == "" || other.Ordered():
+		return other
+	default:
+		return level
+	}
+}
+
+func (level SerializationLevel) Valid() bool {
+	switch level {
+	case "", SerializationLevelNone, SerializationLevelOriginOrdering:
+		return true
+	default:
+		return false
+	}
+}
+
 type TxStageContext struct {
-	Partition uint64   `json:"partition"`
-	Service   string   `json:"service"`
-	Timestamp uint64   `json:"timestamp"`
-	Attrs     []string `json:"attrs"`
-	DryRun    bool     `json:"dry_run"`
+	Partition uint64             `json:"partition"`
+	Service   string             `json:"service"`
+	Timestamp uint64             `json:"timestamp"`
+	Attrs     []string           `json:"attrs"`
+	DryRun    bool               `json:"dry_run"`
+	Level     SerializationLevel `json:"level"`
+	// a compensation reuses the timestamp of the hop it undoes, its result
+	// is recorded apart from the forward hop's
+	Rollback bool `json:"rollback"`
 }
 
 func DecodeTxStageContext(encoded string) (*TxStageContext, error) {
@@ -76,11 +135,21 @@ func (stageCtx *TxStageContext) Encode() string {
 }
 
 type TxControlContext struct {
-	Partition uint64   `json:"partition"`
-	Service   string   `json:"service"`
-	Attrs     []string `json:"attrs"`
-	DryRun    bool     `json:"dry_run"`
-	LoggerID  string   `json:"logger_id"`
+	Partition uint64             `json:"partition"`
+	Service   string             `json:"service"`
+	Attrs     []string           `json:"attrs"`
+	DryRun    bool               `json:"dry_run"`
+	LoggerID  string             `json:"logger_id"`
+	Level     SerializationLevel `json:"level"`
+	// answer 202 once the executor is checkpointed and run the chain in the
+	// background
+	Async bool `json:"async"`
+	// block until every hop finished or the wait passed
+	Wait time.Duration `json:"wait"`
+	// receives the terminal status of the chain
+	Webhook string `json:"webhook"`
+	// client key of the request, a retry returns the chain it started
+	IdempotencyKey string `json:"idempotency_key"`
 }
 
 func DecodeTxControlContext(encoded string) (*TxControlContext, error) {
@@ -111,6 +180,8 @@ const (
 	ExecStatusRollback
 	ExecStatusForceComplete
 	ExecStatusCompleted
+	// aborted after timestamps were allocated, delivering no-op hops
+	ExecStatusSkip
 )
 
 type TxExecutorContext struct {
@@ -120,11 +191,43 @@ type TxExecutorContext struct {
 	Timestamps []uint64
 	Input      any
 	Result     any
-	Status     ExecStatus
-	Curr       int
-	Method     string
-	Endpoint   string
-	Recovered  bool
+	// result of every hop that ran, Outputs[0] is Result
+	Outputs   []any
+	Status    ExecStatus
+	Curr      int
+	Method    string
+	Endpoint  string
+	Recovered bool
+	// the chain is force completed or rolled back once a deadline passed
+	Deadline time.Time
+	// deadline of the stage at Curr, set when the stage is first attempted
+	StageDeadline time.Time
+}
+
+// Expiry is the earlier of the chain and stage deadlines, zero if neither is
+// set. Only a chain that still runs its stages expires; compensations and
+// no-op hops run until they are done.
+func (execCtx *TxExecutorContext) Expiry() time.Time {
+	if execCtx.Status != ExecStatusPending && execCtx.Status != ExecStatusCommitted {
+		return time.Time{}
+	}
+	expiry := execCtx.Deadline
+	if expiry.IsZero() || (!execCtx.StageDeadline.IsZero() && execCtx.StageDeadline.Before(expiry)) {
+		expiry = execCtx.StageDeadline
+	}
+	return expiry
+}
+
+func (execCtx *TxExecutorContext) Expired(now time.Time) bool {
+	expiry := execCtx.Expiry()
+	return !expiry.IsZero() && !now.Before(expiry)
+}
+
+func (execCtx *TxExecutorContext) setOutput(hop int, output any) {
+	for len(execCtx.Outputs) <= hop {
+		execCtx.Outputs = append(execCtx.Outputs, nil)
+	}
+	execCtx.Outputs[hop] = output
 }
 
 func DecodeTxExecutorContext(encoded string) (*TxExecutorContext, error) {
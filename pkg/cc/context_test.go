@@ -3,6 +3,7 @@ package cc
 import (
 	"net/http"
 	"testing"
+	"time"
 	"txchain/pkg/format"
 
 	"github.com/stretchr/testify/require"
@@ -62,6 +63,9 @@ func TestExecutorContext(t *testing.T) {
 		Curr:       1,
 		Method:     http.MethodPost,
 		Endpoint:   "127.0.0.1:8080",
+		// deadlines survive recovery
+		Deadline:      time.Now().Add(time.Minute),
+		StageDeadline: time.Now().Add(time.Second),
 	}
 
 	encodedExecCtx := execCtx.Encode()
@@ -121,4 +125,38 @@ func checkTxExecCtx[A, B any](t *testing.T, expected, got *TxExecutorContext) {
 	require.Equal(t, expected.Curr, got.Curr)
 	require.Equal(t, expected.Method, got.Method)
 	require.Equal(t, expected.Endpoint, got.Endpoint)
+	require.True(t, expected.Deadline.Equal(got.Deadline))
+	require.True(t, expected.StageDeadline.Equal(got.StageDeadline))
+}
+
+func TestSerializationLevelStricter(t *testing.T) {
+	none := SerializationLevelNone
+	ordered := SerializationLevelOriginOrdering
+	require.Equal(t, ordered, none.Stricter(ordered))
+	require.Equal(t, ordered, ordered.Stricter(none))
+	require.Equal(t, none, none.Stricter(none))
+	require.Equal(t, none, none.Stricter(""))
+	require.Equal(t, ordered, SerializationLevel("").Stricter(ordered))
+}
+
+func TestExecutorContextExpiry(t *testing.T) {
+	now := time.Now()
+	execCtx := &TxExecutorContext{Status: ExecStatusCommitted}
+	require.True(t, execCtx.Expiry().IsZero())
+	require.False(t, execCtx.Expired(now))
+
+	execCtx.Deadline = now.Add(time.Minute)
+	require.Equal(t, execCtx.Deadline, execCtx.Expiry())
+	execCtx.StageDeadline = now.Add(time.Second)
+	require.Equal(t, execCtx.StageDeadline, execCtx.Expiry())
+	require.False(t, execCtx.Expired(now))
+	require.True(t, execCtx.Expired(now.Add(time.Second)))
+
+	execCtx.Deadline = time.Time{}
+	require.Equal(t, execCtx.StageDeadline, execCtx.Expiry())
+
+	// compensations never expire
+	execCtx.Status = ExecStatusRollback
+	require.True(t, execCtx.Expiry().IsZero())
+	require.False(t, execCtx.Expired(now.Add(time.Hour)))
 }
@@ -312,6 +312,18 @@ func unrecoverableFailureStageFunc(v any) (any, any, error) {
 	return v, v, ErrTxExecUnrecoverable
 }
 
+func rollbackStageFunc(v any) (any, any, error) {
+	return v, v, ErrTxExecRollback
+}
+
+func flakyPopRollbackFunc(v any) (any, error) {
+	n := rand.Int63n(10000)
+	if n < 6000 {
+		return nil, errors.New("flaky error")
+	}
+	return popRollbackFunc(v)
+}
+
 func popRollbackFunc(v any) (any, error) {
 	s := v.(Input)
 	s.Value = s.Value[:len(s.Value)-1]
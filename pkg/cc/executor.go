@@ -1,20 +1,29 @@
 package cc
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
 	"math"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	pq "github.com/emirpasic/gods/v2/queues/priorityqueue"
 )
 
 var (
 	ErrTxExecEmpty          = errors.New("tx empty execution")
 	ErrTxExecAborted        = errors.New("tx execution aborted")
 	ErrTxExecUnrecoverable  = errors.New("unrecoverable tx execution error")
+	ErrTxExecRollback       = errors.New("tx execution requested rollback")
 	ErrTxExecForceComplete  = errors.New("failed to force complete executor")
 	ErrTxExecCheckpoint     = errors.New("failed to perform execution checkpoint")
 	ErrTxExecStageEmptyFunc = errors.New("empty exec stage func")
+	ErrTxExecSkip           = errors.New("failed to skip tx hop")
+	ErrTxExecEmptyAdvancer  = errors.New("empty exec advancer")
+	ErrTxExecShutdown       = errors.New("failed to shut down tx executor manager")
 )
 
 type RetryFunc = func(retryTime int) time.Duration
@@ -22,6 +31,31 @@ type StageFunc = func(input any) (result any, output any, err error)
 type RollbackFunc = func(input any) (output any, err error)
 type CompleteFunc = func(input any) (output any, err error)
 
+// AdvanceFunc delivers a no-op hop that moves the receiver's origin clock of
+// (partition, service) past timestamp, at the serialization level of the chain.
+type AdvanceFunc = func(receiver string, partition uint64, service string, timestamp uint64, level SerializationLevel) error
+
+type ExecutorHookFunc = func(execCtx *TxExecutorContext)
+
+// DeadlinePolicy decides how a chain that passed its deadline finishes.
+type DeadlinePolicy string
+
+const (
+	// run the complete stage of the expired stage and every later one
+	DeadlinePolicyForceComplete DeadlinePolicy = "force-complete"
+	// compensate the stages that ran and skip the remaining hops
+	DeadlinePolicyRollback DeadlinePolicy = "rollback"
+)
+
+func (policy DeadlinePolicy) Valid() bool {
+	switch policy {
+	case DeadlinePolicyForceComplete, DeadlinePolicyRollback:
+		return true
+	default:
+		return false
+	}
+}
+
 func ConstantRetry(i int) RetryFunc {
 	return func(retryTime int) time.Duration {
 		return time.Duration(i) * time.Millisecond
@@ -39,85 +73,562 @@ func ExponentialBackoffRetry(max time.Duration) RetryFunc {
 	}
 }
 
+const (
+	DefaultExecWorkers    = 100
+	DefaultExecQueueSize  = 1000
+	DefaultExecMaxPending = 10000
+)
+
+type TxExecutorManagerOption struct {
+	// number of executors running concurrently
+	Workers int
+	// executors ready to run
+	QueueSize int
+	// executors owned by the manager before new chains are rejected
+	MaxPending int
+}
+
+type TxExecutorMetrics struct {
+	Workers  int    `json:"workers"`
+	Ready    int    `json:"ready"`
+	Delayed  int    `json:"delayed"`
+	Running  int64  `json:"running"`
+	Pending  int64  `json:"pending"`
+	Retries  uint64 `json:"retries"`
+	Rejected uint64 `json:"rejected"`
+}
+
+type delayedExecutor struct {
+	exec *TxExecutor
+	at   time.Time
+}
+
+// sort ascending
+func delayComparator(a, b delayedExecutor) int {
+	return a.at.Compare(b.at)
+}
+
 type TxExecutorManager struct {
-	recvQueue chan *TxExecutor
-	retryFunc func(int) time.Duration
+	recvQueue  chan *TxExecutor
+	retryFunc  func(int) time.Duration
+	advancer   AdvanceFunc
+	onComplete []ExecutorHookFunc
+	onAbort    []ExecutorHookFunc
+	// zero means no deadline
+	chainTimeout   time.Duration
+	stageTimeout   time.Duration
+	deadlinePolicy DeadlinePolicy
+	workers        int
+	maxPending     int64
+	// retries wait here instead of in sleeping goroutines
+	mu         sync.Mutex
+	delayQueue *pq.Queue[delayedExecutor]
+	// ids of the executors owned by the manager
+	owned map[uint64]int
+	// closed once the executor is no longer owned
+	watchers map[uint64][]chan struct{}
+	wake     chan struct{}
+	// workers stop after the current stage checkpoints
+	lifecycle
+	running  atomic.Int64
+	pending  atomic.Int64
+	retries  atomic.Uint64
+	rejected atomic.Uint64
 }
 
-func NewTxExecutorManager(retryFunc RetryFunc) *TxExecutorManager {
+func NewTxExecutorManager(retryFunc RetryFunc, options ...TxExecutorManagerOption) *TxExecutorManager {
+	var option TxExecutorManagerOption
+	if len(options) > 0 {
+		option = options[0]
+	}
+	if option.Workers <= 0 {
+		option.Workers = DefaultExecWorkers
+	}
+	if option.QueueSize <= 0 {
+		option.QueueSize = DefaultExecQueueSize
+	}
+	if option.MaxPending <= 0 {
+		option.MaxPending = DefaultExecMaxPending
+	}
+
 	return &TxExecutorManager{
-		recvQueue: make(chan *TxExecutor),
-		retryFunc: retryFunc,
+		recvQueue:      make(chan *TxExecutor, option.QueueSize),
+		retryFunc:      retryFunc,
+		advancer:       emptyAdvancer,
+		deadlinePolicy: DeadlinePolicyForceComplete,
+		workers:        option.Workers,
+		maxPending:     int64(option.MaxPending),
+		delayQueue:     pq.NewWith(delayComparator),
+		owned:          map[uint64]int{},
+		watchers:       map[uint64][]chan struct{}{},
+		wake:           make(chan struct{}, 1),
+		lifecycle:      newLifecycle(),
+	}
+}
+
+func emptyAdvancer(receiver string, partition uint64, service string, timestamp uint64, level SerializationLevel) error {
+	return ErrTxExecEmptyAdvancer
+}
+
+func (mgr *TxExecutorManager) Advancer(f AdvanceFunc) *TxExecutorManager {
+	mgr.advancer = f
+	return mgr
+}
+
+// OnComplete registers a hook that runs on the worker once an executor
+// completed. Hooks are registered before Run and must not block.
+func (mgr *TxExecutorManager) OnComplete(f ExecutorHookFunc) *TxExecutorManager {
+	mgr.onComplete = append(mgr.onComplete, f)
+	return mgr
+}
+
+// OnAbort registers a hook that runs on the worker once an executor was
+// aborted and its reserved timestamps were skipped.
+func (mgr *TxExecutorManager) OnAbort(f ExecutorHookFunc) *TxExecutorManager {
+	mgr.onAbort = append(mgr.onAbort, f)
+	return mgr
+}
+
+// ChainTimeout bounds new chains that do not bring a deadline of their own.
+func (mgr *TxExecutorManager) ChainTimeout(d time.Duration) *TxExecutorManager {
+	mgr.chainTimeout = d
+	return mgr
+}
+
+// StageTimeout bounds the stages that have no timeout of their own.
+func (mgr *TxExecutorManager) StageTimeout(d time.Duration) *TxExecutorManager {
+	mgr.stageTimeout = d
+	return mgr
+}
+
+func (mgr *TxExecutorManager) DeadlinePolicy(policy DeadlinePolicy) *TxExecutorManager {
+	mgr.deadlinePolicy = policy
+	return mgr
+}
+
+// ChainDeadline is the deadline of a chain started now, or the earlier
+// deadline the request brought. It is zero if neither is set.
+func (mgr *TxExecutorManager) ChainDeadline(requested time.Time) time.Time {
+	if mgr.chainTimeout <= 0 {
+		return requested
+	}
+	deadline := time.Now().Add(mgr.chainTimeout)
+	if !requested.IsZero() && requested.Before(deadline) {
+		return requested
+	}
+	return deadline
+}
+
+// Admit reserves room for a new chain. It reports false once the executors
+// owned by the manager and the admitted chains reach the pending limit. The
+// reservation is held until release is called, once the executor of the
+// chain was sent or the chain failed.
+func (mgr *TxExecutorManager) Admit() (release func(), ok bool) {
+	for {
+		pending := mgr.pending.Load()
+		if mgr.stopped() || pending >= mgr.maxPending {
+			mgr.rejected.Add(1)
+			return nil, false
+		}
+		if mgr.pending.CompareAndSwap(pending, pending+1) {
+			break
+		}
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			mgr.pending.Add(-1)
+		})
+	}, true
+}
+
+func (mgr *TxExecutorManager) Metrics() TxExecutorMetrics {
+	mgr.mu.Lock()
+	delayed := mgr.delayQueue.Size()
+	mgr.mu.Unlock()
+
+	return TxExecutorMetrics{
+		Workers:  mgr.workers,
+		Ready:    len(mgr.recvQueue),
+		Delayed:  delayed,
+		Running:  mgr.running.Load(),
+		Pending:  mgr.pending.Load(),
+		Retries:  mgr.retries.Load(),
+		Rejected: mgr.rejected.Load(),
 	}
 }
 
+// Send hands an executor over to the manager. It blocks while the ready
+// queue is full. Executors sent after shutdown are dropped; their checkpoint
+// is resumed on recovery.
 func (mgr *TxExecutorManager) Send(exec *TxExecutor) {
-	mgr.recvQueue <- exec
+	mgr.pending.Add(1)
+	mgr.mu.Lock()
+	mgr.owned[exec.execCtx.ExecID]++
+	mgr.mu.Unlock()
+	if mgr.stopped() {
+		mgr.done(exec)
+		return
+	}
+	select {
+	case mgr.recvQueue <- exec:
+		// raced with shutdown after the ready queue was drained
+		if mgr.stopped() {
+			mgr.dropReady()
+		}
+	case <-mgr.stop:
+		mgr.done(exec)
+	}
+}
+
+// SendSkip turns an aborted executor into a skip executor so the timestamps it
+// reserved are still delivered, as no-op hops, to every receiver.
+func (mgr *TxExecutorManager) SendSkip(exec *TxExecutor) error {
+	if err := exec.skip(); err != nil {
+		return err
+	}
+	mgr.Send(exec)
+	return nil
 }
 
+// Start runs the workers and the scheduler in new goroutines.
+func (mgr *TxExecutorManager) Start() {
+	for range mgr.workers {
+		mgr.goLoop(mgr.work)
+	}
+	mgr.goLoop(mgr.schedule)
+}
+
+// Run blocks until Shutdown is called.
 func (mgr *TxExecutorManager) Run() {
-	for exec := range mgr.recvQueue {
-		if exec.execCtx.Status == ExecStatusForceComplete {
-			go func() {
-				for exec.Next() {
-					if err := exec.ForceComplete(); err != nil {
-						mgr.retry(exec)
-						return
-					}
+	for range mgr.workers {
+		mgr.goLoop(mgr.work)
+	}
+	mgr.runLoop(mgr.schedule)
+}
 
-					if err := exec.Checkpoint(); err != nil {
-						mgr.retry(exec)
-						return
-					}
-					exec.retryTime = 0
-				}
+func (mgr *TxExecutorManager) work() {
+	for {
+		select {
+		case <-mgr.stop:
+			return
+		case exec := <-mgr.recvQueue:
+			mgr.running.Add(1)
+			mgr.execute(exec)
+			mgr.running.Add(-1)
+		}
+	}
+}
+
+// Shutdown stops the workers once their current stage is checkpointed and
+// waits for them to return. Unfinished executors are left to recovery.
+func (mgr *TxExecutorManager) Shutdown(ctx context.Context) error {
+	// executors that will not run are given up, so their watchers return and
+	// the pending count is right
+	return mgr.shutdown(ctx, ErrTxExecShutdown, func() {
+		mgr.dropReady()
+		mgr.dropDelayed()
+	})
+}
+
+func (mgr *TxExecutorManager) dropReady() {
+	for {
+		select {
+		case exec := <-mgr.recvQueue:
+			mgr.done(exec)
+		default:
+			return
+		}
+	}
+}
 
-				exec.execCtx.Status = ExecStatusCompleted
-				if err := exec.Checkpoint(); err != nil {
-					mgr.retry(exec)
+func (mgr *TxExecutorManager) dropDelayed() {
+	mgr.mu.Lock()
+	var dropped []*TxExecutor
+	for {
+		item, ok := mgr.delayQueue.Dequeue()
+		if !ok {
+			break
+		}
+		dropped = append(dropped, item.exec)
+	}
+	mgr.mu.Unlock()
+
+	for _, exec := range dropped {
+		mgr.done(exec)
+	}
+}
+
+// move due retries to the ready queue
+func (mgr *TxExecutorManager) schedule() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		var due []*TxExecutor
+		wait := time.Hour
+
+		mgr.mu.Lock()
+		now := time.Now()
+		for {
+			item, ok := mgr.delayQueue.Peek()
+			if !ok {
+				break
+			}
+			if item.at.After(now) {
+				wait = item.at.Sub(now)
+				break
+			}
+			_, _ = mgr.delayQueue.Dequeue()
+			due = append(due, item.exec)
+		}
+		mgr.mu.Unlock()
+
+		for i, exec := range due {
+			select {
+			case mgr.recvQueue <- exec:
+			case <-mgr.stop:
+				for _, exec := range due[i:] {
+					mgr.done(exec)
 				}
-			}()
-		} else {
-			go func() {
-				for exec.Next() {
-					if exec.execCtx.Status == ExecStatusForceComplete {
-						// use another branch to handle
-						mgr.retry(exec)
-						return
-					} else {
-						if err := exec.Execute(); err != nil {
-							// normal case -> just retry
-							if !errors.Is(err, ErrTxExecUnrecoverable) {
-								mgr.retry(exec)
-								return
+				return
+			}
+		}
+
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-mgr.wake:
+		case <-mgr.stop:
+			return
+		}
+	}
+}
+
+func (mgr *TxExecutorManager) execute(exec *TxExecutor) {
+	switch exec.execCtx.Status {
+	case ExecStatusSkip:
+		for exec.Next() {
+			if mgr.stopped() {
+				mgr.done(exec)
+				return
+			}
+			if err := exec.Skip(mgr.advancer); err != nil {
+				log.Println("skip:", exec.execCtx.ExecID, err)
+				mgr.retry(exec)
+				return
+			}
+
+			if err := exec.Checkpoint(); err != nil {
+				mgr.retry(exec)
+				return
+			}
+			exec.retryTime = 0
+		}
+
+		mgr.finish(exec, ExecStatusAborted)
+	case ExecStatusRollback:
+		for exec.Next() {
+			if mgr.stopped() {
+				mgr.done(exec)
+				return
+			}
+			if err := exec.Rollback(); err != nil {
+				log.Println("rollback:", exec.execCtx.ExecID, err)
+				mgr.retry(exec)
+				return
+			}
+
+			if err := exec.Checkpoint(); err != nil {
+				mgr.retry(exec)
+				return
+			}
+			exec.retryTime = 0
+		}
+
+		// the commit stage is final, the later stages are compensated
+		// -> deliver the timestamps of the hops that never ran
+		if err := exec.skip(); err != nil {
+			exec.execCtx.Status = ExecStatusRollback
+			mgr.retry(exec)
+			return
+		}
+		mgr.delay(exec, 0)
+	case ExecStatusForceComplete:
+		for exec.Next() {
+			if mgr.stopped() {
+				mgr.done(exec)
+				return
+			}
+			if err := exec.ForceComplete(); err != nil {
+				mgr.retry(exec)
+				return
+			}
+
+			if err := exec.Checkpoint(); err != nil {
+				mgr.retry(exec)
+				return
+			}
+			exec.retryTime = 0
+		}
+
+		mgr.finish(exec, ExecStatusCompleted)
+	default:
+		for exec.Next() {
+			if mgr.stopped() {
+				mgr.done(exec)
+				return
+			}
+			if exec.execCtx.Status == ExecStatusForceComplete ||
+				exec.execCtx.Status == ExecStatusRollback {
+				// use another branch to handle
+				mgr.delay(exec, 0)
+				return
+			} else if exec.execCtx.Expired(time.Now()) {
+				log.Println("deadline:", exec.execCtx.ExecID, mgr.deadlinePolicy)
+				mgr.expire(exec)
+			} else {
+				exec.startStage(mgr.stageTimeout)
+				if err := exec.Execute(); err != nil {
+					switch {
+					// unrecoverable -> force complete
+					case errors.Is(err, ErrTxExecUnrecoverable):
+						exec.execCtx.Status = ExecStatusForceComplete
+					// compensate the stages that already ran
+					case errors.Is(err, ErrTxExecRollback):
+						exec.execCtx.Status = ExecStatusRollback
+					// normal case -> just retry
+					default:
+						// the stage deadline survives recovery once the
+						// stage failed
+						if exec.retryTime == 0 && !exec.execCtx.StageDeadline.IsZero() {
+							if err := exec.Checkpoint(); err != nil {
+								log.Println("checkpoint stage deadline:", exec.execCtx.ExecID, err)
 							}
-							// unrecoverable -> force complete
-							exec.execCtx.Status = ExecStatusForceComplete
 						}
-					}
-
-					if err := exec.Checkpoint(); err != nil {
 						mgr.retry(exec)
 						return
 					}
-					exec.retryTime = 0
 				}
+			}
 
-				exec.execCtx.Status = ExecStatusCompleted
-				if err := exec.Checkpoint(); err != nil {
-					log.Println("checkpoint completed:", exec.execCtx.ExecID)
-					mgr.retry(exec)
-				}
-			}()
+			if err := exec.Checkpoint(); err != nil {
+				mgr.retry(exec)
+				return
+			}
+			exec.retryTime = 0
+		}
+
+		// the first stage requested rollback
+		if exec.execCtx.Status == ExecStatusRollback {
+			mgr.delay(exec, 0)
+			return
 		}
+
+		mgr.finish(exec, ExecStatusCompleted)
+	}
+}
+
+// finish checkpoints the terminal status, which queues the webhook of the
+// chain in TxWebhookOutbox. The hooks run once the status is durable.
+func (mgr *TxExecutorManager) finish(exec *TxExecutor, status ExecStatus) {
+	execCtx := exec.execCtx
+	prev := execCtx.Status
+	execCtx.Status = status
+	if err := exec.Checkpoint(); err != nil {
+		log.Println("checkpoint finished:", execCtx.ExecID, err)
+		// the stages already ran, the retry only finishes again
+		execCtx.Status = prev
+		mgr.retry(exec)
+		return
+	}
+
+	hooks := mgr.onComplete
+	if status == ExecStatusAborted {
+		hooks = mgr.onAbort
+	}
+	for _, hook := range hooks {
+		hook(execCtx)
+	}
+	mgr.done(exec)
+}
+
+// expire finishes a chain that passed its deadline according to the policy.
+// The stage that timed out may still have run at its receiver; a rollback
+// only compensates the stages that returned. A chain whose stages cannot all
+// be compensated is force completed instead of retrying its rollback forever.
+func (mgr *TxExecutorManager) expire(exec *TxExecutor) {
+	execCtx := exec.execCtx
+	execCtx.StageDeadline = time.Time{}
+	if mgr.deadlinePolicy == DeadlinePolicyRollback && exec.canRollback() {
+		execCtx.Status = ExecStatusRollback
+	} else {
+		execCtx.Status = ExecStatusForceComplete
 	}
 }
 
+// retries never wait past the chain or stage deadline, so it expires on time
 func (mgr *TxExecutorManager) retry(exec *TxExecutor) {
 	exec.retryTime += 1
-	// log.Println(mgr.retryFunc(exec.retryTime))
-	time.Sleep(mgr.retryFunc(exec.retryTime))
-	mgr.Send(exec)
+	mgr.retries.Add(1)
+	d := mgr.retryFunc(exec.retryTime)
+	if expiry := exec.execCtx.Expiry(); !expiry.IsZero() {
+		d = max(min(d, time.Until(expiry)), 0)
+	}
+	mgr.delay(exec, d)
+}
+
+func (mgr *TxExecutorManager) delay(exec *TxExecutor, d time.Duration) {
+	mgr.mu.Lock()
+	mgr.delayQueue.Enqueue(delayedExecutor{
+		exec: exec,
+		at:   time.Now().Add(d),
+	})
+	mgr.mu.Unlock()
+
+	select {
+	case mgr.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (mgr *TxExecutorManager) done(exec *TxExecutor) {
+	mgr.pending.Add(-1)
+	mgr.mu.Lock()
+	execID := exec.execCtx.ExecID
+	mgr.owned[execID]--
+	if mgr.owned[execID] <= 0 {
+		delete(mgr.owned, execID)
+		for _, watcher := range mgr.watchers[execID] {
+			close(watcher)
+		}
+		delete(mgr.watchers, execID)
+	}
+	mgr.mu.Unlock()
+}
+
+// Owns reports whether the executor is running or waiting for a retry in
+// this manager.
+func (mgr *TxExecutorManager) Owns(execID uint64) bool {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	_, ok := mgr.owned[execID]
+	return ok
+}
+
+// Watch returns a channel that is closed once the executor finished or was
+// dropped on shutdown. It reports false if the manager does not own the
+// executor, which then already finished or was never sent.
+func (mgr *TxExecutorManager) Watch(execID uint64) (<-chan struct{}, bool) {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	if _, ok := mgr.owned[execID]; !ok {
+		return nil, false
+	}
+	watcher := make(chan struct{})
+	mgr.watchers[execID] = append(mgr.watchers[execID], watcher)
+	return watcher, true
 }
 
 type TxExecutor struct {
@@ -149,11 +660,37 @@ func (exec *TxExecutor) Checkpoint() error {
 	return exec.checkpointer(exec.execCtx)
 }
 
+func (exec *TxExecutor) skip() error {
+	exec.execCtx.Status = ExecStatusSkip
+	exec.execCtx.Curr = 0
+	if err := exec.Checkpoint(); err != nil {
+		return fmt.Errorf("%w: %v", ErrTxExecCheckpoint, err)
+	}
+	return nil
+}
+
+// startStage sets the deadline of the stage at Curr unless a previous attempt
+// already did. Stages without a timeout use the fallback.
+func (exec *TxExecutor) startStage(fallback time.Duration) {
+	if !exec.execCtx.StageDeadline.IsZero() {
+		return
+	}
+	timeout := exec.stages[exec.execCtx.Curr].timeout
+	if timeout <= 0 {
+		timeout = fallback
+	}
+	if timeout > 0 {
+		exec.execCtx.StageDeadline = time.Now().Add(timeout)
+	}
+}
+
 func (exec *TxExecutor) Next() bool {
 	status := exec.execCtx.Status
 	curr := exec.execCtx.Curr
 	if status == ExecStatusRollback {
 		return curr > 0
+	} else if status == ExecStatusSkip {
+		return curr < len(exec.execCtx.Receivers)
 	} else {
 		return curr < len(exec.stages)
 	}
@@ -170,12 +707,15 @@ func (exec *TxExecutor) Execute() error {
 
 	exec.execCtx.Curr += 1
 	exec.execCtx.Input = stage.output
+	exec.execCtx.StageDeadline = time.Time{}
+	exec.execCtx.setOutput(exec.execCtx.Curr, stage.result)
 	return nil
 }
 
+// Rollback compensates the last executed stage. Curr only moves once the
+// compensation succeeded, so a failed rollback is retried on the same stage.
 func (exec *TxExecutor) Rollback() error {
-	exec.execCtx.Curr -= 1
-	curr := exec.execCtx.Curr
+	curr := exec.execCtx.Curr - 1
 	input := exec.execCtx.Input
 	stage := exec.stages[curr]
 	stage.Rollback(input)
@@ -183,10 +723,21 @@ func (exec *TxExecutor) Rollback() error {
 		return stage.Err()
 	}
 
+	exec.execCtx.Curr = curr
 	exec.execCtx.Input = stage.output
 	return nil
 }
 
+// canRollback reports whether every stage that ran has a rollback func.
+func (exec *TxExecutor) canRollback() bool {
+	for _, stage := range exec.stages[:exec.execCtx.Curr] {
+		if stage.rollbackFunc == nil {
+			return false
+		}
+	}
+	return true
+}
+
 func (exec *TxExecutor) ForceComplete() error {
 	curr := exec.execCtx.Curr
 	stage := exec.stages[curr]
@@ -199,17 +750,34 @@ func (exec *TxExecutor) ForceComplete() error {
 	return nil
 }
 
+// Skip delivers a no-op hop for the reserved timestamp of the current receiver.
+func (exec *TxExecutor) Skip(advance AdvanceFunc) error {
+	curr := exec.execCtx.Curr
+	ctrlCtx := exec.execCtx.CtrlCtx
+	receiver := exec.execCtx.Receivers[curr]
+	timestamp := exec.execCtx.Timestamps[curr]
+	if err := advance(receiver, ctrlCtx.Partition, ctrlCtx.Service, timestamp, ctrlCtx.Level); err != nil {
+		return fmt.Errorf("%w: %v", ErrTxExecSkip, err)
+	}
+	exec.execCtx.Curr += 1
+	return nil
+}
+
 func (exec *TxExecutor) Run() (any, error) {
 	switch exec.execCtx.Status {
-	case ExecStatusAborted:
+	case ExecStatusAborted, ExecStatusSkip:
 		return nil, ErrTxExecAborted
-	// ExecStatusForceComplete implies committed
-	case ExecStatusCommitted, ExecStatusForceComplete, ExecStatusCompleted:
+	// ExecStatusForceComplete and ExecStatusRollback imply committed
+	case ExecStatusCommitted, ExecStatusForceComplete, ExecStatusRollback, ExecStatusCompleted:
 		return exec.execCtx.Result, nil
 	default:
 		input := exec.execCtx.Input
 		commitStage := exec.commitStage
+		if commitStage.timeout > 0 {
+			exec.execCtx.StageDeadline = time.Now().Add(commitStage.timeout)
+		}
 		commitStage.Execute(input)
+		exec.execCtx.StageDeadline = time.Time{}
 		if commitStage.Err() != nil {
 			exec.execCtx.Status = ExecStatusAborted
 			return nil, fmt.Errorf("%w: %v", ErrTxExecAborted, commitStage.Err())
@@ -217,6 +785,7 @@ func (exec *TxExecutor) Run() (any, error) {
 
 		exec.execCtx.Input = commitStage.output
 		exec.execCtx.Result = commitStage.result
+		exec.execCtx.setOutput(0, commitStage.result)
 		exec.execCtx.Status = ExecStatusCommitted
 
 		return commitStage.result, nil
@@ -242,9 +811,11 @@ type TxExecutorStage struct {
 	stageFunc    StageFunc
 	rollbackFunc RollbackFunc
 	completeFunc CompleteFunc
-	output       any
-	result       any
-	err          error
+	// zero falls back to the stage timeout of the executor manager
+	timeout time.Duration
+	output  any
+	result  any
+	err     error
 }
 
 func NewExecutorStage() *TxExecutorStage {
@@ -266,6 +837,13 @@ func (stage *TxExecutorStage) CompleteStage(f CompleteFunc) *TxExecutorStage {
 	return stage
 }
 
+// Timeout bounds the attempts of the stage. HTTP stages pass it on to their
+// receiver, other stages are only checked between retries.
+func (stage *TxExecutorStage) Timeout(d time.Duration) *TxExecutorStage {
+	stage.timeout = d
+	return stage
+}
+
 func (stage *TxExecutorStage) Execute(v any) {
 	if stage.stageFunc == nil {
 		stage.err = ErrTxExecStageEmptyFunc
@@ -2,6 +2,9 @@ package cc
 
 import (
 	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 	"txchain/pkg/database"
@@ -270,3 +273,665 @@ func testDeleteAllExecutor(t *testing.T, conn *pgxpool.Pool) {
 	err := DeleteAllExecutorCheckpoints(conn)
 	require.NoError(t, err)
 }
+
+func TestTxExecutorManagerSkip(t *testing.T) {
+	partitions := uint64(10)
+	clockMgr := NewTxClockManager(partitions)
+	prtMgr := NewTxPartitionManager(partitions)
+	originMgr := NewTxOriginManager(partitions, clockMgr, prtMgr)
+
+	sender := "service-a"
+	receivers := []string{"service-b", "service-c", "service-b"}
+	originMgr.Init(sender)
+
+	// receivers share one origin manager, keyed by sender
+	var mu sync.Mutex
+	failures := 3
+	advancer := func(receiver string, partition uint64, service string, timestamp uint64, level SerializationLevel) error {
+		mu.Lock()
+		if failures > 0 {
+			failures--
+			mu.Unlock()
+			return errors.New("flaky advance")
+		}
+		mu.Unlock()
+		ok, err := originMgr.Acquire(context.Background(), NewWaitMsg(partition, service, timestamp))
+		if ok {
+			originMgr.Release(partition, service)
+		}
+		return err
+	}
+
+	execMgr := NewTxExecutorManager(ConstantRetry(1)).Advancer(advancer)
+	go execMgr.Run()
+
+	partition := uint64(3)
+	// a later hop waits behind the timestamps of the aborted chain
+	admitted := make(chan bool)
+	go func() {
+		ok, _ := originMgr.Acquire(context.Background(), NewWaitMsg(partition, sender, 4))
+		admitted <- ok
+	}()
+
+	var statuses []ExecStatus
+	checkpointer := func(execCtx *TxExecutorContext) error {
+		mu.Lock()
+		defer mu.Unlock()
+		statuses = append(statuses, execCtx.Status)
+		return nil
+	}
+
+	execCtx := defaultExecCtx()
+	execCtx.CtrlCtx.Partition = partition
+	execCtx.CtrlCtx.Service = sender
+	execCtx.Receivers = receivers
+	execCtx.Timestamps = []uint64{1, 2, 3}
+	execCtx.Status = ExecStatusAborted
+
+	executor := NewTxExecutor(execCtx, checkpointer)
+	err := execMgr.SendSkip(executor)
+	require.NoError(t, err)
+
+	select {
+	case ok := <-admitted:
+		require.True(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("hop after aborted chain was never admitted")
+	}
+	originMgr.Release(partition, sender)
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(statuses) > 0 && statuses[len(statuses)-1] == ExecStatusAborted
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, uint64(4), clockMgr.Get(partition, sender))
+	require.Equal(t, len(receivers), execCtx.Curr)
+}
+
+func TestTxExecutorManagerRollback(t *testing.T) {
+	var mu sync.Mutex
+	statuses := map[ExecStatus]int{}
+	checkpointer := func(execCtx *TxExecutorContext) error {
+		mu.Lock()
+		defer mu.Unlock()
+		statuses[execCtx.Status]++
+		return nil
+	}
+	status := func(execCtx *TxExecutorContext) ExecStatus {
+		mu.Lock()
+		defer mu.Unlock()
+		return execCtx.Status
+	}
+
+	execMgr := NewTxExecutorManager(ConstantRetry(1))
+	go execMgr.Run()
+
+	newStage := func(f StageFunc) *TxExecutorStage {
+		return NewExecutorStage().Stage(f).RollbackStage(flakyPopRollbackFunc)
+	}
+
+	// a later stage requests rollback after two stages ran
+	execCtx := defaultExecCtx()
+	executor := NewTxExecutor(execCtx, checkpointer).
+		CommitStage(newStage(pushStageFunc(1))).
+		Stage(newStage(pushStageFunc(2))).
+		Stage(newStage(pushStageFunc(3))).
+		Stage(newStage(rollbackStageFunc))
+
+	_, err := executor.Run()
+	require.NoError(t, err)
+	execMgr.Send(executor)
+
+	require.Eventually(t, func() bool {
+		return status(execCtx) == ExecStatusAborted
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, Input{Value: []int{1}}, execCtx.Input)
+	require.Equal(t, 0, execCtx.Curr)
+	mu.Lock()
+	// one checkpoint per compensated stage plus the one requesting rollback
+	require.Equal(t, 3, statuses[ExecStatusRollback])
+	mu.Unlock()
+
+	// the first stage requests rollback -> nothing to compensate
+	execCtx = defaultExecCtx()
+	executor = NewTxExecutor(execCtx, checkpointer).
+		CommitStage(newStage(pushStageFunc(1))).
+		Stage(newStage(rollbackStageFunc))
+
+	_, err = executor.Run()
+	require.NoError(t, err)
+	execMgr.Send(executor)
+
+	require.Eventually(t, func() bool {
+		return status(execCtx) == ExecStatusAborted
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, Input{Value: []int{1}}, execCtx.Input)
+
+	// a recovered half-finished rollback resumes from its checkpoint
+	execCtx = defaultExecCtx()
+	execCtx.Status = ExecStatusRollback
+	execCtx.Input = Input{Value: []int{1, 2}}
+	execCtx.Result = Result{1}
+	execCtx.Curr = 1
+	executor = NewTxExecutor(execCtx, checkpointer).
+		CommitStage(newStage(pushStageFunc(1))).
+		Stage(newStage(pushStageFunc(2))).
+		Stage(newStage(pushStageFunc(3))).
+		Stage(newStage(rollbackStageFunc))
+
+	v, err := executor.Run()
+	require.NoError(t, err)
+	require.Equal(t, Result{1}, v)
+	execMgr.Send(executor)
+
+	require.Eventually(t, func() bool {
+		return status(execCtx) == ExecStatusAborted
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, Input{Value: []int{1}}, execCtx.Input)
+}
+
+func TestTxExecutorManagerWorkerPool(t *testing.T) {
+	workers := 4
+	maxPending := 20
+	execMgr := NewTxExecutorManager(ConstantRetry(50), TxExecutorManagerOption{
+		Workers:    workers,
+		QueueSize:  maxPending,
+		MaxPending: maxPending,
+	})
+	go execMgr.Run()
+
+	var running, maxRunning atomic.Int64
+	var failures atomic.Int64
+	release := make(chan struct{})
+	blockingStage := func(v any) (any, any, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		<-release
+		// fail once so every executor waits in the delay queue
+		if failures.Add(1) <= int64(maxPending) {
+			return nil, nil, errors.New("retry later")
+		}
+		return pushStageFunc(2)(v)
+	}
+
+	var mu sync.Mutex
+	completed := 0
+	checkpointer := func(execCtx *TxExecutorContext) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if execCtx.Status == ExecStatusCompleted {
+			completed++
+		}
+		return nil
+	}
+
+	for range maxPending {
+		release, ok := execMgr.Admit()
+		require.True(t, ok)
+		executor := NewTxExecutor(defaultExecCtx(), checkpointer).
+			CommitStage(NewExecutorStage().Stage(pushStageFunc(1))).
+			Stage(NewExecutorStage().Stage(blockingStage))
+		_, err := executor.Run()
+		require.NoError(t, err)
+		execMgr.Send(executor)
+		release()
+	}
+
+	// the pending limit rejects new chains
+	_, ok := execMgr.Admit()
+	require.False(t, ok)
+	require.Eventually(t, func() bool {
+		return execMgr.Metrics().Running == int64(workers)
+	}, time.Second, 10*time.Millisecond)
+	metrics := execMgr.Metrics()
+	require.Equal(t, int64(maxPending), metrics.Pending)
+	require.Equal(t, maxPending-workers, metrics.Ready)
+	require.Equal(t, uint64(1), metrics.Rejected)
+
+	// failed executors wait in the delay queue, not in sleeping workers
+	close(release)
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return completed == maxPending
+	}, 5*time.Second, 10*time.Millisecond)
+	require.LessOrEqual(t, maxRunning.Load(), int64(workers))
+
+	metrics = execMgr.Metrics()
+	require.Equal(t, int64(0), metrics.Pending)
+	require.Equal(t, 0, metrics.Delayed)
+	require.Equal(t, uint64(maxPending), metrics.Retries)
+	_, ok = execMgr.Admit()
+	require.True(t, ok)
+}
+
+func TestTxExecutorManagerAdmit(t *testing.T) {
+	maxPending := 2
+	execMgr := NewTxExecutorManager(ConstantRetry(1), TxExecutorManagerOption{
+		MaxPending: maxPending,
+	})
+
+	// admitted chains count before their executors are sent
+	release1, ok := execMgr.Admit()
+	require.True(t, ok)
+	release2, ok := execMgr.Admit()
+	require.True(t, ok)
+	_, ok = execMgr.Admit()
+	require.False(t, ok)
+	require.Equal(t, int64(maxPending), execMgr.Metrics().Pending)
+
+	// a failed chain gives its room back, once
+	release1()
+	release1()
+	require.Equal(t, int64(1), execMgr.Metrics().Pending)
+	release3, ok := execMgr.Admit()
+	require.True(t, ok)
+	release2()
+	release3()
+	require.Equal(t, int64(0), execMgr.Metrics().Pending)
+	require.Equal(t, uint64(1), execMgr.Metrics().Rejected)
+
+	// concurrent admissions never pass the limit
+	var wg sync.WaitGroup
+	var admitted atomic.Int64
+	for range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok := execMgr.Admit(); ok {
+				admitted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int64(maxPending), admitted.Load())
+}
+
+func TestTxExecutorManagerWatch(t *testing.T) {
+	execMgr := NewTxExecutorManager(ConstantRetry(1))
+	go execMgr.Run()
+	defer execMgr.Shutdown(context.Background())
+
+	release := make(chan struct{})
+	blockingStage := func(v any) (any, any, error) {
+		<-release
+		return pushStageFunc(2)(v)
+	}
+	execCtx := defaultExecCtx()
+	execCtx.ExecID = 42
+	executor := NewTxExecutor(execCtx, func(*TxExecutorContext) error { return nil }).
+		CommitStage(NewExecutorStage().Stage(pushStageFunc(1))).
+		Stage(NewExecutorStage().Stage(blockingStage))
+	_, err := executor.Run()
+	require.NoError(t, err)
+
+	// not sent yet
+	_, ok := execMgr.Watch(42)
+	require.False(t, ok)
+
+	execMgr.Send(executor)
+	done, ok := execMgr.Watch(42)
+	require.True(t, ok)
+	select {
+	case <-done:
+		t.Fatal("executor finished before its stage ran")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("executor did not finish")
+	}
+	require.Equal(t, ExecStatusCompleted, execCtx.Status)
+	require.Equal(t, []any{Result{1}, Result{2}}, execCtx.Outputs)
+
+	_, ok = execMgr.Watch(42)
+	require.False(t, ok)
+}
+
+func TestTxExecutorManagerCallbacks(t *testing.T) {
+	var mu sync.Mutex
+	var checkpoints []ExecStatus
+	checkpointErrs := []error{nil, ErrTxExecCheckpoint, nil}
+	completed := make(chan *TxExecutorContext, 1)
+	aborted := make(chan *TxExecutorContext, 1)
+
+	execMgr := NewTxExecutorManager(ConstantRetry(1)).
+		Advancer(func(receiver string, partition uint64, service string, timestamp uint64, level SerializationLevel) error {
+			return nil
+		}).
+		OnComplete(func(execCtx *TxExecutorContext) { completed <- execCtx }).
+		OnAbort(func(execCtx *TxExecutorContext) { aborted <- execCtx })
+	go execMgr.Run()
+	defer execMgr.Shutdown(context.Background())
+
+	checkpointer := func(execCtx *TxExecutorContext) error {
+		mu.Lock()
+		defer mu.Unlock()
+		checkpoints = append(checkpoints, execCtx.Status)
+		if len(checkpointErrs) == 0 {
+			return nil
+		}
+		err := checkpointErrs[0]
+		checkpointErrs = checkpointErrs[1:]
+		return err
+	}
+
+	// the hooks run once the terminal status is durable, the webhook is
+	// delivered later from the outbox
+	execCtx := defaultExecCtx()
+	execCtx.ExecID = 1
+	execCtx.CtrlCtx.Webhook = "http://hooks/chain"
+	executor := NewTxExecutor(execCtx, checkpointer).
+		CommitStage(NewExecutorStage().Stage(pushStageFunc(1))).
+		Stage(NewExecutorStage().Stage(pushStageFunc(2)))
+	_, err := executor.Run()
+	require.NoError(t, err)
+	execMgr.Send(executor)
+
+	select {
+	case got := <-completed:
+		require.Equal(t, uint64(1), got.ExecID)
+	case <-time.After(time.Second):
+		t.Fatal("complete hook did not run")
+	}
+	mu.Lock()
+	require.Equal(t, []ExecStatus{ExecStatusCommitted, ExecStatusCompleted, ExecStatusCompleted}, checkpoints)
+	mu.Unlock()
+
+	execCtx = defaultExecCtx()
+	execCtx.ExecID = 2
+	execCtx.CtrlCtx.Webhook = "http://hooks/chain"
+	execCtx.Status = ExecStatusAborted
+	execCtx.Receivers = []string{"service-b"}
+	execCtx.Timestamps = []uint64{1}
+	require.NoError(t, execMgr.SendSkip(NewTxExecutor(execCtx, checkpointer)))
+
+	select {
+	case got := <-aborted:
+		require.Equal(t, uint64(2), got.ExecID)
+		require.Equal(t, ExecStatusAborted, got.Status)
+	case <-time.After(time.Second):
+		t.Fatal("abort hook did not run")
+	}
+}
+
+func TestTxExecutorManagerDeadline(t *testing.T) {
+	var mu sync.Mutex
+	var stageDeadlines []time.Time
+	checkpointer := func(execCtx *TxExecutorContext) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if execCtx.Status == ExecStatusCommitted && !execCtx.StageDeadline.IsZero() {
+			stageDeadlines = append(stageDeadlines, execCtx.StageDeadline)
+		}
+		return nil
+	}
+	watch := func(execMgr *TxExecutorManager, execCtx *TxExecutorContext) {
+		done, ok := execMgr.Watch(execCtx.ExecID)
+		require.True(t, ok)
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("executor did not expire")
+		}
+	}
+
+	// retries wait far longer than the deadline, the chain still expires on time
+	execMgr := NewTxExecutorManager(ConstantRetry(int(time.Hour / time.Millisecond))).
+		StageTimeout(time.Hour)
+	go execMgr.Run()
+	defer execMgr.Shutdown(context.Background())
+
+	// the stage timeout force completes the stage and every later one
+	execCtx := defaultExecCtx()
+	execCtx.ExecID = 1
+	executor := NewTxExecutor(execCtx, checkpointer).
+		CommitStage(NewExecutorStage().Stage(pushStageFunc(1))).
+		Stage(NewExecutorStage().Stage(failureStageFunc).CompleteStage(forceCompleteFunc).Timeout(50 * time.Millisecond)).
+		Stage(NewExecutorStage().Stage(pushStageFunc(3)).CompleteStage(forceCompleteFunc))
+	_, err := executor.Run()
+	require.NoError(t, err)
+	execMgr.Send(executor)
+	watch(execMgr, execCtx)
+
+	require.Equal(t, ExecStatusCompleted, execCtx.Status)
+	require.Equal(t, Input{Value: []int{1, 0, 0}}, execCtx.Input)
+	mu.Lock()
+	// the deadline of the failed stage was checkpointed once
+	require.Len(t, stageDeadlines, 1)
+	mu.Unlock()
+
+	// the chain deadline rolls back the stages that ran
+	execMgr = NewTxExecutorManager(ConstantRetry(int(time.Hour / time.Millisecond))).
+		DeadlinePolicy(DeadlinePolicyRollback).
+		Advancer(func(receiver string, partition uint64, service string, timestamp uint64, level SerializationLevel) error {
+			return nil
+		})
+	go execMgr.Run()
+	defer execMgr.Shutdown(context.Background())
+
+	execCtx = defaultExecCtx()
+	execCtx.ExecID = 2
+	execCtx.Receivers = []string{"service-a", "service-b", "service-c"}
+	execCtx.Timestamps = []uint64{1, 2, 3}
+	execCtx.Deadline = time.Now().Add(50 * time.Millisecond)
+	executor = NewTxExecutor(execCtx, checkpointer).
+		CommitStage(NewExecutorStage().Stage(pushStageFunc(1))).
+		Stage(NewExecutorStage().Stage(pushStageFunc(2)).RollbackStage(popRollbackFunc)).
+		Stage(NewExecutorStage().Stage(failureStageFunc).RollbackStage(popRollbackFunc))
+	_, err = executor.Run()
+	require.NoError(t, err)
+	execMgr.Send(executor)
+	watch(execMgr, execCtx)
+
+	require.Equal(t, ExecStatusAborted, execCtx.Status)
+	require.Equal(t, Input{Value: []int{1}}, execCtx.Input)
+	require.False(t, execCtx.Expired(time.Now()))
+
+	// a chain without rollback stages is force completed instead
+	execCtx = defaultExecCtx()
+	execCtx.ExecID = 3
+	execCtx.Deadline = time.Now().Add(50 * time.Millisecond)
+	executor = NewTxExecutor(execCtx, checkpointer).
+		CommitStage(NewExecutorStage().Stage(pushStageFunc(1))).
+		Stage(NewExecutorStage().Stage(pushStageFunc(2)).CompleteStage(forceCompleteFunc)).
+		Stage(NewExecutorStage().Stage(failureStageFunc).CompleteStage(forceCompleteFunc))
+	_, err = executor.Run()
+	require.NoError(t, err)
+	execMgr.Send(executor)
+	watch(execMgr, execCtx)
+
+	require.Equal(t, ExecStatusCompleted, execCtx.Status)
+	require.Equal(t, Input{Value: []int{1, 2, 0}}, execCtx.Input)
+}
+
+func TestTxExecutorManagerChainDeadline(t *testing.T) {
+	execMgr := NewTxExecutorManager(ConstantRetry(1))
+	require.True(t, execMgr.ChainDeadline(time.Time{}).IsZero())
+	requested := time.Now().Add(time.Hour)
+	require.Equal(t, requested, execMgr.ChainDeadline(requested))
+
+	// the configured timeout caps the requested deadline
+	execMgr.ChainTimeout(time.Minute)
+	require.WithinDuration(t, time.Now().Add(time.Minute), execMgr.ChainDeadline(time.Time{}), time.Second)
+	require.WithinDuration(t, time.Now().Add(time.Minute), execMgr.ChainDeadline(requested), time.Second)
+	requested = time.Now().Add(time.Second)
+	require.Equal(t, requested, execMgr.ChainDeadline(requested))
+
+	require.True(t, DeadlinePolicyRollback.Valid())
+	require.False(t, DeadlinePolicy("retry").Valid())
+}
+
+func TestTxExecutorManagerShutdown(t *testing.T) {
+	execMgr := NewTxExecutorManager(ConstantRetry(10), TxExecutorManagerOption{
+		Workers: 2,
+	})
+	stopped := make(chan struct{})
+	go func() {
+		execMgr.Run()
+		close(stopped)
+	}()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	blockingStage := func(v any) (any, any, error) {
+		close(started)
+		<-release
+		return pushStageFunc(2)(v)
+	}
+
+	var mu sync.Mutex
+	var checkpoints []TxExecutorContext
+	checkpointer := func(execCtx *TxExecutorContext) error {
+		mu.Lock()
+		defer mu.Unlock()
+		checkpoints = append(checkpoints, *execCtx)
+		return nil
+	}
+
+	executor := NewTxExecutor(defaultExecCtx(), checkpointer).
+		CommitStage(NewExecutorStage().Stage(pushStageFunc(1))).
+		Stage(NewExecutorStage().Stage(blockingStage)).
+		Stage(NewExecutorStage().Stage(pushStageFunc(3)))
+	_, err := executor.Run()
+	require.NoError(t, err)
+	releaseAdmission, ok := execMgr.Admit()
+	require.True(t, ok)
+	execMgr.Send(executor)
+	releaseAdmission()
+	<-started
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		shutdownErr <- execMgr.Shutdown(context.Background())
+	}()
+
+	// the worker is still running its stage
+	select {
+	case err := <-shutdownErr:
+		t.Fatalf("shutdown returned before the stage finished: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	_, ok = execMgr.Admit()
+	require.False(t, ok)
+
+	close(release)
+	require.NoError(t, <-shutdownErr)
+	<-stopped
+
+	// stopped after the running stage checkpointed, the rest is left to recovery
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, checkpoints, 1)
+	require.Equal(t, ExecStatusCommitted, checkpoints[0].Status)
+	require.Equal(t, 1, checkpoints[0].Curr)
+
+	// executors sent after shutdown are dropped
+	execMgr.Send(NewTxExecutor(defaultExecCtx(), checkpointer))
+	require.Equal(t, int64(0), execMgr.Metrics().Pending)
+}
+
+func TestTxExecutorManagerShutdownDrop(t *testing.T) {
+	execMgr := NewTxExecutorManager(ConstantRetry(60_000), TxExecutorManagerOption{
+		Workers: 1,
+	})
+	go execMgr.Run()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	blockingStage := func(v any) (any, any, error) {
+		close(started)
+		<-release
+		return pushStageFunc(2)(v)
+	}
+	checkpointer := func(*TxExecutorContext) error { return nil }
+
+	newExecutor := func(execID uint64, stage StageFunc) *TxExecutor {
+		execCtx := defaultExecCtx()
+		execCtx.ExecID = execID
+		executor := NewTxExecutor(execCtx, checkpointer).
+			CommitStage(NewExecutorStage().Stage(pushStageFunc(1))).
+			Stage(NewExecutorStage().Stage(stage))
+		_, err := executor.Run()
+		require.NoError(t, err)
+		return executor
+	}
+
+	// waits in the delay queue
+	execMgr.Send(newExecutor(1, failureStageFunc))
+	require.Eventually(t, func() bool {
+		return execMgr.Metrics().Delayed == 1
+	}, time.Second, 10*time.Millisecond)
+	// occupies the only worker
+	execMgr.Send(newExecutor(2, blockingStage))
+	<-started
+	// waits in the ready queue
+	execMgr.Send(newExecutor(3, pushStageFunc(2)))
+
+	var watchers []<-chan struct{}
+	for execID := range uint64(3) {
+		done, ok := execMgr.Watch(execID + 1)
+		require.True(t, ok)
+		watchers = append(watchers, done)
+	}
+	require.Equal(t, int64(3), execMgr.Metrics().Pending)
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		shutdownErr <- execMgr.Shutdown(context.Background())
+	}()
+	close(release)
+	require.NoError(t, <-shutdownErr)
+
+	// every executor is given up, so the watchers return
+	for _, done := range watchers {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("watcher was not released on shutdown")
+		}
+	}
+	metrics := execMgr.Metrics()
+	require.Equal(t, int64(0), metrics.Pending)
+	require.Equal(t, 0, metrics.Ready)
+	require.Equal(t, 0, metrics.Delayed)
+}
+
+func TestTxExecutorManagerShutdownTimeout(t *testing.T) {
+	execMgr := NewTxExecutorManager(ConstantRetry(10), TxExecutorManagerOption{
+		Workers: 1,
+	})
+	go execMgr.Run()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	blockingStage := func(v any) (any, any, error) {
+		close(started)
+		<-release
+		return nil, v, nil
+	}
+
+	executor := NewTxExecutor(defaultExecCtx(), func(*TxExecutorContext) error { return nil }).
+		CommitStage(NewExecutorStage().Stage(pushStageFunc(1))).
+		Stage(NewExecutorStage().Stage(blockingStage))
+	_, err := executor.Run()
+	require.NoError(t, err)
+	execMgr.Send(executor)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = execMgr.Shutdown(ctx)
+	require.ErrorIs(t, err, ErrTxExecShutdown)
+}
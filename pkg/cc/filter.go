@@ -2,6 +2,7 @@ package cc
 
 import (
 	"errors"
+	"sync"
 
 	"github.com/emirpasic/gods/v2/sets/hashset"
 )
@@ -23,9 +24,12 @@ const (
 	TxFilterOpClear  TxFilterOp = "filter-clear"
 )
 
+// TxFilterManager is safe for concurrent use. Every partition has its own
+// lock, which is a leaf like the locks of TxClockManager.
 type TxFilterManager struct {
 	reqFilter  map[uint64]map[string]*hashset.Set[string]
 	respFilter map[uint64]map[string]*hashset.Set[string]
+	locks      []sync.RWMutex
 	partitions uint64
 }
 
@@ -41,66 +45,95 @@ func NewTxFilterManager(partitions uint64) *TxFilterManager {
 		partitions: partitions,
 		reqFilter:  reqFilter,
 		respFilter: respFilter,
+		locks:      make([]sync.RWMutex, partitions),
 	}
 }
 
 func (mgr *TxFilterManager) Init(service string) {
 	for partition := range mgr.partitions {
+		mgr.locks[partition].Lock()
 		mgr.reqFilter[partition][service] = hashset.New[string]()
 		mgr.respFilter[partition][service] = hashset.New[string]()
+		mgr.locks[partition].Unlock()
 	}
 }
 
 func (mgr *TxFilterManager) AddReqFilter(partition uint64, service string, attrs []string) {
-	partition = partition % mgr.partitions
-	set := mgr.reqFilter[partition][service]
-	set.Add(attrs...)
+	mgr.update(mgr.reqFilter, partition, service, func(set *hashset.Set[string]) {
+		set.Add(attrs...)
+	})
 }
 
 func (mgr *TxFilterManager) AddRespFilter(partition uint64, service string, attrs []string) {
-	partition = partition % mgr.partitions
-	set := mgr.respFilter[partition][service]
-	set.Add(attrs...)
+	mgr.update(mgr.respFilter, partition, service, func(set *hashset.Set[string]) {
+		set.Add(attrs...)
+	})
 }
 
 func (mgr *TxFilterManager) RemoveReqFilter(partition uint64, service string, attrs []string) {
-	partition = partition % mgr.partitions
-	set := mgr.reqFilter[partition][service]
-	set.Remove(attrs...)
+	mgr.update(mgr.reqFilter, partition, service, func(set *hashset.Set[string]) {
+		set.Remove(attrs...)
+	})
 }
 
 func (mgr *TxFilterManager) RemoveRespFilter(partition uint64, service string, attrs []string) {
-	partition = partition % mgr.partitions
-	set := mgr.respFilter[partition][service]
-	set.Remove(attrs...)
+	mgr.update(mgr.respFilter, partition, service, func(set *hashset.Set[string]) {
+		set.Remove(attrs...)
+	})
 }
 
 func (mgr *TxFilterManager) ClearReqFilter(partition uint64, service string) {
-	partition = partition % mgr.partitions
-	set := mgr.reqFilter[partition][service]
-	set.Clear()
+	mgr.update(mgr.reqFilter, partition, service, func(set *hashset.Set[string]) {
+		set.Clear()
+	})
 }
 
 func (mgr *TxFilterManager) ClearRespFilter(partition uint64, service string) {
-	partition = partition % mgr.partitions
-	set := mgr.respFilter[partition][service]
-	set.Clear()
+	mgr.update(mgr.respFilter, partition, service, func(set *hashset.Set[string]) {
+		set.Clear()
+	})
 }
 
 func (mgr *TxFilterManager) DropReq(partition uint64, service string, attrs []string) bool {
-	if len(attrs) == 0 {
-		return false
-	}
-	partition = partition % mgr.partitions
-	set := mgr.reqFilter[partition][service]
-	return set.Contains(attrs...)
+	return mgr.contains(mgr.reqFilter, partition, service, attrs)
 }
 
 func (mgr *TxFilterManager) DropResp(partition uint64, service string, attrs []string) bool {
+	return mgr.contains(mgr.respFilter, partition, service, attrs)
+}
+
+// filters of services that were not initialized are created on first use
+func (mgr *TxFilterManager) update(
+	filters map[uint64]map[string]*hashset.Set[string],
+	partition uint64,
+	service string,
+	f func(set *hashset.Set[string]),
+) {
+	partition = partition % mgr.partitions
+	mgr.locks[partition].Lock()
+	defer mgr.locks[partition].Unlock()
+
+	set, ok := filters[partition][service]
+	if !ok {
+		set = hashset.New[string]()
+		filters[partition][service] = set
+	}
+	f(set)
+}
+
+func (mgr *TxFilterManager) contains(
+	filters map[uint64]map[string]*hashset.Set[string],
+	partition uint64,
+	service string,
+	attrs []string,
+) bool {
 	if len(attrs) == 0 {
 		return false
 	}
 	partition = partition % mgr.partitions
-	set := mgr.respFilter[partition][service]
-	return set.Contains(attrs...)
+	mgr.locks[partition].RLock()
+	defer mgr.locks[partition].RUnlock()
+
+	set, ok := filters[partition][service]
+	return ok && set.Contains(attrs...)
 }
@@ -2,6 +2,7 @@ package cc
 
 import (
 	"slices"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -84,3 +85,41 @@ func TestTxFilterManager(t *testing.T) {
 		}
 	}
 }
+
+func TestTxFilterManagerConcurrency(t *testing.T) {
+	partitions := uint64(4)
+	filterMgr := NewTxFilterManager(partitions)
+	serviceA := "service-a"
+	filterMgr.Init(serviceA)
+
+	var wg sync.WaitGroup
+	for partition := range partitions {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for range 1000 {
+				filterMgr.AddReqFilter(partition, serviceA, []string{"apple"})
+				filterMgr.AddRespFilter(partition, serviceA, []string{"kiwi"})
+				filterMgr.RemoveReqFilter(partition, serviceA, []string{"apple"})
+				filterMgr.RemoveRespFilter(partition, serviceA, []string{"kiwi"})
+			}
+			// a service that was never initialized
+			filterMgr.AddReqFilter(partition, "service-b", []string{"apple"})
+		}()
+		go func() {
+			defer wg.Done()
+			for range 1000 {
+				_ = filterMgr.DropReq(partition, serviceA, []string{"apple"})
+				_ = filterMgr.DropResp(partition, serviceA, []string{"kiwi"})
+				_ = filterMgr.DropReq(partition, "service-b", []string{"apple"})
+			}
+		}()
+	}
+	wg.Wait()
+
+	for partition := range partitions {
+		require.False(t, filterMgr.DropReq(partition, serviceA, []string{"apple"}))
+		require.False(t, filterMgr.DropResp(partition, serviceA, []string{"kiwi"}))
+		require.True(t, filterMgr.DropReq(partition, "service-b", []string{"apple"}))
+	}
+}
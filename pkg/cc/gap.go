@@ -0,0 +1,338 @@
+package cc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+	"txchain/pkg/format"
+)
+
+var (
+	ErrTxGapStatus          = errors.New("failed to query tx timestamp status")
+	ErrTxGapResend          = errors.New("failed to resend tx executor")
+	ErrTxGapAdvance         = errors.New("failed to advance past tx gap")
+	ErrTxGapUnknownSender   = errors.New("unknown gap sender")
+	ErrTxGapRequest         = errors.New("failed to perform gap request")
+	ErrTxGapMonitorShutdown = errors.New("tx gap monitor did not stop in time")
+)
+
+const (
+	PathTxTimestampStatus = "/api/v1/tx/cc/status"
+	PathTxResendExecutor  = "/api/v1/tx/cc/resend"
+)
+
+const (
+	DefaultGapInterval    = 5 * time.Second
+	DefaultGapThreshold   = 10 * time.Second
+	DefaultGapResendAfter = time.Minute
+)
+
+// TxGap is an origin queue whose head waits for a timestamp that was never
+// delivered.
+type TxGap struct {
+	Partition uint64
+	// sender of the missing hop
+	Service string
+	// first missing timestamp
+	Timestamp uint64
+	// timestamp of the head waiter
+	Waiting uint64
+	Since   time.Time
+}
+
+type TxGapAction int
+
+const (
+	TxGapWait TxGapAction = iota
+	TxGapResend
+	TxGapAdvance
+)
+
+func (action TxGapAction) String() string {
+	switch action {
+	case TxGapResend:
+		return "resend"
+	case TxGapAdvance:
+		return "advance"
+	default:
+		return "wait"
+	}
+}
+
+type TxTimestampQuery struct {
+	Partition uint64 `json:"partition"`
+	Receiver  string `json:"receiver"`
+	Timestamp uint64 `json:"timestamp"`
+}
+
+// TxTimestampStatus is the executor that owns a timestamp on the sender.
+type TxTimestampStatus struct {
+	Found  bool       `json:"found"`
+	ExecID uint64     `json:"exec_id"`
+	Status ExecStatus `json:"status"`
+	// owned by the sender's executor manager
+	Running bool `json:"running"`
+	// the sender finished every hop to the receiver up to the watermark
+	Watermark uint64 `json:"watermark"`
+}
+
+type TxResendExecutor struct {
+	ExecID uint64 `json:"exec_id"`
+}
+
+// TxGapResolver queries the sender of a missing hop.
+type TxGapResolver interface {
+	Status(ctx context.Context, sender string, query TxTimestampQuery) (TxTimestampStatus, error)
+	Resend(ctx context.Context, sender string, execID uint64) error
+}
+
+// ReceiverAdvanceFunc delivers a no-op hop at timestamp on this receiver.
+type ReceiverAdvanceFunc = func(ctx context.Context, partition uint64, service string, timestamp uint64, level SerializationLevel) error
+
+type TxGapReport struct {
+	Gap    TxGap
+	Status TxTimestampStatus
+	Action TxGapAction
+	Err    error
+}
+
+// DecideGap waits for executors the sender is still retrying, resends the
+// ones it lost and advances past timestamps no executor will deliver. An
+// unknown timestamp is only advanced if the sender confirms it is below its
+// watermark, e.g. its executor finished and was compacted. Above it the
+// executor may not be visible yet.
+func DecideGap(gap TxGap, status TxTimestampStatus, resendAfter time.Duration) TxGapAction {
+	if !status.Found {
+		if gap.Timestamp <= status.Watermark {
+			return TxGapAdvance
+		}
+		return TxGapWait
+	}
+	switch status.Status {
+	case ExecStatusAborted, ExecStatusSkip, ExecStatusCompleted:
+		// the hop is a no-op or was delivered, advancing twice is ignored
+		return TxGapAdvance
+	}
+	if status.Running {
+		return TxGapWait
+	}
+	// the coordinator may still run the commit stage of a pending chain
+	if status.Status == ExecStatusPending && time.Since(gap.Since) < resendAfter {
+		return TxGapWait
+	}
+	return TxGapResend
+}
+
+type TxGapMonitorOption struct {
+	// time between two checks
+	Interval time.Duration
+	// how long the head of a queue waits before it is a gap
+	Threshold time.Duration
+	// how long a pending executor is left to its coordinator
+	ResendAfter time.Duration
+}
+
+// TxGapMonitor finds origin queues stuck behind a missing timestamp and asks
+// the sender what happened to it.
+type TxGapMonitor struct {
+	originMgr   *TxOriginManager
+	receiver    string
+	resolver    TxGapResolver
+	advance     ReceiverAdvanceFunc
+	interval    time.Duration
+	threshold   time.Duration
+	resendAfter time.Duration
+	lifecycle
+}
+
+func NewTxGapMonitor(
+	originMgr *TxOriginManager,
+	receiver string,
+	resolver TxGapResolver,
+	advance ReceiverAdvanceFunc,
+	options ...TxGapMonitorOption,
+) *TxGapMonitor {
+	var option TxGapMonitorOption
+	if len(options) > 0 {
+		option = options[0]
+	}
+	if option.Interval <= 0 {
+		option.Interval = DefaultGapInterval
+	}
+	if option.Threshold <= 0 {
+		option.Threshold = DefaultGapThreshold
+	}
+	if option.ResendAfter <= 0 {
+		option.ResendAfter = DefaultGapResendAfter
+	}
+
+	return &TxGapMonitor{
+		originMgr:   originMgr,
+		receiver:    receiver,
+		resolver:    resolver,
+		advance:     advance,
+		interval:    option.Interval,
+		threshold:   option.Threshold,
+		resendAfter: option.ResendAfter,
+		lifecycle:   newLifecycle(),
+	}
+}
+
+// Start runs the monitor in a new goroutine.
+func (m *TxGapMonitor) Start() {
+	m.goLoop(m.run)
+}
+
+// Run checks periodically until Shutdown is called.
+func (m *TxGapMonitor) Run() {
+	m.runLoop(m.run)
+}
+
+func (m *TxGapMonitor) run() {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), m.interval)
+			m.Check(ctx)
+			cancel()
+		}
+	}
+}
+
+func (m *TxGapMonitor) Shutdown(ctx context.Context) error {
+	return m.shutdown(ctx, ErrTxGapMonitorShutdown, nil)
+}
+
+// Check resolves every gap once and reports what was done.
+func (m *TxGapMonitor) Check(ctx context.Context) []TxGapReport {
+	var reports []TxGapReport
+	for _, gap := range m.originMgr.Gaps(m.threshold) {
+		report := m.resolve(ctx, gap)
+		log.Printf(
+			"tx gap: partition=%d service=%s missing=%d waiting=%d since=%v action=%v err=%v",
+			gap.Partition, gap.Service, gap.Timestamp, gap.Waiting, time.Since(gap.Since), report.Action, report.Err,
+		)
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+func (m *TxGapMonitor) resolve(ctx context.Context, gap TxGap) TxGapReport {
+	report := TxGapReport{Gap: gap}
+
+	query := TxTimestampQuery{
+		Partition: gap.Partition,
+		Receiver:  m.receiver,
+		Timestamp: gap.Timestamp,
+	}
+	status, err := m.resolver.Status(ctx, gap.Service, query)
+	if err != nil {
+		report.Err = fmt.Errorf("%w: %v", ErrTxGapStatus, err)
+		return report
+	}
+	report.Status = status
+	report.Action = DecideGap(gap, status, m.resendAfter)
+
+	switch report.Action {
+	case TxGapResend:
+		if err = m.resolver.Resend(ctx, gap.Service, status.ExecID); err != nil {
+			report.Err = fmt.Errorf("%w: %v", ErrTxGapResend, err)
+		}
+	case TxGapAdvance:
+		if err = m.advance(ctx, gap.Partition, gap.Service, gap.Timestamp, SerializationLevelOriginOrdering); err != nil {
+			report.Err = fmt.Errorf("%w: %v", ErrTxGapAdvance, err)
+		}
+	}
+	return report
+}
+
+var _ TxGapResolver = (*HTTPGapResolver)(nil)
+var _ TxWatermarkResolver = (*HTTPGapResolver)(nil)
+
+// HTTPGapResolver queries the status, resend and watermark endpoints of the
+// sender's peer.
+type HTTPGapResolver struct {
+	client *http.Client
+	peers  map[string]string
+}
+
+func NewHTTPGapResolver(client *http.Client, peers map[string]string) *HTTPGapResolver {
+	return &HTTPGapResolver{
+		client: client,
+		peers:  peers,
+	}
+}
+
+func (resolver *HTTPGapResolver) Status(ctx context.Context, sender string, query TxTimestampQuery) (TxTimestampStatus, error) {
+	var status TxTimestampStatus
+	resp, err := resolver.post(ctx, sender, PathTxTimestampStatus, query)
+	if err != nil {
+		return status, err
+	}
+	defer resp.Body.Close()
+
+	if err = json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return status, errors.Join(err, format.ErrJsonDecode)
+	}
+	return status, nil
+}
+
+func (resolver *HTTPGapResolver) Resend(ctx context.Context, sender string, execID uint64) error {
+	resp, err := resolver.post(ctx, sender, PathTxResendExecutor, TxResendExecutor{ExecID: execID})
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (resolver *HTTPGapResolver) Watermarks(ctx context.Context, sender string, query TxWatermarkQuery) ([]TxSenderWatermark, error) {
+	var watermarks []TxSenderWatermark
+	resp, err := resolver.post(ctx, sender, PathTxSenderWatermarks, query)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err = json.NewDecoder(resp.Body).Decode(&watermarks); err != nil {
+		return nil, errors.Join(err, format.ErrJsonDecode)
+	}
+	return watermarks, nil
+}
+
+func (resolver *HTTPGapResolver) post(ctx context.Context, sender, path string, body any) (*http.Response, error) {
+	addr, ok := resolver.peers[sender]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTxGapUnknownSender, sender)
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, errors.Join(err, format.ErrJsonEncode)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, addr+path, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := resolver.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %d", ErrTxGapRequest, resp.StatusCode)
+	}
+	return resp, nil
+}
@@ -0,0 +1,217 @@
+package cc
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+	"txchain/pkg/database"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+type testGapResolver struct {
+	mu       sync.Mutex
+	statuses map[uint64]TxTimestampStatus
+	queries  []TxTimestampQuery
+	resent   []uint64
+}
+
+func (resolver *testGapResolver) Status(ctx context.Context, sender string, query TxTimestampQuery) (TxTimestampStatus, error) {
+	resolver.mu.Lock()
+	defer resolver.mu.Unlock()
+	resolver.queries = append(resolver.queries, query)
+	return resolver.statuses[query.Timestamp], nil
+}
+
+func (resolver *testGapResolver) Resend(ctx context.Context, sender string, execID uint64) error {
+	resolver.mu.Lock()
+	defer resolver.mu.Unlock()
+	resolver.resent = append(resolver.resent, execID)
+	return nil
+}
+
+func TestDecideGap(t *testing.T) {
+	resendAfter := time.Minute
+	young := TxGap{Timestamp: 5, Since: time.Now()}
+	old := TxGap{Timestamp: 5, Since: time.Now().Add(-time.Hour)}
+
+	tests := []struct {
+		gap    TxGap
+		status TxTimestampStatus
+		action TxGapAction
+	}{
+		// unknown timestamps are only advanced below the sender watermark
+		{young, TxTimestampStatus{}, TxGapWait},
+		{old, TxTimestampStatus{Watermark: 4}, TxGapWait},
+		{young, TxTimestampStatus{Watermark: 5}, TxGapAdvance},
+		{young, TxTimestampStatus{Found: true, Status: ExecStatusAborted}, TxGapAdvance},
+		{young, TxTimestampStatus{Found: true, Status: ExecStatusSkip, Running: true}, TxGapAdvance},
+		{young, TxTimestampStatus{Found: true, Status: ExecStatusCompleted}, TxGapAdvance},
+		{old, TxTimestampStatus{Found: true, Status: ExecStatusCommitted, Running: true}, TxGapWait},
+		{young, TxTimestampStatus{Found: true, Status: ExecStatusCommitted}, TxGapResend},
+		{young, TxTimestampStatus{Found: true, Status: ExecStatusRollback}, TxGapResend},
+		{young, TxTimestampStatus{Found: true, Status: ExecStatusPending}, TxGapWait},
+		{old, TxTimestampStatus{Found: true, Status: ExecStatusPending}, TxGapResend},
+	}
+	for _, test := range tests {
+		require.Equal(t, test.action, DecideGap(test.gap, test.status, resendAfter), "%+v", test.status)
+	}
+}
+
+func TestTxGapMonitor(t *testing.T) {
+	partitions := uint64(4)
+	clockMgr := NewTxClockManager(partitions)
+	prtMgr := NewTxPartitionManager(partitions)
+	originMgr := NewTxOriginManager(partitions, clockMgr, prtMgr)
+
+	const (
+		sender   = "service-a"
+		receiver = "service-b"
+	)
+	originMgr.Init(sender)
+	partition := uint64(1)
+
+	resolver := &testGapResolver{statuses: map[uint64]TxTimestampStatus{}}
+	advance := func(ctx context.Context, partition uint64, service string, timestamp uint64, level SerializationLevel) error {
+		ok, err := originMgr.Acquire(ctx, NewWaitMsg(partition, service, timestamp))
+		if ok {
+			originMgr.Release(partition, service)
+		}
+		return err
+	}
+	monitor := NewTxGapMonitor(originMgr, receiver, resolver, advance, TxGapMonitorOption{
+		Threshold: 20 * time.Millisecond,
+	})
+	ctx := context.Background()
+
+	// hop 3 waits while 1 and 2 never arrive
+	admitted := make(chan bool, 1)
+	go func() {
+		ok, err := originMgr.Acquire(ctx, NewWaitMsg(partition, sender, 3))
+		require.NoError(t, err)
+		admitted <- ok
+	}()
+	require.Eventually(t, func() bool {
+		return len(originMgr.Gaps(0)) == 1
+	}, time.Second, time.Millisecond)
+
+	// not a gap before the threshold
+	require.Empty(t, monitor.Check(ctx))
+	time.Sleep(20 * time.Millisecond)
+
+	// the executor of 1 is still retried by the sender
+	resolver.statuses[1] = TxTimestampStatus{Found: true, ExecID: 7, Status: ExecStatusCommitted, Running: true}
+	reports := monitor.Check(ctx)
+	require.Len(t, reports, 1)
+	require.Equal(t, TxGap{
+		Partition: partition,
+		Service:   sender,
+		Timestamp: 1,
+		Waiting:   3,
+		Since:     reports[0].Gap.Since,
+	}, reports[0].Gap)
+	require.Equal(t, TxGapWait, reports[0].Action)
+	require.Equal(t, TxTimestampQuery{Partition: partition, Receiver: receiver, Timestamp: 1}, resolver.queries[0])
+
+	// the sender lost it
+	resolver.statuses[1] = TxTimestampStatus{Found: true, ExecID: 7, Status: ExecStatusCommitted}
+	reports = monitor.Check(ctx)
+	require.Equal(t, TxGapResend, reports[0].Action)
+	require.NoError(t, reports[0].Err)
+	require.Equal(t, []uint64{7}, resolver.resent)
+
+	// 1 was aborted, the receiver advances past it
+	resolver.statuses[1] = TxTimestampStatus{Found: true, ExecID: 7, Status: ExecStatusAborted}
+	reports = monitor.Check(ctx)
+	require.Equal(t, TxGapAdvance, reports[0].Action)
+	require.NoError(t, reports[0].Err)
+	require.Equal(t, uint64(1), originMgr.Clock(partition, sender))
+
+	// the sender does not know 2 and has not finished it
+	resolver.statuses[2] = TxTimestampStatus{Watermark: 1}
+	reports = monitor.Check(ctx)
+	require.Equal(t, uint64(2), reports[0].Gap.Timestamp)
+	require.Equal(t, TxGapWait, reports[0].Action)
+	require.Equal(t, uint64(1), originMgr.Clock(partition, sender))
+
+	// 2 was finished and compacted
+	resolver.statuses[2] = TxTimestampStatus{Watermark: 2}
+	reports = monitor.Check(ctx)
+	require.Equal(t, uint64(2), reports[0].Gap.Timestamp)
+	require.Equal(t, TxGapAdvance, reports[0].Action)
+	require.True(t, <-admitted)
+	originMgr.Release(partition, sender)
+	require.Equal(t, uint64(3), originMgr.Clock(partition, sender))
+	require.Empty(t, monitor.Check(ctx))
+}
+
+func TestTxExecutorManagerOwns(t *testing.T) {
+	execMgr := NewTxExecutorManager(ConstantRetry(1))
+	execCtx := defaultExecCtx()
+	execCtx.ExecID = 42
+	execCtx.Status = ExecStatusSkip
+	execCtx.Receivers = []string{"service-b"}
+	execCtx.Timestamps = []uint64{1}
+
+	advanced := make(chan struct{})
+	execMgr.Advancer(func(receiver string, partition uint64, service string, timestamp uint64, level SerializationLevel) error {
+		<-advanced
+		return nil
+	})
+	go execMgr.Run()
+	defer execMgr.Shutdown(context.Background())
+
+	execMgr.Send(NewTxExecutor(execCtx, func(*TxExecutorContext) error { return nil }))
+	require.True(t, execMgr.Owns(42))
+	close(advanced)
+	require.Eventually(t, func() bool {
+		return !execMgr.Owns(42)
+	}, time.Second, time.Millisecond)
+}
+
+func TestTxManagerAdvanceReceiver(t *testing.T) {
+	pgc, err := database.NewContainerTablesTx(t, "17.1")
+	defer func() {
+		if pgc != nil {
+			testcontainers.CleanupContainer(t, pgc.Container)
+		}
+	}()
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	conn, err := pgxpool.New(ctx, pgc.Endpoint())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	txMgr := NewTxManager(conn, 4, []string{"service-a"})
+	clock := func() uint64 {
+		var ts uint64
+		err := conn.QueryRow(ctx, `SELECT ts FROM TxReceiverClocks WHERE prt = 1 AND svc = 'service-a';`).Scan(&ts)
+		require.NoError(t, err)
+		return ts
+	}
+
+	// an unordered skip hop does not wait for the earlier timestamps
+	waitCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	require.NoError(t, txMgr.AdvanceReceiver(waitCtx, 1, "service-a", 3, SerializationLevelNone))
+	require.Equal(t, uint64(0), txMgr.ReceiverClockMgr.Get(1, "service-a"))
+	var done int
+	require.NoError(t, conn.QueryRow(ctx, `SELECT COUNT(*) FROM TxReceiverDone WHERE ts = 3;`).Scan(&done))
+	require.Equal(t, 1, done)
+
+	require.NoError(t, txMgr.AdvanceReceiver(waitCtx, 1, "service-a", 1, SerializationLevelOriginOrdering))
+	require.Equal(t, uint64(1), clock())
+
+	// the clock moves over the delivered unordered hops
+	require.NoError(t, txMgr.AdvanceReceiver(waitCtx, 1, "service-a", 2, SerializationLevelNone))
+	require.Equal(t, uint64(3), txMgr.ReceiverClockMgr.Get(1, "service-a"))
+	require.Equal(t, uint64(3), clock())
+
+	// outdated timestamps are ignored
+	require.NoError(t, txMgr.AdvanceReceiver(waitCtx, 1, "service-a", 2, SerializationLevelNone))
+	require.NoError(t, txMgr.AdvanceReceiver(waitCtx, 1, "service-a", 3, SerializationLevelOriginOrdering))
+}
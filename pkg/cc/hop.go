@@ -0,0 +1,230 @@
+package cc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+	"txchain/pkg/format"
+)
+
+var (
+	ErrTxHopIndex    = errors.New("tx hop index out of range")
+	ErrTxHopRequest  = errors.New("failed to perform tx hop request")
+	ErrTxHopResponse = errors.New("failed to decode tx hop response")
+	ErrTxDeadline    = errors.New("invalid tx deadline")
+)
+
+const (
+	HeaderKeyStageCtx = "X-Tx-Stage-Context"
+	HeaderKeyLoggerID = "X-Tx-Logger-ID"
+	HeaderKeyDeadline = "X-Tx-Deadline"
+)
+
+func FormatTxDeadline(deadline time.Time) string {
+	return deadline.UTC().Format(time.RFC3339Nano)
+}
+
+func ParseTxDeadline(encoded string) (time.Time, error) {
+	deadline, err := time.Parse(time.RFC3339Nano, encoded)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %v", ErrTxDeadline, err)
+	}
+	return deadline, nil
+}
+
+// HTTPStage sends one hop of a chain to its receiver. The hop index selects
+// the timestamp reserved for the receiver in the TxExecutorContext.
+type HTTPStage[Req, Resp any] struct {
+	client  *http.Client
+	method  string
+	peer    string
+	path    string
+	hop     int
+	execCtx *TxExecutorContext
+	dryRun  bool
+}
+
+func NewHTTPStage[Req, Resp any](
+	client *http.Client,
+	method, peer, path string,
+	hop int,
+	execCtx *TxExecutorContext,
+) *HTTPStage[Req, Resp] {
+	return &HTTPStage[Req, Resp]{
+		client:  client,
+		method:  method,
+		peer:    peer,
+		path:    path,
+		hop:     hop,
+		execCtx: execCtx,
+	}
+}
+
+func (stage *HTTPStage[Req, Resp]) DryRun(dryRun bool) *HTTPStage[Req, Resp] {
+	stage.dryRun = dryRun
+	return stage
+}
+
+// StageContext marks the hops sent while the chain rolls back as
+// compensations, so the receiver does not replay the forward hop of the same
+// timestamp.
+func (stage *HTTPStage[Req, Resp]) StageContext() (*TxStageContext, error) {
+	timestamps := stage.execCtx.Timestamps
+	if stage.hop < 0 || stage.hop >= len(timestamps) {
+		return nil, fmt.Errorf("%w: %d of %d", ErrTxHopIndex, stage.hop, len(timestamps))
+	}
+
+	ctrlCtx := stage.execCtx.CtrlCtx
+	return &TxStageContext{
+		Partition: ctrlCtx.Partition,
+		Service:   ctrlCtx.Service,
+		Timestamp: timestamps[stage.hop],
+		Attrs:     ctrlCtx.Attrs,
+		DryRun:    stage.dryRun,
+		Level:     ctrlCtx.Level,
+		Rollback:  stage.execCtx.Status == ExecStatusRollback,
+	}, nil
+}
+
+// Do sends the hop. 3xx and 4xx responses other than timeouts and rate limits
+// are unrecoverable, as is a response that cannot be decoded. Transport errors,
+// 408, 429 and 5xx responses (including dropped hops) are retried by the
+// executor manager.
+// The request is cancelled once the chain or the stage expires, and the
+// receiver is told the same deadline.
+func (stage *HTTPStage[Req, Resp]) Do(params Req) (Resp, error) {
+	var resp Resp
+
+	stageCtx, err := stage.StageContext()
+	if err != nil {
+		return resp, fmt.Errorf("%w: %v", ErrTxExecUnrecoverable, err)
+	}
+
+	req, err := stage.request(params)
+	if err != nil {
+		return resp, fmt.Errorf("%w: %v", ErrTxExecUnrecoverable, err)
+	}
+	req.Header.Set(HeaderKeyStageCtx, stageCtx.Encode())
+	req.Header.Set(HeaderKeyLoggerID, stage.execCtx.CtrlCtx.LoggerID)
+	if deadline := stage.execCtx.Expiry(); !deadline.IsZero() {
+		ctx, cancel := context.WithDeadline(req.Context(), deadline)
+		defer cancel()
+		req = req.WithContext(ctx)
+		req.Header.Set(HeaderKeyDeadline, FormatTxDeadline(deadline))
+	}
+
+	res, err := stage.client.Do(req)
+	if err != nil {
+		return resp, fmt.Errorf("%w: %v", ErrTxHopRequest, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		var errResp format.ErrorResponse
+		_ = json.NewDecoder(res.Body).Decode(&errResp)
+		err = fmt.Errorf("%w: %d %s %s. error msg: %s", ErrTxHopRequest, res.StatusCode, stage.method, stage.path, errResp.ErrorMsg)
+		if !retryableStatus(res.StatusCode) {
+			return resp, fmt.Errorf("%w: %v", ErrTxExecUnrecoverable, err)
+		}
+		return resp, err
+	}
+
+	if err = json.NewDecoder(res.Body).Decode(&resp); err != nil && !errors.Is(err, io.EOF) {
+		err = fmt.Errorf("%w: %v", ErrTxHopResponse, err)
+		return resp, fmt.Errorf("%w: %v", ErrTxExecUnrecoverable, err)
+	}
+	return resp, nil
+}
+
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	}
+	return code >= 500
+}
+
+func (stage *HTTPStage[Req, Resp]) request(params Req) (*http.Request, error) {
+	endpoint := stage.peer + stage.path
+	if stage.method == http.MethodGet {
+		values, err := format.EncodeParam(params)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequest(stage.method, endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.URL.RawQuery = values.Encode()
+		return req, nil
+	}
+
+	b, err := json.Marshal(params)
+	if err != nil {
+		return nil, errors.Join(err, format.ErrJsonEncode)
+	}
+	req, err := http.NewRequest(stage.method, endpoint, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// StageFunc sends the stage input as the request and passes it on unchanged;
+// the decoded response is the stage result.
+func (stage *HTTPStage[Req, Resp]) StageFunc() StageFunc {
+	return func(input any) (any, any, error) {
+		params, err := DecodeTxExecValue[Req](input)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrTxExecUnrecoverable, err)
+		}
+		resp, err := stage.Do(params)
+		if err != nil {
+			return nil, nil, err
+		}
+		return resp, params, nil
+	}
+}
+
+// RollbackFunc sends the stage input as the compensation request and passes
+// it on unchanged.
+func (stage *HTTPStage[Req, Resp]) RollbackFunc() RollbackFunc {
+	return func(input any) (any, error) {
+		params, err := DecodeTxExecValue[Req](input)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrTxExecUnrecoverable, err)
+		}
+		if _, err := stage.Do(params); err != nil {
+			return nil, err
+		}
+		return params, nil
+	}
+}
+
+// MapHTTPStage turns the hop into a typed stage. build maps the chain state to
+// the request and merge folds the response into the result and the state of
+// the next stage.
+func MapHTTPStage[In, Out, Req, Resp any](
+	stage *HTTPStage[Req, Resp],
+	build func(input In) (Req, error),
+	merge func(input In, resp Resp) (Out, In, error),
+) TypedStageFunc[In, Out] {
+	return func(input In) (Out, In, error) {
+		var result Out
+		params, err := build(input)
+		if err != nil {
+			return result, input, fmt.Errorf("%w: %v", ErrTxExecUnrecoverable, err)
+		}
+		resp, err := stage.Do(params)
+		if err != nil {
+			return result, input, err
+		}
+		return merge(input, resp)
+	}
+}
@@ -0,0 +1,277 @@
+package cc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+	"txchain/pkg/format"
+
+	"github.com/stretchr/testify/require"
+)
+
+type hopRequest struct {
+	UserID string `json:"user_id" schema:"user_id"`
+}
+
+type hopResponse struct {
+	Timestamp uint64 `json:"timestamp"`
+	UserID    string `json:"user_id"`
+}
+
+func testHopExecCtx() *TxExecutorContext {
+	execCtx := defaultExecCtx()
+	execCtx.CtrlCtx.LoggerID = "logger-1"
+	execCtx.CtrlCtx.Level = SerializationLevelNone
+	execCtx.Receivers = []string{"service-b", "service-c"}
+	execCtx.Timestamps = []uint64{7, 3}
+	return execCtx
+}
+
+func TestHTTPStage(t *testing.T) {
+	var status atomic.Int64
+	status.Store(http.StatusOK)
+	mux := http.NewServeMux()
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		stageCtx, err := DecodeTxStageContext(r.Header.Get(HeaderKeyStageCtx))
+		if err != nil {
+			format.WriteJsonResponse(w, format.NewErrorResponse(ErrTxStageContextDecode, err), http.StatusBadRequest)
+			return
+		}
+		if r.Header.Get(HeaderKeyLoggerID) != "logger-1" {
+			format.WriteJsonResponse(w, format.NewErrorResponse(ErrTxHopRequest, nil), http.StatusBadRequest)
+			return
+		}
+		if code := int(status.Load()); code != http.StatusOK {
+			format.WriteJsonResponse(w, format.NewErrorResponse(ErrTxRequestDropped, nil), code)
+			return
+		}
+
+		var req hopRequest
+		if r.Method == http.MethodGet {
+			req, err = format.DecodeParam[hopRequest](r)
+		} else {
+			req, err = format.DecodeBody[hopRequest](r)
+		}
+		if err != nil {
+			format.WriteJsonResponse(w, format.NewErrorResponse(ErrTxHopRequest, err), http.StatusBadRequest)
+			return
+		}
+		require.Equal(t, uint64(3), stageCtx.Partition)
+		require.Equal(t, "service-a", stageCtx.Service)
+		require.Equal(t, SerializationLevelNone, stageCtx.Level)
+		require.Equal(t, r.Method == http.MethodGet, stageCtx.DryRun)
+
+		resp := hopResponse{
+			Timestamp: stageCtx.Timestamp,
+			UserID:    req.UserID,
+		}
+		format.WriteJsonResponse(w, resp, http.StatusOK)
+	}
+	mux.HandleFunc("POST /hop", handler)
+	mux.HandleFunc("GET /hop", handler)
+	mux.HandleFunc("POST /malformed", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &http.Client{Timeout: time.Second}
+	execCtx := testHopExecCtx()
+
+	stage := NewHTTPStage[hopRequest, hopResponse](client, http.MethodPost, server.URL, "/hop", 1, execCtx)
+	resp, err := stage.Do(hopRequest{UserID: "alice"})
+	require.NoError(t, err)
+	require.Equal(t, hopResponse{Timestamp: 3, UserID: "alice"}, resp)
+
+	// query params and dry runs
+	stage = NewHTTPStage[hopRequest, hopResponse](client, http.MethodGet, server.URL, "/hop", 0, execCtx).DryRun(true)
+	resp, err = stage.Do(hopRequest{UserID: "bob"})
+	require.NoError(t, err)
+	require.Equal(t, hopResponse{Timestamp: 7, UserID: "bob"}, resp)
+
+	// dropped hops are retried
+	status.Store(http.StatusServiceUnavailable)
+	_, err = stage.Do(hopRequest{UserID: "bob"})
+	require.ErrorIs(t, err, ErrTxHopRequest)
+	require.NotErrorIs(t, err, ErrTxExecUnrecoverable)
+
+	status.Store(http.StatusInternalServerError)
+	_, err = stage.Do(hopRequest{UserID: "bob"})
+	require.NotErrorIs(t, err, ErrTxExecUnrecoverable)
+
+	// so are timeouts and rate limits
+	status.Store(http.StatusRequestTimeout)
+	_, err = stage.Do(hopRequest{UserID: "bob"})
+	require.NotErrorIs(t, err, ErrTxExecUnrecoverable)
+
+	status.Store(http.StatusTooManyRequests)
+	_, err = stage.Do(hopRequest{UserID: "bob"})
+	require.NotErrorIs(t, err, ErrTxExecUnrecoverable)
+
+	// client errors are not
+	status.Store(http.StatusConflict)
+	_, err = stage.Do(hopRequest{UserID: "bob"})
+	require.ErrorIs(t, err, ErrTxExecUnrecoverable)
+
+	// nor redirects that were not followed
+	status.Store(http.StatusNotModified)
+	_, err = stage.Do(hopRequest{UserID: "bob"})
+	require.ErrorIs(t, err, ErrTxExecUnrecoverable)
+	status.Store(http.StatusOK)
+
+	// neither are responses that cannot be decoded
+	stage = NewHTTPStage[hopRequest, hopResponse](client, http.MethodPost, server.URL, "/malformed", 0, execCtx)
+	_, err = stage.Do(hopRequest{UserID: "bob"})
+	require.ErrorIs(t, err, ErrTxExecUnrecoverable)
+	require.ErrorContains(t, err, ErrTxHopResponse.Error())
+
+	// nor stage inputs
+	_, _, err = stage.StageFunc()(make(chan int))
+	require.ErrorIs(t, err, ErrTxExecUnrecoverable)
+
+	stage = NewHTTPStage[hopRequest, hopResponse](client, http.MethodPost, server.URL, "/missing", 0, execCtx)
+	_, err = stage.Do(hopRequest{UserID: "bob"})
+	require.ErrorIs(t, err, ErrTxExecUnrecoverable)
+
+	stage = NewHTTPStage[hopRequest, hopResponse](client, http.MethodPost, server.URL, "/hop", 2, execCtx)
+	_, err = stage.Do(hopRequest{UserID: "bob"})
+	require.ErrorIs(t, err, ErrTxExecUnrecoverable)
+	require.ErrorContains(t, err, ErrTxHopIndex.Error())
+
+	// compensations keep the timestamp of the hop they undo
+	stageCtx, err := NewHTTPStage[hopRequest, hopResponse](client, http.MethodPost, server.URL, "/hop", 0, execCtx).StageContext()
+	require.NoError(t, err)
+	require.False(t, stageCtx.Rollback)
+	execCtx.Status = ExecStatusRollback
+	stageCtx, err = NewHTTPStage[hopRequest, hopResponse](client, http.MethodPost, server.URL, "/hop", 0, execCtx).StageContext()
+	require.NoError(t, err)
+	require.True(t, stageCtx.Rollback)
+	require.Equal(t, uint64(7), stageCtx.Timestamp)
+}
+
+func TestHTTPStageExecutor(t *testing.T) {
+	var requests atomic.Int64
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /hop", func(w http.ResponseWriter, r *http.Request) {
+		// the first attempt is dropped
+		if requests.Add(1) == 1 {
+			format.WriteJsonResponse(w, format.NewErrorResponse(ErrTxRequestDropped, nil), http.StatusServiceUnavailable)
+			return
+		}
+		stageCtx, err := DecodeTxStageContext(r.Header.Get(HeaderKeyStageCtx))
+		require.NoError(t, err)
+		format.WriteJsonResponse(w, hopResponse{Timestamp: stageCtx.Timestamp}, http.StatusOK)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	type chainState struct {
+		UserID     string   `json:"user_id"`
+		Timestamps []uint64 `json:"timestamps"`
+	}
+
+	client := &http.Client{Timeout: time.Second}
+	execCtx := testHopExecCtx()
+	execCtx.Input = chainState{UserID: "alice"}
+
+	build := func(state chainState) (hopRequest, error) {
+		return hopRequest{UserID: state.UserID}, nil
+	}
+	merge := func(state chainState, resp hopResponse) (hopResponse, chainState, error) {
+		state.Timestamps = append(state.Timestamps, resp.Timestamp)
+		return resp, state, nil
+	}
+	hop := func(i int) *TypedTxExecutorStage[chainState, hopResponse] {
+		stage := NewHTTPStage[hopRequest, hopResponse](client, http.MethodPost, server.URL, "/hop", i, execCtx)
+		return NewTypedExecutorStage[chainState, hopResponse]().Stage(MapHTTPStage(stage, build, merge))
+	}
+
+	completed := make(chan TxExecutorContext, 1)
+	checkpointer := func(execCtx *TxExecutorContext) error {
+		if execCtx.Status == ExecStatusCompleted {
+			completed <- *execCtx
+		}
+		return nil
+	}
+
+	exec, err := NewTypedTxExecutor[chainState, hopResponse](execCtx, checkpointer)
+	require.NoError(t, err)
+	exec.CommitStage(NewTypedExecutorStage[chainState, hopResponse]().Stage(
+		func(state chainState) (hopResponse, chainState, error) {
+			return hopResponse{UserID: state.UserID}, state, nil
+		},
+	)).Stage(hop(0)).Stage(hop(1))
+
+	result, err := exec.Run()
+	require.NoError(t, err)
+	require.Equal(t, hopResponse{UserID: "alice"}, result)
+
+	execMgr := NewTxExecutorManager(ConstantRetry(1))
+	go execMgr.Run()
+	defer execMgr.Shutdown(context.Background())
+	execMgr.Send(exec.Executor())
+
+	select {
+	case done := <-completed:
+		require.Equal(t, chainState{UserID: "alice", Timestamps: []uint64{7, 3}}, done.Input)
+	case <-time.After(5 * time.Second):
+		t.Fatal("executor did not complete")
+	}
+	require.Equal(t, uint64(1), execMgr.Metrics().Retries)
+}
+
+func TestHTTPStageDeadline(t *testing.T) {
+	release := make(chan struct{})
+	deadlines := make(chan string, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /hop", func(w http.ResponseWriter, r *http.Request) {
+		deadlines <- r.Header.Get(HeaderKeyDeadline)
+		if r.URL.Query().Get("block") != "" {
+			<-release
+		}
+		format.WriteJsonResponse(w, hopResponse{}, http.StatusOK)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	defer close(release)
+
+	client := &http.Client{Timeout: time.Second}
+	execCtx := testHopExecCtx()
+	execCtx.Status = ExecStatusCommitted
+	stage := NewHTTPStage[hopRequest, hopResponse](client, http.MethodPost, server.URL, "/hop", 0, execCtx)
+
+	// no deadline, no header
+	_, err := stage.Do(hopRequest{})
+	require.NoError(t, err)
+	require.Empty(t, <-deadlines)
+
+	// the earlier of the chain and stage deadlines is sent
+	execCtx.Deadline = time.Now().Add(time.Minute)
+	execCtx.StageDeadline = time.Now().Add(time.Second)
+	_, err = stage.Do(hopRequest{})
+	require.NoError(t, err)
+	deadline, err := ParseTxDeadline(<-deadlines)
+	require.NoError(t, err)
+	require.True(t, execCtx.StageDeadline.Equal(deadline))
+
+	// the request is cancelled once the deadline passed and retried
+	execCtx.StageDeadline = time.Now().Add(50 * time.Millisecond)
+	stage = NewHTTPStage[hopRequest, hopResponse](client, http.MethodPost, server.URL, "/hop?block=1", 0, execCtx)
+	_, err = stage.Do(hopRequest{})
+	require.ErrorIs(t, err, ErrTxHopRequest)
+	require.NotErrorIs(t, err, ErrTxExecUnrecoverable)
+	<-deadlines
+
+	// compensations do not expire
+	execCtx.Status = ExecStatusRollback
+	stage = NewHTTPStage[hopRequest, hopResponse](client, http.MethodPost, server.URL, "/hop", 0, execCtx)
+	_, err = stage.Do(hopRequest{})
+	require.NoError(t, err)
+	require.Empty(t, <-deadlines)
+
+	_, err = ParseTxDeadline("tomorrow")
+	require.ErrorIs(t, err, ErrTxDeadline)
+}
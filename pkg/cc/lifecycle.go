@@ -0,0 +1,89 @@
+package cc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// lifecycle stops the background loops of a component and waits for them.
+// A loop is registered before it runs, so a concurrent Shutdown either waits
+// for it or keeps it from starting.
+type lifecycle struct {
+	mu     sync.Mutex
+	closed bool
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+func newLifecycle() lifecycle {
+	return lifecycle{stop: make(chan struct{})}
+}
+
+func (l *lifecycle) enter() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return false
+	}
+	l.wg.Add(1)
+	return true
+}
+
+// goLoop starts loop in a new goroutine unless the component was shut down.
+func (l *lifecycle) goLoop(loop func()) bool {
+	if !l.enter() {
+		return false
+	}
+	go func() {
+		defer l.wg.Done()
+		loop()
+	}()
+	return true
+}
+
+// runLoop runs loop in the calling goroutine unless the component was shut
+// down.
+func (l *lifecycle) runLoop(loop func()) {
+	if !l.enter() {
+		return
+	}
+	defer l.wg.Done()
+	loop()
+}
+
+func (l *lifecycle) stopped() bool {
+	select {
+	case <-l.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// shutdown closes stop and waits for the loops until ctx is done. drain, if
+// set, runs once every loop returned.
+func (l *lifecycle) shutdown(ctx context.Context, errTimeout error, drain func()) error {
+	l.mu.Lock()
+	if !l.closed {
+		l.closed = true
+		close(l.stop)
+	}
+	l.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		if drain != nil {
+			drain()
+		}
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %v", errTimeout, ctx.Err())
+	}
+}
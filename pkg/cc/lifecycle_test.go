@@ -0,0 +1,85 @@
+package cc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLifecycle(t *testing.T) {
+	errTimeout := errors.New("timeout")
+	life := newLifecycle()
+
+	release := make(chan struct{})
+	returned := make(chan struct{})
+	life.goLoop(func() {
+		<-life.stop
+		<-release
+		close(returned)
+	})
+
+	// shutdown waits for a started loop, even one that has not run yet
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, life.shutdown(ctx, errTimeout, nil), errTimeout)
+	require.True(t, life.stopped())
+
+	close(release)
+	drained := false
+	require.NoError(t, life.shutdown(context.Background(), errTimeout, func() {
+		drained = true
+	}))
+	require.True(t, drained)
+	<-returned
+
+	// loops are not started after shutdown
+	life.goLoop(func() {
+		t.Error("loop started after shutdown")
+	})
+	life.runLoop(func() {
+		t.Error("loop ran after shutdown")
+	})
+}
+
+func TestTxResultCompactorShutdown(t *testing.T) {
+	compactor := NewTxResultCompactor(nil)
+	compactor.Start()
+	require.NoError(t, compactor.Shutdown(context.Background()))
+
+	// a late Run returns at once
+	finished := make(chan struct{})
+	go func() {
+		compactor.Run()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("run after shutdown did not return")
+	}
+}
+
+func TestTxManagerGoChain(t *testing.T) {
+	mgr := &TxManager{chains: newLifecycle()}
+
+	release := make(chan struct{})
+	require.True(t, mgr.GoChain(func() {
+		<-release
+	}))
+
+	// shutdown waits for a running chain
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, mgr.chains.shutdown(ctx, ErrTxChainShutdown, nil), ErrTxChainShutdown)
+
+	close(release)
+	require.NoError(t, mgr.chains.shutdown(context.Background(), ErrTxChainShutdown, nil))
+
+	// chains are left to recovery once shutting down
+	require.False(t, mgr.GoChain(func() {
+		t.Error("chain started after shutdown")
+	}))
+}
@@ -1,13 +1,35 @@
 package cc
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+var (
+	ErrTxFlushClocks   = errors.New("failed to flush tx clocks")
+	ErrTxChainShutdown = errors.New("tx chains did not stop in time")
+)
+
+// TxManager wires the concurrency control of one service. Locking rules:
+//
+//   - SenderPrtMgr serializes the coordinators of a partition. It is held
+//     while timestamps are reserved and committed by the allocator, and while
+//     a recovered chain reruns its commit stage. It is never held while a hop
+//     is sent or waits for its turn at a receiver.
+//   - ReceiverPrtMgr guards the queues of OriginMgr. It is only taken inside
+//     OriginMgr and never held while a hop runs, so a hop may start chains of
+//     its own.
+//   - The two partition managers are independent and never nested.
+//   - The locks of TxClockManager and TxFilterManager are leaves: they may be
+//     taken under a partition lock but never call out while held.
 type TxManager struct {
 	SenderClockMgr   *TxClockManager
+	Allocator        *TxTimestampAllocator
 	ReceiverClockMgr *TxClockManager
 	SenderPrtMgr     *TxPartitionManager
 	ReceiverPrtMgr   *TxPartitionManager
@@ -16,7 +38,14 @@ type TxManager struct {
 	ExecMgr          *TxExecutorManager
 	RecoveryMgr      *TxRecoveryManager
 	Instrumenter     *TxInstrumenter
-	conn             *pgxpool.Pool
+	Compactor        *TxResultCompactor
+	Batcher          *TxCheckpointBatcher
+	Webhooks         *TxWebhookOutbox
+	// nil unless the receiver name of the service is known
+	GapMonitor *TxGapMonitor
+	// commit stages of accepted chains running in the background
+	chains lifecycle
+	conn   *pgxpool.Pool
 }
 
 func NewTxManager(conn *pgxpool.Pool, partitions uint64, services []string) *TxManager {
@@ -27,7 +56,12 @@ func NewTxManager(conn *pgxpool.Pool, partitions uint64, services []string) *TxM
 	receiverPrtMgr := NewTxPartitionManager(partitions)
 	originMgr := NewTxOriginManager(partitions, receiverClockMgr, receiverPrtMgr)
 	execMgr := NewTxExecutorManager(ExponentialBackoffRetry(time.Second))
-	recoveryMgr := NewTxRecoveryManager(conn, senderClockMgr, receiverClockMgr, execMgr)
+	batcher := NewTxCheckpointBatcher(conn)
+	allocator := NewTxTimestampAllocator(conn, senderClockMgr)
+	recoveryMgr := NewTxRecoveryManager(conn, senderClockMgr, receiverClockMgr, execMgr).
+		OriginManager(originMgr).
+		Allocator(allocator).
+		Checkpointer(batcher.Checkpointer())
 	for _, service := range services {
 		filterMgr.Init(service)
 		originMgr.Init(service)
@@ -35,6 +69,7 @@ func NewTxManager(conn *pgxpool.Pool, partitions uint64, services []string) *TxM
 	instrumenter := NewTxInstrumenter()
 	return &TxManager{
 		SenderClockMgr:   senderClockMgr,
+		Allocator:        allocator,
 		ReceiverClockMgr: receiverClockMgr,
 		SenderPrtMgr:     senderPrtMgr,
 		ReceiverPrtMgr:   receiverPrtMgr,
@@ -43,6 +78,210 @@ func NewTxManager(conn *pgxpool.Pool, partitions uint64, services []string) *TxM
 		ExecMgr:          execMgr,
 		RecoveryMgr:      recoveryMgr,
 		Instrumenter:     instrumenter,
+		Compactor:        NewTxResultCompactor(conn),
+		Batcher:          batcher,
+		Webhooks:         NewTxWebhookOutbox(conn),
+		chains:           newLifecycle(),
 		conn:             conn,
 	}
 }
+
+// GoChain runs the commit stage of an accepted chain in a new goroutine that
+// Shutdown waits for. It reports false once shutting down, the persisted
+// executor is then left to recovery.
+func (mgr *TxManager) GoChain(run func()) bool {
+	return mgr.chains.goLoop(run)
+}
+
+// PersistReceiverClock durably records that the hop at timestamp was delivered.
+// Hops that run a TxLifeCycle persist their clock inside the lifecycle tx instead.
+func (mgr *TxManager) PersistReceiverClock(partition uint64, service string, timestamp uint64) error {
+	return UpsertReceiverClock(context.Background(), mgr.conn, partition, service, timestamp)
+}
+
+// PersistReceiverDone durably records an unordered hop delivered above the
+// receiver clock.
+func (mgr *TxManager) PersistReceiverDone(partition uint64, service string, timestamp uint64) error {
+	return InsertReceiverDone(context.Background(), mgr.conn, partition, service, timestamp)
+}
+
+// AdvanceReceiver delivers a no-op hop at timestamp. An ordered hop waits until
+// every earlier hop of the sender was delivered, an unordered one is recorded
+// as done like the hops of its chain. Outdated timestamps are ignored.
+func (mgr *TxManager) AdvanceReceiver(ctx context.Context, partition uint64, service string, timestamp uint64, level SerializationLevel) error {
+	if !level.Ordered() {
+		if timestamp <= mgr.ReceiverClockMgr.Get(partition, service) {
+			return nil
+		}
+		if err := mgr.PersistReceiverDone(partition, service, timestamp); err != nil {
+			return err
+		}
+		if !mgr.OriginMgr.Complete(partition, service, timestamp) {
+			return nil
+		}
+		return mgr.PersistReceiverClock(partition, service, mgr.OriginMgr.Clock(partition, service))
+	}
+
+	ok, err := mgr.OriginMgr.Acquire(ctx, NewWaitMsg(partition, service, timestamp))
+	if err != nil || !ok {
+		return err
+	}
+	err = mgr.PersistReceiverClock(partition, service, timestamp)
+	mgr.OriginMgr.Release(partition, service)
+	return err
+}
+
+// SenderWatermarks reports, per partition, the timestamp up to which this
+// service finished its hops to the receiver. Every allocated timestamp has a
+// persisted executor, so the allocated clock is read first and capped below
+// the lowest timestamp of an unfinished executor.
+func (mgr *TxManager) SenderWatermarks(ctx context.Context, query TxWatermarkQuery) ([]TxSenderWatermark, error) {
+	watermarks := make([]TxSenderWatermark, 0, len(query.Partitions))
+	for _, partition := range query.Partitions {
+		if partition >= mgr.SenderClockMgr.partitions {
+			return nil, fmt.Errorf("%w: %d", ErrTxWatermarkPrt, partition)
+		}
+		watermarks = append(watermarks, TxSenderWatermark{
+			Partition: partition,
+			Timestamp: mgr.SenderClockMgr.Get(partition, query.Receiver),
+		})
+	}
+
+	unfinished, err := GetUnfinishedTimestamps(ctx, mgr.conn, query.Receiver, query.Partitions)
+	if err != nil {
+		return nil, err
+	}
+	for i, watermark := range watermarks {
+		if lowest, ok := unfinished[watermark.Partition]; ok {
+			watermarks[i].Timestamp = min(watermark.Timestamp, max(lowest, 1)-1)
+		}
+	}
+	return watermarks, nil
+}
+
+// TimestampStatus looks up the executor that sends the hop at timestamp to
+// the receiver.
+func (mgr *TxManager) TimestampStatus(query TxTimestampQuery) (TxTimestampStatus, error) {
+	status, execCtx, err := GetTxExecutorByTimestamp(mgr.conn, query.Partition, query.Receiver, query.Timestamp)
+	if errors.Is(err, pgx.ErrNoRows) {
+		watermarks, err := mgr.SenderWatermarks(context.Background(), TxWatermarkQuery{
+			Receiver:   query.Receiver,
+			Partitions: []uint64{query.Partition},
+		})
+		if err != nil {
+			return TxTimestampStatus{}, err
+		}
+		return TxTimestampStatus{Watermark: watermarks[0].Timestamp}, nil
+	}
+	if err != nil {
+		return TxTimestampStatus{}, err
+	}
+	return TxTimestampStatus{
+		Found:   true,
+		ExecID:  execCtx.ExecID,
+		Status:  status,
+		Running: mgr.ExecMgr.Owns(execCtx.ExecID),
+	}, nil
+}
+
+// ExecutorStatus reports the progress of a chain coordinated by this service,
+// or pgx.ErrNoRows for an unknown executor.
+func (mgr *TxManager) ExecutorStatus(execID uint64) (TxExecutorStatus, error) {
+	status, execCtx, archived, err := FindTxExecutorCheckpoint(mgr.conn, execID)
+	if err != nil {
+		return TxExecutorStatus{}, err
+	}
+	execStatus := NewTxExecutorStatus(status, execCtx)
+	execStatus.Running = mgr.ExecMgr.Owns(execID)
+	execStatus.Archived = archived
+	return execStatus, nil
+}
+
+// ExecutorByKey looks up the chain a client started with an idempotency key,
+// or pgx.ErrNoRows if there is none.
+func (mgr *TxManager) ExecutorByKey(service, key string) (TxExecutorStatus, error) {
+	status, execCtx, archived, err := GetTxExecutorByIdempotencyKey(mgr.conn, service, key)
+	if err != nil {
+		return TxExecutorStatus{}, err
+	}
+	execStatus := NewTxExecutorStatus(status, execCtx)
+	execStatus.Running = mgr.ExecMgr.Owns(execCtx.ExecID)
+	execStatus.Archived = archived
+	return execStatus, nil
+}
+
+// Resend resumes an unfinished executor unless the executor manager is
+// still retrying it.
+func (mgr *TxManager) Resend(execID uint64) error {
+	if mgr.ExecMgr.Owns(execID) {
+		return nil
+	}
+	status, execCtx, err := GetTxExecutorCheckpoint(mgr.conn, execID)
+	if err != nil {
+		return err
+	}
+	if status == ExecStatusAborted || status == ExecStatusCompleted {
+		return nil
+	}
+	execCtx.ExecID = execID
+	return mgr.RecoveryMgr.Resend(execCtx)
+}
+
+// Start runs the executor manager, the checkpoint batcher, the result
+// compactor and the gap monitor in the background.
+func (mgr *TxManager) Start() {
+	mgr.Batcher.Start()
+	mgr.ExecMgr.Start()
+	mgr.Compactor.Start()
+	mgr.Webhooks.Start()
+	if mgr.GapMonitor != nil {
+		mgr.GapMonitor.Start()
+	}
+}
+
+// Checkpointer group-commits the checkpoints of the executors.
+func (mgr *TxManager) Checkpointer() CheckpointFunc {
+	return mgr.Batcher.Checkpointer()
+}
+
+// Shutdown stops the executor manager after the current stages checkpoint and
+// flushes the clocks. It should be called after the server stopped accepting
+// hops.
+func (mgr *TxManager) Shutdown(ctx context.Context) error {
+	// the chains hand their executors to the executor manager
+	err := mgr.chains.shutdown(ctx, ErrTxChainShutdown, nil)
+	err = errors.Join(err, mgr.ExecMgr.Shutdown(ctx))
+	err = errors.Join(err, mgr.Batcher.Shutdown(ctx))
+	err = errors.Join(err, mgr.Compactor.Shutdown(ctx))
+	err = errors.Join(err, mgr.Webhooks.Shutdown(ctx))
+	if mgr.GapMonitor != nil {
+		err = errors.Join(err, mgr.GapMonitor.Shutdown(ctx))
+	}
+	return errors.Join(err, mgr.FlushClocks(ctx))
+}
+
+// FlushClocks persists the in-memory clocks. A receiver clock may have moved
+// over completed unordered hops without being persisted. Sender clocks never
+// pass their reserved block, which is already persisted.
+func (mgr *TxManager) FlushClocks(ctx context.Context) error {
+	err := mgr.SenderClockMgr.Range(func(partition uint64, service string, timestamp uint64) error {
+		if timestamp == 0 {
+			return nil
+		}
+		return UpsertSenderClock(ctx, mgr.conn, partition, service, timestamp)
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrTxFlushClocks, err)
+	}
+
+	err = mgr.ReceiverClockMgr.Range(func(partition uint64, service string, timestamp uint64) error {
+		if timestamp == 0 {
+			return nil
+		}
+		return UpsertReceiverClock(ctx, mgr.conn, partition, service, timestamp)
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrTxFlushClocks, err)
+	}
+	return nil
+}
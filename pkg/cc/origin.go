@@ -1,14 +1,34 @@
 package cc
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
 	pq "github.com/emirpasic/gods/v2/queues/priorityqueue"
 )
 
+var (
+	ErrTxOriginCanceled  = errors.New("tx hop stopped waiting for its turn")
+	ErrTxOriginDuplicate = errors.New("tx hop superseded by a retry")
+)
+
+type waitResult int
+
+const (
+	waitOutdated waitResult = iota
+	waitAdmitted
+	waitSuperseded
+)
+
 type WaitMsg struct {
 	partition uint64
 	service   string
 	timestamp uint64
-	reply     chan struct{}
+	// answered exactly once
+	reply chan waitResult
+	at    time.Time
 }
 
 func NewWaitMsg(
@@ -16,12 +36,13 @@ func NewWaitMsg(
 	service string,
 	timestamp uint64,
 ) WaitMsg {
-	reply := make(chan struct{})
+	reply := make(chan waitResult, 1)
 	return WaitMsg{
 		partition: partition,
 		service:   service,
 		timestamp: timestamp,
 		reply:     reply,
+		at:        time.Now(),
 	}
 }
 
@@ -42,6 +63,13 @@ func timestampComparator(a, b WaitMsg) int {
 type TxOriginManager struct {
 	partitions uint64
 	queues     map[uint64]map[string]*pq.Queue[WaitMsg]
+	// an admitted hop that has not been released yet
+	inflight map[uint64]map[string]bool
+	// unordered hops completed above the clock
+	done map[uint64]map[string]map[uint64]struct{}
+	// the live waiter of every queued timestamp, queue entries of canceled or
+	// superseded waiters are dropped once they reach the head
+	waiting map[uint64]map[string]map[uint64]chan waitResult
 	// receiver clocks
 	clockMgr *TxClockManager
 	// receiver partitions
@@ -55,12 +83,21 @@ func NewTxOriginManager(
 ) *TxOriginManager {
 	partitions = GenPartitions(partitions)
 	queues := make(map[uint64]map[string]*pq.Queue[WaitMsg])
+	inflight := make(map[uint64]map[string]bool)
+	done := make(map[uint64]map[string]map[uint64]struct{})
+	waiting := make(map[uint64]map[string]map[uint64]chan waitResult)
 	for partition := range partitions {
 		queues[partition] = make(map[string]*pq.Queue[WaitMsg])
+		inflight[partition] = make(map[string]bool)
+		done[partition] = make(map[string]map[uint64]struct{})
+		waiting[partition] = make(map[string]map[uint64]chan waitResult)
 	}
 	return &TxOriginManager{
 		partitions: partitions,
 		queues:     queues,
+		inflight:   inflight,
+		done:       done,
+		waiting:    waiting,
 		clockMgr:   receiverClockMgr,
 		prtMgr:     receiverPrtMgr,
 	}
@@ -69,16 +106,49 @@ func NewTxOriginManager(
 func (mgr *TxOriginManager) Init(service string) {
 	for partition := range mgr.partitions {
 		mgr.queues[partition][service] = pq.NewWith(timestampComparator)
+		mgr.done[partition][service] = make(map[uint64]struct{})
+		mgr.waiting[partition][service] = make(map[uint64]chan waitResult)
+	}
+}
+
+// Acquire blocks until every earlier hop of the sender was delivered and
+// reports false for a hop that was delivered already. A waiter leaves the
+// queue once ctx is done, and a retry of a queued hop takes the place of the
+// earlier attempt, so only one of them is admitted.
+func (mgr *TxOriginManager) Acquire(ctx context.Context, msg WaitMsg) (bool, error) {
+	if !mgr.enqueue(msg) {
+		return false, nil
+	}
+	mgr.next(msg.partition, msg.service)
+
+	select {
+	case result := <-msg.reply:
+		return result.acquired()
+	case <-ctx.Done():
+	}
+
+	if mgr.cancel(msg) {
+		return false, fmt.Errorf("%w: %v", ErrTxOriginCanceled, ctx.Err())
+	}
+	// answered concurrently
+	result := <-msg.reply
+	if result == waitAdmitted {
+		// the turn goes to a retry of the hop
+		mgr.Abandon(msg.partition, msg.service)
+		return false, fmt.Errorf("%w: %v", ErrTxOriginCanceled, ctx.Err())
 	}
+	return result.acquired()
 }
 
-func (mgr *TxOriginManager) Acquire(msg WaitMsg) bool {
-	ok := mgr.enqueue(msg)
-	if ok {
-		mgr.next(msg.partition, msg.service)
-		<-msg.reply
+func (result waitResult) acquired() (bool, error) {
+	switch result {
+	case waitAdmitted:
+		return true, nil
+	case waitSuperseded:
+		return false, ErrTxOriginDuplicate
+	default:
+		return false, nil
 	}
-	return ok
 }
 
 func (mgr *TxOriginManager) enqueue(msg WaitMsg) bool {
@@ -93,10 +163,127 @@ func (mgr *TxOriginManager) enqueue(msg WaitMsg) bool {
 	if timestamp <= currTs {
 		return false
 	}
+	if _, ok := mgr.done[partition][service][timestamp]; ok {
+		return false
+	}
+	waiting := mgr.waiting[partition][service]
+	if prev, ok := waiting[timestamp]; ok {
+		prev <- waitSuperseded
+	}
+	waiting[timestamp] = msg.reply
 	mgr.queues[partition][service].Enqueue(msg)
 	return true
 }
 
+// cancel reports false if the waiter was already answered.
+func (mgr *TxOriginManager) cancel(msg WaitMsg) bool {
+	mgr.prtMgr.Lock(msg.partition)
+	defer mgr.prtMgr.Unlock(msg.partition)
+
+	waiting := mgr.waiting[msg.partition][msg.service]
+	if waiting[msg.timestamp] != msg.reply {
+		return false
+	}
+	delete(waiting, msg.timestamp)
+	return true
+}
+
+// Abandon gives up an admission without advancing the clock, so the
+// timestamp is offered again to a retry of the hop.
+func (mgr *TxOriginManager) Abandon(partition uint64, service string) {
+	mgr.prtMgr.Lock(partition)
+	mgr.inflight[partition][service] = false
+	mgr.prtMgr.Unlock(partition)
+	mgr.next(partition, service)
+}
+
+// Complete delivers an unordered hop without waiting for its turn. The clock
+// only moves once every earlier timestamp was delivered, so ordered hops behind
+// it keep their order. It reports false for hops that were already delivered.
+func (mgr *TxOriginManager) Complete(partition uint64, service string, timestamp uint64) bool {
+	if !mgr.complete(partition, service, timestamp) {
+		return false
+	}
+	mgr.next(partition, service)
+	return true
+}
+
+func (mgr *TxOriginManager) complete(partition uint64, service string, timestamp uint64) bool {
+	mgr.prtMgr.Lock(partition)
+	defer mgr.prtMgr.Unlock(partition)
+
+	currTs := mgr.clockMgr.Get(partition, service)
+	if timestamp <= currTs {
+		return false
+	}
+	done := mgr.done[partition][service]
+	if _, ok := done[timestamp]; ok {
+		return false
+	}
+	done[timestamp] = struct{}{}
+	if !mgr.inflight[partition][service] {
+		mgr.drain(partition, service)
+	}
+	return true
+}
+
+// Gaps returns the queues whose head waited longer than threshold for a
+// timestamp that was never delivered.
+func (mgr *TxOriginManager) Gaps(threshold time.Duration) []TxGap {
+	var gaps []TxGap
+	for partition := range mgr.partitions {
+		mgr.prtMgr.Lock(partition)
+		for service, q := range mgr.queues[partition] {
+			if mgr.inflight[partition][service] {
+				continue
+			}
+			waiting := mgr.waiting[partition][service]
+			for {
+				topMsg, ok := q.Peek()
+				if !ok {
+					break
+				}
+				if waiting[topMsg.timestamp] != topMsg.reply {
+					_, _ = q.Dequeue()
+					continue
+				}
+				if time.Since(topMsg.at) >= threshold {
+					gaps = append(gaps, TxGap{
+						Partition: partition,
+						Service:   service,
+						Timestamp: mgr.clockMgr.Get(partition, service) + 1,
+						Waiting:   topMsg.timestamp,
+						Since:     topMsg.at,
+					})
+				}
+				break
+			}
+		}
+		mgr.prtMgr.Unlock(partition)
+	}
+	return gaps
+}
+
+// Clock returns the highest timestamp below which every hop was delivered.
+func (mgr *TxOriginManager) Clock(partition uint64, service string) uint64 {
+	mgr.prtMgr.Lock(partition)
+	defer mgr.prtMgr.Unlock(partition)
+	return mgr.clockMgr.Get(partition, service)
+}
+
+// advance the clock over completed unordered hops
+func (mgr *TxOriginManager) drain(partition uint64, service string) {
+	done := mgr.done[partition][service]
+	for {
+		nextTs := mgr.clockMgr.Get(partition, service) + 1
+		if _, ok := done[nextTs]; !ok {
+			return
+		}
+		delete(done, nextTs)
+		mgr.clockMgr.Inc(partition, service)
+	}
+}
+
 func (mgr *TxOriginManager) Release(partition uint64, service string) {
 	mgr.advance(partition, service)
 	mgr.next(partition, service)
@@ -106,6 +293,8 @@ func (mgr *TxOriginManager) advance(partition uint64, service string) {
 	mgr.prtMgr.Lock(partition)
 	defer mgr.prtMgr.Unlock(partition)
 	mgr.clockMgr.Inc(partition, service)
+	mgr.inflight[partition][service] = false
+	mgr.drain(partition, service)
 }
 
 func (mgr *TxOriginManager) next(partition uint64, service string) {
@@ -116,18 +305,37 @@ func (mgr *TxOriginManager) next(partition uint64, service string) {
 	var ok bool
 
 	q := mgr.queues[partition][service]
+	waiting := mgr.waiting[partition][service]
+	currTs := mgr.clockMgr.Get(partition, service)
 	// log.Println("origin queue:", q.Values())
-	topMsg, ok = q.Peek()
-	if !ok {
+	for {
+		topMsg, ok = q.Peek()
+		if !ok {
+			return
+		}
+		// canceled or superseded
+		if waiting[topMsg.timestamp] != topMsg.reply {
+			_, _ = q.Dequeue()
+			continue
+		}
+		// a retried hop (e.g. a skip hop) was admitted by an earlier request
+		if topMsg.timestamp > currTs {
+			break
+		}
+		_, _ = q.Dequeue()
+		delete(waiting, topMsg.timestamp)
+		topMsg.reply <- waitOutdated
+	}
+
+	if mgr.inflight[partition][service] {
 		return
 	}
 
-	currTs := mgr.clockMgr.Get(partition, service)
 	nextTs := currTs + 1
 	if topMsg.timestamp == nextTs {
 		_, _ = q.Dequeue()
-		go func() {
-			topMsg.reply <- struct{}{}
-		}()
+		delete(waiting, topMsg.timestamp)
+		mgr.inflight[partition][service] = true
+		topMsg.reply <- waitAdmitted
 	}
 }
@@ -1,9 +1,11 @@
 package cc
 
 import (
+	"context"
 	"math/rand"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -13,6 +15,7 @@ func TestTxOriginManager(t *testing.T) {
 	clockMgr := NewTxClockManager(partitions)
 	prtMgr := NewTxPartitionManager(partitions)
 	originMgr := NewTxOriginManager(partitions, clockMgr, prtMgr)
+	ctx := context.Background()
 
 	serviceA := "service-a"
 	serviceB := "service-b"
@@ -37,7 +40,8 @@ func TestTxOriginManager(t *testing.T) {
 			for _, ts := range perm {
 				go func() {
 					defer wg.Done()
-					ok := originMgr.Acquire(NewWaitMsg(partition, service, uint64(ts+1)))
+					ok, err := originMgr.Acquire(ctx, NewWaitMsg(partition, service, uint64(ts+1)))
+					require.NoError(t, err)
 					require.True(t, ok)
 					result = append(result, ts)
 					originMgr.Release(partition, service)
@@ -45,7 +49,8 @@ func TestTxOriginManager(t *testing.T) {
 				// outdated message
 				go func() {
 					defer wg.Done()
-					ok := originMgr.Acquire(NewWaitMsg(partition, service, uint64(0)))
+					ok, err := originMgr.Acquire(ctx, NewWaitMsg(partition, service, uint64(0)))
+					require.NoError(t, err)
 					require.False(t, ok)
 					// originMgr.Release(partition, service)
 				}()
@@ -62,6 +67,7 @@ func BenchmarkTxOriginManager(b *testing.B) {
 		clockMgr := NewTxClockManager(partitions)
 		prtMgr := NewTxPartitionManager(partitions)
 		originMgr := NewTxOriginManager(partitions, clockMgr, prtMgr)
+		ctx := context.Background()
 
 		serviceA := "service-a"
 		serviceB := "service-b"
@@ -82,7 +88,7 @@ func BenchmarkTxOriginManager(b *testing.B) {
 				for _, ts := range perm {
 					go func() {
 						defer wg.Done()
-						originMgr.Acquire(NewWaitMsg(partition, service, uint64(ts+1)))
+						_, _ = originMgr.Acquire(ctx, NewWaitMsg(partition, service, uint64(ts+1)))
 						result = append(result, ts)
 						originMgr.Release(partition, service)
 					}()
@@ -92,3 +98,151 @@ func BenchmarkTxOriginManager(b *testing.B) {
 		}
 	}
 }
+
+func TestTxOriginManagerRetriedHop(t *testing.T) {
+	partitions := uint64(10)
+	clockMgr := NewTxClockManager(partitions)
+	prtMgr := NewTxPartitionManager(partitions)
+	originMgr := NewTxOriginManager(partitions, clockMgr, prtMgr)
+	ctx := context.Background()
+
+	service := "service-a"
+	originMgr.Init(service)
+	partition := uint64(1)
+
+	// the same timestamp is waiting twice, e.g. a timed out hop and its retry
+	errs := make(chan error, 2)
+	results := make(chan bool, 2)
+	for range 2 {
+		go func() {
+			ok, err := originMgr.Acquire(ctx, NewWaitMsg(partition, service, 2))
+			if ok {
+				originMgr.Release(partition, service)
+			}
+			errs <- err
+			results <- ok
+		}()
+	}
+	// the next hop must not be wedged behind the stale duplicate
+	next := make(chan bool, 1)
+	go func() {
+		ok, err := originMgr.Acquire(ctx, NewWaitMsg(partition, service, 3))
+		require.NoError(t, err)
+		if ok {
+			originMgr.Release(partition, service)
+		}
+		next <- ok
+	}()
+
+	// the earlier attempt leaves the queue as soon as the retry arrives
+	require.ErrorIs(t, <-errs, ErrTxOriginDuplicate)
+	require.False(t, <-results)
+
+	ok, err := originMgr.Acquire(ctx, NewWaitMsg(partition, service, 1))
+	require.NoError(t, err)
+	require.True(t, ok)
+	originMgr.Release(partition, service)
+
+	require.NoError(t, <-errs)
+	require.True(t, <-results)
+	require.True(t, <-next)
+	require.Equal(t, uint64(3), clockMgr.Get(partition, service))
+}
+
+func TestTxOriginManagerUnordered(t *testing.T) {
+	partitions := uint64(10)
+	clockMgr := NewTxClockManager(partitions)
+	prtMgr := NewTxPartitionManager(partitions)
+	originMgr := NewTxOriginManager(partitions, clockMgr, prtMgr)
+	ctx := context.Background()
+
+	service := "service-a"
+	originMgr.Init(service)
+	partition := uint64(2)
+
+	// ordered hop waits for timestamps 1 and 2
+	admitted := make(chan bool, 1)
+	go func() {
+		ok, _ := originMgr.Acquire(ctx, NewWaitMsg(partition, service, 3))
+		admitted <- ok
+	}()
+
+	// unordered hops never wait, even above the clock
+	require.True(t, originMgr.Complete(partition, service, 2))
+	require.True(t, originMgr.Complete(partition, service, 5))
+	require.False(t, originMgr.Complete(partition, service, 2))
+	ok, err := originMgr.Acquire(ctx, NewWaitMsg(partition, service, 5))
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Equal(t, uint64(0), originMgr.Clock(partition, service))
+
+	select {
+	case <-admitted:
+		t.Fatal("ordered hop admitted before its predecessors")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the clock drains over the completed hop 2 once hop 1 is released
+	ok, err = originMgr.Acquire(ctx, NewWaitMsg(partition, service, 1))
+	require.NoError(t, err)
+	require.True(t, ok)
+	originMgr.Release(partition, service)
+	require.True(t, <-admitted)
+	require.Equal(t, uint64(2), originMgr.Clock(partition, service))
+
+	originMgr.Release(partition, service)
+	require.Equal(t, uint64(3), originMgr.Clock(partition, service))
+
+	require.True(t, originMgr.Complete(partition, service, 4))
+	require.Equal(t, uint64(5), originMgr.Clock(partition, service))
+	require.False(t, originMgr.Complete(partition, service, 4))
+}
+
+func TestTxOriginManagerCancel(t *testing.T) {
+	partitions := uint64(10)
+	clockMgr := NewTxClockManager(partitions)
+	prtMgr := NewTxPartitionManager(partitions)
+	originMgr := NewTxOriginManager(partitions, clockMgr, prtMgr)
+
+	service := "service-a"
+	originMgr.Init(service)
+	partition := uint64(4)
+
+	// a hop waiting for its predecessor gives up
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	ok, err := originMgr.Acquire(ctx, NewWaitMsg(partition, service, 2))
+	require.ErrorIs(t, err, ErrTxOriginCanceled)
+	require.False(t, ok)
+
+	// its retry is admitted in turn
+	admitted := make(chan bool, 1)
+	go func() {
+		ok, err := originMgr.Acquire(context.Background(), NewWaitMsg(partition, service, 2))
+		require.NoError(t, err)
+		admitted <- ok
+	}()
+	ok, err = originMgr.Acquire(context.Background(), NewWaitMsg(partition, service, 1))
+	require.NoError(t, err)
+	require.True(t, ok)
+	originMgr.Release(partition, service)
+	require.True(t, <-admitted)
+	originMgr.Release(partition, service)
+	require.Equal(t, uint64(2), originMgr.Clock(partition, service))
+
+	// a waiter canceled while it is admitted gives the turn back without
+	// advancing the clock
+	msg := NewWaitMsg(partition, service, 3)
+	require.True(t, originMgr.enqueue(msg))
+	originMgr.next(partition, service)
+	require.False(t, originMgr.cancel(msg))
+	require.Equal(t, waitAdmitted, <-msg.reply)
+	originMgr.Abandon(partition, service)
+	require.Equal(t, uint64(2), originMgr.Clock(partition, service))
+
+	ok, err = originMgr.Acquire(context.Background(), NewWaitMsg(partition, service, 3))
+	require.NoError(t, err)
+	require.True(t, ok)
+	originMgr.Release(partition, service)
+	require.Equal(t, uint64(3), originMgr.Clock(partition, service))
+}
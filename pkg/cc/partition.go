@@ -1,12 +1,18 @@
 package cc
 
 import (
+	"encoding/binary"
+	"errors"
 	"fmt"
-	"hash/maphash"
-	"strings"
+	"hash/fnv"
+	"math"
 	"sync"
 )
 
+var (
+	ErrTxPartitionKey = errors.New("unsupported tx partition key")
+)
+
 const (
 	MaxPartitions     = 10000
 	DefaultPartitions = 100
@@ -26,28 +32,152 @@ type Partition interface {
 	Keys() []any
 }
 
+// Partitioner maps keys to a partition in [0, partitions).
+// Implementations must be deterministic across processes and restarts since
+// sender clocks and checkpoints are recovered by partition number, and reject
+// keys they cannot encode that way.
+type Partitioner interface {
+	Partition(partitions uint64, keys ...any) (uint64, error)
+}
+
+var _ Partitioner = (*FNVPartitioner)(nil)
+
+// FNVPartitioner hashes a length-prefixed, type-aware encoding of the keys with
+// 64-bit FNV-1a. The encoding is part of the on-disk format: changing it
+// reshuffles every partition.
+type FNVPartitioner struct{}
+
+func NewFNVPartitioner() *FNVPartitioner {
+	return &FNVPartitioner{}
+}
+
+func (p *FNVPartitioner) Partition(partitions uint64, keys ...any) (uint64, error) {
+	sum, err := p.Sum64(keys...)
+	if err != nil {
+		return 0, err
+	}
+	return sum % partitions, nil
+}
+
+func (p *FNVPartitioner) Sum64(keys ...any) (uint64, error) {
+	b, err := EncodePartitionKeys(keys...)
+	if err != nil {
+		return 0, err
+	}
+	h := fnv.New64a()
+	_, _ = h.Write(b)
+	return h.Sum64(), nil
+}
+
+// key type tags
+const (
+	keyTagNil    byte = 'n'
+	keyTagBool   byte = 't'
+	keyTagInt    byte = 'i'
+	keyTagUint   byte = 'u'
+	keyTagFloat  byte = 'f'
+	keyTagString byte = 's'
+	keyTagBytes  byte = 'b'
+)
+
+// EncodePartitionKeys encodes each key as tag | uvarint(len) | payload so that
+// ("ab", "c") and ("a", "bc"), or 1 and "1", never collide. Integers are widened
+// to 64 bits and non-negative ones share the unsigned encoding, so neither the
+// width nor the signedness of a key changes its partition. Other types have no
+// stable encoding and are rejected.
+func EncodePartitionKeys(keys ...any) ([]byte, error) {
+	var b []byte
+	for _, key := range keys {
+		tag, payload, err := encodePartitionKey(key)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, tag)
+		b = binary.AppendUvarint(b, uint64(len(payload)))
+		b = append(b, payload...)
+	}
+	return b, nil
+}
+
+func encodePartitionKey(key any) (byte, []byte, error) {
+	switch v := key.(type) {
+	case nil:
+		return keyTagNil, nil, nil
+	case bool:
+		if v {
+			return keyTagBool, []byte{1}, nil
+		}
+		return keyTagBool, []byte{0}, nil
+	case int:
+		return encodeInt(int64(v))
+	case int8:
+		return encodeInt(int64(v))
+	case int16:
+		return encodeInt(int64(v))
+	case int32:
+		return encodeInt(int64(v))
+	case int64:
+		return encodeInt(v)
+	case uint:
+		return encodeUint(uint64(v))
+	case uint8:
+		return encodeUint(uint64(v))
+	case uint16:
+		return encodeUint(uint64(v))
+	case uint32:
+		return encodeUint(uint64(v))
+	case uint64:
+		return encodeUint(v)
+	case float32:
+		return encodeFloat(float64(v))
+	case float64:
+		return encodeFloat(v)
+	case string:
+		return keyTagString, []byte(v), nil
+	case []byte:
+		return keyTagBytes, v, nil
+	default:
+		return 0, nil, fmt.Errorf("%w: %T", ErrTxPartitionKey, key)
+	}
+}
+
+func encodeInt(v int64) (byte, []byte, error) {
+	if v >= 0 {
+		return encodeUint(uint64(v))
+	}
+	return keyTagInt, binary.BigEndian.AppendUint64(nil, uint64(v)), nil
+}
+
+func encodeUint(v uint64) (byte, []byte, error) {
+	return keyTagUint, binary.BigEndian.AppendUint64(nil, v), nil
+}
+
+func encodeFloat(v float64) (byte, []byte, error) {
+	return keyTagFloat, binary.BigEndian.AppendUint64(nil, math.Float64bits(v)), nil
+}
+
 type TxPartitionManager struct {
-	partitions uint64
-	locks      []sync.Mutex
+	partitions  uint64
+	partitioner Partitioner
+	locks       []sync.Mutex
 }
 
 func NewTxPartitionManager(partitions uint64) *TxPartitionManager {
 	partitions = GenPartitions(partitions)
 	return &TxPartitionManager{
-		partitions: partitions,
-		locks:      make([]sync.Mutex, partitions),
+		partitions:  partitions,
+		partitioner: NewFNVPartitioner(),
+		locks:       make([]sync.Mutex, partitions),
 	}
 }
 
-func (mgr *TxPartitionManager) Partition(keys ...any) uint64 {
-	var h maphash.Hash
-	var sb strings.Builder
-	for _, key := range keys {
-		sb.WriteString(fmt.Sprintf("%v", key))
-	}
-	_, _ = h.WriteString(sb.String())
-	partition := h.Sum64() % mgr.partitions
-	return partition
+func (mgr *TxPartitionManager) Partitioner(partitioner Partitioner) *TxPartitionManager {
+	mgr.partitioner = partitioner
+	return mgr
+}
+
+func (mgr *TxPartitionManager) Partition(keys ...any) (uint64, error) {
+	return mgr.partitioner.Partition(mgr.partitions, keys...)
 }
 
 func (mgr *TxPartitionManager) Lock(partition uint64) {
@@ -1,7 +1,13 @@
 package cc
 
 import (
+	"fmt"
+	"math"
 	"math/rand"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 
@@ -34,3 +40,115 @@ func TestTxPartitionManager(t *testing.T) {
 		require.Equal(t, concurrency, count, i)
 	}
 }
+
+// golden vectors: these values are persisted indirectly through sender clocks
+// and checkpoints and must never change between versions.
+var partitionGoldens = []struct {
+	keys      []any
+	sum       uint64
+	partition uint64
+}{
+	{[]any{}, 14695981039346656037, 37},
+	{[]any{nil}, 627033922241898499, 99},
+	{[]any{1}, 2945986718349943835, 35},
+	{[]any{int32(1)}, 2945986718349943835, 35},
+	{[]any{int64(1)}, 2945986718349943835, 35},
+	{[]any{uint64(1)}, 2945986718349943835, 35},
+	{[]any{"1"}, 9349703832788631128, 28},
+	{[]any{"ab", "c"}, 1400678166163234208, 8},
+	{[]any{"a", "bc"}, 4312538846801417158, 58},
+	{[]any{"user-1"}, 4262980569435612821, 21},
+	{[]any{"alice", 42}, 2589301936234527708, 8},
+	{[]any{true}, 6227019341237064613, 13},
+	{[]any{3.5}, 6575835320905269335, 35},
+	{[]any{[]byte("x")}, 18432153662099579708, 8},
+	{[]any{-1}, 1166305101690573244, 44},
+}
+
+func TestFNVPartitionerGolden(t *testing.T) {
+	p := NewFNVPartitioner()
+	prtMgr := NewTxPartitionManager(100)
+	for _, golden := range partitionGoldens {
+		sum, err := p.Sum64(golden.keys...)
+		require.NoError(t, err)
+		require.Equal(t, golden.sum, sum, golden.keys)
+		partition, err := p.Partition(100, golden.keys...)
+		require.NoError(t, err)
+		require.Equal(t, golden.partition, partition, golden.keys)
+		partition, err = prtMgr.Partition(golden.keys...)
+		require.NoError(t, err)
+		require.Equal(t, golden.partition, partition, golden.keys)
+	}
+}
+
+func TestFNVPartitionerCollision(t *testing.T) {
+	p := NewFNVPartitioner()
+	encode := func(keys ...any) []byte {
+		b, err := EncodePartitionKeys(keys...)
+		require.NoError(t, err)
+		return b
+	}
+	sum := func(keys ...any) uint64 {
+		s, err := p.Sum64(keys...)
+		require.NoError(t, err)
+		return s
+	}
+	require.NotEqual(t, encode("ab", "c"), encode("a", "bc"))
+	require.NotEqual(t, encode(1), encode("1"))
+	require.NotEqual(t, encode(nil), encode(""))
+	require.NotEqual(t, sum("ab", "c"), sum("a", "bc"))
+
+	// integers of the same value share a partition whatever their type
+	require.Equal(t, encode(uint64(5)), encode(5))
+	require.Equal(t, encode(uint8(5)), encode(int32(5)))
+	require.NotEqual(t, encode(-1), encode(uint64(math.MaxUint64)))
+}
+
+func TestFNVPartitionerUnsupported(t *testing.T) {
+	p := NewFNVPartitioner()
+	key := 1
+	for _, keys := range [][]any{{&key}, {map[string]int{"a": 1}}, {struct{ A int }{1}}, {"a", []int{1}}} {
+		_, err := p.Partition(100, keys...)
+		require.ErrorIs(t, err, ErrTxPartitionKey, keys)
+	}
+
+	prtMgr := NewTxPartitionManager(100)
+	_, err := prtMgr.Partition(&key)
+	require.ErrorIs(t, err, ErrTxPartitionKey)
+}
+
+const envPartitionChild = "TX_PARTITION_CHILD"
+
+// TestFNVPartitionerCrossProcess re-executes the test binary and compares the
+// partitions computed by a fresh process against this one.
+func TestFNVPartitionerCrossProcess(t *testing.T) {
+	prtMgr := NewTxPartitionManager(100)
+	if os.Getenv(envPartitionChild) != "" {
+		for _, golden := range partitionGoldens {
+			partition, err := prtMgr.Partition(golden.keys...)
+			require.NoError(t, err)
+			fmt.Println(partition)
+		}
+		return
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestFNVPartitionerCrossProcess$")
+	cmd.Env = append(os.Environ(), envPartitionChild+"=1")
+	out, err := cmd.Output()
+	require.NoError(t, err)
+
+	var partitions []uint64
+	for _, line := range strings.Split(string(out), "\n") {
+		partition, err := strconv.ParseUint(strings.TrimSpace(line), 10, 64)
+		if err != nil {
+			continue
+		}
+		partitions = append(partitions, partition)
+	}
+	require.Len(t, partitions, len(partitionGoldens))
+	for i, golden := range partitionGoldens {
+		partition, err := prtMgr.Partition(golden.keys...)
+		require.NoError(t, err)
+		require.Equal(t, partition, partitions[i], golden.keys)
+	}
+}
@@ -0,0 +1,37 @@
+package cc
+
+import (
+	"net/http"
+)
+
+const (
+	HeaderKeyPeerToken = "X-Tx-Peer-Token"
+)
+
+var _ http.RoundTripper = (*PeerTransport)(nil)
+
+// PeerTransport authenticates the requests of this service to the control
+// endpoints of its peers with the token shared by the services.
+type PeerTransport struct {
+	Token string
+	// http.DefaultTransport if nil
+	Base http.RoundTripper
+}
+
+func NewPeerTransport(token string, base http.RoundTripper) *PeerTransport {
+	return &PeerTransport{
+		Token: token,
+		Base:  base,
+	}
+}
+
+func (t *PeerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	// a RoundTripper must not modify the request
+	req = req.Clone(req.Context())
+	req.Header.Set(HeaderKeyPeerToken, t.Token)
+	return base.RoundTrip(req)
+}
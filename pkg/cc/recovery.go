@@ -10,8 +10,10 @@ import (
 	"math/rand"
 	"net/http"
 	"time"
+	"txchain/pkg/database"
 	"txchain/pkg/format"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -24,8 +26,9 @@ const (
 )
 
 const (
-	MaxRecoveryRetry     = 10
-	RecoveryWaitTimeUnit = 1 * time.Millisecond
+	MaxRecoveryRetry        = 10
+	RecoveryWaitTimeUnit    = 1 * time.Millisecond
+	DefaultRecoveryPageSize = 100
 )
 
 type TxRecoveryManager struct {
@@ -33,6 +36,11 @@ type TxRecoveryManager struct {
 	sendClockMgr *TxClockManager
 	recvClockMgr *TxClockManager
 	execMgr      *TxExecutorManager
+	originMgr    *TxOriginManager
+	allocator    *TxTimestampAllocator
+	checkpointer CheckpointFunc
+	pageSize     int
+	client       *http.Client
 }
 
 func NewTxRecoveryManager(
@@ -46,11 +54,53 @@ func NewTxRecoveryManager(
 		sendClockMgr: sendClockMgr,
 		recvClockMgr: recvClockMgr,
 		execMgr:      execMgr,
+		checkpointer: DefaultCheckpointer(conn),
+		pageSize:     DefaultRecoveryPageSize,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
 	}
 }
 
-// it should be called AFTER the server is running
+func (mgr *TxRecoveryManager) OriginManager(originMgr *TxOriginManager) *TxRecoveryManager {
+	mgr.originMgr = originMgr
+	return mgr
+}
+
+// Allocator restores the reserved blocks and skips their unused timestamps.
+func (mgr *TxRecoveryManager) Allocator(allocator *TxTimestampAllocator) *TxRecoveryManager {
+	mgr.allocator = allocator
+	return mgr
+}
+
+func (mgr *TxRecoveryManager) Checkpointer(checkpointer CheckpointFunc) *TxRecoveryManager {
+	mgr.checkpointer = checkpointer
+	return mgr
+}
+
+// PageSize bounds the executors loaded at once and the recovery requests in
+// flight.
+func (mgr *TxRecoveryManager) PageSize(pageSize int) *TxRecoveryManager {
+	if pageSize > 0 {
+		mgr.pageSize = pageSize
+	}
+	return mgr
+}
+
+// Recover restores the clocks and resends the unfinished executors at once.
+// A server restores before it serves and resends once it listens, since the
+// executors are resent to its coordinators.
 func (mgr *TxRecoveryManager) Recover() error {
+	if err := mgr.Restore(); err != nil {
+		return err
+	}
+	return mgr.ResendExecutors()
+}
+
+// Restore loads the clocks and closes the reserved blocks. It should be called
+// BEFORE the server accepts requests, so no chain allocates timestamps or
+// delivers hops meanwhile.
+func (mgr *TxRecoveryManager) Restore() error {
 	var err error
 	err = mgr.recoverSendClocks()
 	if err != nil {
@@ -62,13 +112,25 @@ func (mgr *TxRecoveryManager) Recover() error {
 		return err
 	}
 
-	err = mgr.recoverExecutors()
+	err = mgr.recoverRecvDone()
+	if err != nil {
+		return err
+	}
+
+	// the skip executors created here are resent with the other executors
+	err = mgr.recoverReserved()
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// ResendExecutors resumes the unfinished executors. It should be called AFTER
+// the server is running.
+func (mgr *TxRecoveryManager) ResendExecutors() error {
+	return mgr.recoverExecutors()
+}
+
 func (mgr *TxRecoveryManager) recoverSendClocks() error {
 	ctx := context.Background()
 	senderClockQuery := `
@@ -88,9 +150,13 @@ func (mgr *TxRecoveryManager) recoverSendClocks() error {
 		if err = rows.Scan(&partition, &service, &timestamp); err != nil {
 			return err
 		}
-		mgr.sendClockMgr.Set(partition, service, timestamp)
+		if mgr.allocator != nil {
+			mgr.allocator.Restore(partition, service, timestamp)
+		} else {
+			mgr.sendClockMgr.Set(partition, service, timestamp)
+		}
 	}
-	return nil
+	return rows.Err()
 }
 
 func (mgr *TxRecoveryManager) recoverRecvClocks() error {
@@ -117,60 +183,226 @@ func (mgr *TxRecoveryManager) recoverRecvClocks() error {
 	return nil
 }
 
-func (mgr *TxRecoveryManager) recoverExecutors() error {
+// unordered hops above the receiver clock must be completed again, otherwise
+// the clock would wait for timestamps that are never resent
+func (mgr *TxRecoveryManager) recoverRecvDone() error {
+	if mgr.originMgr == nil {
+		return nil
+	}
+
 	ctx := context.Background()
-	// aborted = 2, completed = 5, rollback = 3
-	// rollback is currently not supported
-	executorQuery := `
-		SELECT exec_id, checkpoint
-		FROM TxExecutor
-		WHERE status NOT IN (2, 3, 5);
+	receiverDoneQuery := `
+		SELECT d.prt, d.svc, d.ts
+		FROM TxReceiverDone d
+		LEFT JOIN TxReceiverClocks c
+			ON c.prt = d.prt AND c.svc = d.svc
+		WHERE d.ts > COALESCE(c.ts, 0)
+		ORDER BY d.ts;
 	`
-	rows, err := mgr.conn.Query(ctx, executorQuery)
+
+	rows, err := mgr.conn.Query(ctx, receiverDoneQuery)
 	if err != nil {
 		return err
 	}
 	defer rows.Close()
 
-	var reqs []*http.Request
 	for rows.Next() {
-		var checkpoint []byte
-		var execID uint64
-		if err = rows.Scan(&execID, &checkpoint); err != nil {
+		var partition, timestamp uint64
+		var service string
+		if err = rows.Scan(&partition, &service, &timestamp); err != nil {
 			return err
 		}
+		mgr.originMgr.Complete(partition, service, timestamp)
+	}
+	return rows.Err()
+}
 
-		var execCtx *TxExecutorContext
-		if err = json.Unmarshal(checkpoint, &execCtx); err != nil {
+func (mgr *TxRecoveryManager) recoverExecutors() error {
+	// a recovery request holds its slot until the executor is resent
+	inflight := make(chan struct{}, mgr.pageSize)
+
+	var after uint64
+	for {
+		// rollback resumes from the last compensated stage
+		// skip only needs the receivers and is resumed locally
+		execCtxs, err := GetUnfinishedTxExecutorCheckpoints(mgr.conn, after, mgr.pageSize)
+		if err != nil {
 			return err
 		}
-		execCtx.ExecID = execID
 
-		var b []byte
-		b, err = json.Marshal(execCtx.Input)
-		if err != nil {
-			return errors.Join(err, format.ErrJsonEncode)
+		for _, execCtx := range execCtxs {
+			after = execCtx.ExecID
+
+			if execCtx.Status == ExecStatusSkip {
+				executor := NewTxExecutor(execCtx, mgr.checkpointer)
+				go mgr.execMgr.Send(executor)
+				continue
+			}
+
+			req, err := recoveryRequestOf(execCtx)
+			if err != nil {
+				return err
+			}
+
+			inflight <- struct{}{}
+			go func() {
+				defer func() { <-inflight }()
+				recoveryRequest(mgr.client, req)
+			}()
 		}
 
-		method, endpoint := execCtx.Method, execCtx.Endpoint
-		req, err := http.NewRequest(method, endpoint, bytes.NewReader(b))
-		req.Header.Add(HeaderKeyExecCtx, execCtx.Encode())
-		if err != nil {
+		if len(execCtxs) < mgr.pageSize {
+			return nil
+		}
+	}
+}
+
+// timestamps of a reserved block that no executor took are delivered as no-op
+// hops, otherwise the receivers wait for them forever.
+func (mgr *TxRecoveryManager) recoverReserved() error {
+	if mgr.allocator == nil {
+		return nil
+	}
+
+	ctx := context.Background()
+	tx, commit, err := database.BeginTx(ctx, mgr.conn)
+	if err != nil {
+		return err
+	}
+	err = mgr.skipUnusedTimestamps(ctx, tx)
+	return commit(err)
+}
+
+// persists one skip executor per receiver, which delivers its unused
+// timestamps in order, and closes the reserved blocks. Only the open blocks
+// are looked up in TxExecutorHop, which also covers archived and compacted
+// executors. The blocks stay locked until the transaction ends and only the
+// scanned ones are skipped and closed.
+func (mgr *TxRecoveryManager) skipUnusedTimestamps(ctx context.Context, tx pgx.Tx) error {
+	blockQuery := `
+		SELECT prt, svc, ts
+		FROM TxSenderClocks
+		WHERE lo < ts
+		FOR UPDATE;
+	`
+
+	rows, err := tx.Query(ctx, blockQuery)
+	if err != nil {
+		return err
+	}
+	var partitions, timestamps []uint64
+	var services []string
+	for rows.Next() {
+		var partition, timestamp uint64
+		var service string
+		if err = rows.Scan(&partition, &service, &timestamp); err != nil {
+			rows.Close()
 			return err
 		}
+		partitions = append(partitions, partition)
+		services = append(services, service)
+		timestamps = append(timestamps, timestamp)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
 
-		reqs = append(reqs, req)
+	unusedQuery := `
+		SELECT c.prt, c.svc, c.origin, s.ts
+		FROM TxSenderClocks c
+		JOIN unnest(@partitions::BIGINT[], @services::VARCHAR[], @timestamps::BIGINT[]) AS b(prt, svc, ts)
+			ON b.prt = c.prt AND b.svc = c.svc AND b.ts = c.ts
+		CROSS JOIN LATERAL generate_series(c.lo + 1, c.ts) AS s(ts)
+		WHERE c.origin <> '' AND NOT EXISTS (
+			SELECT 1
+			FROM TxExecutorHop h
+			WHERE h.svc = c.svc AND h.prt = c.prt AND h.ts = s.ts
+		)
+		ORDER BY c.prt, c.svc, s.ts;
+	`
+	args := pgx.NamedArgs{
+		"partitions": partitions,
+		"services":   services,
+		"timestamps": timestamps,
 	}
 
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+	rows, err = tx.Query(ctx, unusedQuery, args)
+	if err != nil {
+		return err
 	}
-	for _, req := range reqs {
-		go recoveryRequest(client, req)
+	defer rows.Close()
+
+	var execCtxs []*TxExecutorContext
+	var last *TxExecutorContext
+	for rows.Next() {
+		var partition, timestamp uint64
+		var service, origin string
+		if err = rows.Scan(&partition, &service, &origin, &timestamp); err != nil {
+			return err
+		}
+		if last == nil || last.CtrlCtx.Partition != partition || last.Receivers[0] != service {
+			last = &TxExecutorContext{
+				CtrlCtx: &TxControlContext{Partition: partition, Service: origin},
+				Status:  ExecStatusSkip,
+			}
+			execCtxs = append(execCtxs, last)
+		}
+		last.Receivers = append(last.Receivers, service)
+		last.Timestamps = append(last.Timestamps, timestamp)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, execCtx := range execCtxs {
+		if err = InsertCheckpointExecutorContext(tx, execCtx); err != nil {
+			return err
+		}
+	}
+
+	// the skip executors take over the unused timestamps
+	closeQuery := `
+		UPDATE TxSenderClocks c
+		SET lo = c.ts
+		FROM unnest(@partitions::BIGINT[], @services::VARCHAR[], @timestamps::BIGINT[]) AS b(prt, svc, ts)
+		WHERE c.prt = b.prt AND c.svc = b.svc AND c.ts = b.ts;
+	`
+	_, err = tx.Exec(ctx, closeQuery, args)
+	return err
+}
+
+// Resend resumes an executor that no executor manager owns, e.g. one that was
+// dropped at shutdown and missed by recovery.
+func (mgr *TxRecoveryManager) Resend(execCtx *TxExecutorContext) error {
+	if execCtx.Status == ExecStatusSkip {
+		go mgr.execMgr.Send(NewTxExecutor(execCtx, mgr.checkpointer))
+		return nil
 	}
+
+	req, err := recoveryRequestOf(execCtx)
+	if err != nil {
+		return err
+	}
+	go recoveryRequest(mgr.client, req)
 	return nil
 }
 
+func recoveryRequestOf(execCtx *TxExecutorContext) (*http.Request, error) {
+	b, err := json.Marshal(execCtx.Input)
+	if err != nil {
+		return nil, errors.Join(err, format.ErrJsonEncode)
+	}
+
+	req, err := http.NewRequest(execCtx.Method, execCtx.Endpoint, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add(HeaderKeyExecCtx, execCtx.Encode())
+	return req, nil
+}
+
 // Future Work: concurrent retry
 // https://stackoverflow.com/questions/39791021/how-to-read-multiple-times-from-same-io-reader
 // https://stackoverflow.com/questions/19929386/handling-connection-reset-errors-in-go
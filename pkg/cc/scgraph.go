@@ -0,0 +1,397 @@
+package cc
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var (
+	ErrTxChainEmptyName = errors.New("empty tx chain name")
+	ErrTxChainEmptyHops = errors.New("empty tx chain hops")
+	ErrTxChainDuplicate = errors.New("duplicate tx chain")
+)
+
+type TxAccessOp int
+
+const (
+	TxAccessRead TxAccessOp = iota
+	TxAccessWrite
+	// inserts that commute with each other, e.g. an append-only log
+	TxAccessAppend
+)
+
+func (op TxAccessOp) String() string {
+	switch op {
+	case TxAccessRead:
+		return "read"
+	case TxAccessWrite:
+		return "write"
+	case TxAccessAppend:
+		return "append"
+	default:
+		return "unknown"
+	}
+}
+
+// two accesses to the same table conflict unless both are reads or both are appends
+func (op TxAccessOp) Conflicts(other TxAccessOp) bool {
+	if op == TxAccessRead && other == TxAccessRead {
+		return false
+	}
+	if op == TxAccessAppend && other == TxAccessAppend {
+		return false
+	}
+	return true
+}
+
+type TxAccess struct {
+	Table string
+	Op    TxAccessOp
+}
+
+type TxHop struct {
+	Name     string
+	Service  string
+	Accesses []TxAccess
+}
+
+func NewTxHop(name, service string) *TxHop {
+	return &TxHop{
+		Name:    name,
+		Service: service,
+	}
+}
+
+func (hop *TxHop) Read(tables ...string) *TxHop {
+	return hop.access(TxAccessRead, tables)
+}
+
+func (hop *TxHop) Write(tables ...string) *TxHop {
+	return hop.access(TxAccessWrite, tables)
+}
+
+func (hop *TxHop) Append(tables ...string) *TxHop {
+	return hop.access(TxAccessAppend, tables)
+}
+
+func (hop *TxHop) access(op TxAccessOp, tables []string) *TxHop {
+	for _, table := range tables {
+		hop.Accesses = append(hop.Accesses, TxAccess{Table: table, Op: op})
+	}
+	return hop
+}
+
+// Conflicts reports the first conflicting pair of accesses between two hops.
+// Tables are scoped by service, so only hops on the same service can conflict.
+func (hop *TxHop) Conflicts(other *TxHop) (TxAccess, TxAccess, bool) {
+	if hop.Service != other.Service {
+		return TxAccess{}, TxAccess{}, false
+	}
+	for _, a := range hop.Accesses {
+		for _, b := range other.Accesses {
+			if a.Table == b.Table && a.Op.Conflicts(b.Op) {
+				return a, b, true
+			}
+		}
+	}
+	return TxAccess{}, TxAccess{}, false
+}
+
+type TxChain struct {
+	Name string
+	Hops []*TxHop
+}
+
+func NewTxChain(name string) *TxChain {
+	return &TxChain{
+		Name: name,
+	}
+}
+
+func (chain *TxChain) Hop(hop *TxHop) *TxChain {
+	chain.Hops = append(chain.Hops, hop)
+	return chain
+}
+
+type TxChainRegistry struct {
+	chains []*TxChain
+}
+
+func NewTxChainRegistry() *TxChainRegistry {
+	return &TxChainRegistry{}
+}
+
+func (registry *TxChainRegistry) Declare(chains ...*TxChain) error {
+	for _, chain := range chains {
+		if chain.Name == "" {
+			return ErrTxChainEmptyName
+		}
+		if len(chain.Hops) == 0 {
+			return fmt.Errorf("%w: %s", ErrTxChainEmptyHops, chain.Name)
+		}
+		if registry.Chain(chain.Name) != nil {
+			return fmt.Errorf("%w: %s", ErrTxChainDuplicate, chain.Name)
+		}
+		registry.chains = append(registry.chains, chain)
+	}
+	return nil
+}
+
+func (registry *TxChainRegistry) Chain(name string) *TxChain {
+	for _, chain := range registry.chains {
+		if chain.Name == name {
+			return chain
+		}
+	}
+	return nil
+}
+
+func (registry *TxChainRegistry) Chains() []*TxChain {
+	return registry.chains
+}
+
+func (registry *TxChainRegistry) Analyze() *SCAnalysis {
+	return AnalyzeSCGraph(NewSCGraph(registry.chains))
+}
+
+type SCEdgeType int
+
+const (
+	SCEdgeSibling SCEdgeType = iota
+	SCEdgeConflict
+)
+
+func (t SCEdgeType) String() string {
+	switch t {
+	case SCEdgeSibling:
+		return "S"
+	case SCEdgeConflict:
+		return "C"
+	default:
+		return "?"
+	}
+}
+
+type SCNode struct {
+	Chain    *TxChain
+	Instance int
+	Hop      int
+}
+
+func (node SCNode) String() string {
+	hop := node.Chain.Hops[node.Hop]
+	return fmt.Sprintf("%s#%d.%s@%s", node.Chain.Name, node.Instance, hop.Name, hop.Service)
+}
+
+type SCEdge struct {
+	Type SCEdgeType
+	From int
+	To   int
+	// conflicting accesses of a C-edge
+	FromAccess TxAccess
+	ToAccess   TxAccess
+}
+
+// SCGraph is the SC-graph of Lynx (SOSP'13). Every chain is instantiated twice
+// so that conflicts between concurrent runs of the same chain are captured.
+type SCGraph struct {
+	Nodes []SCNode
+	Edges []SCEdge
+}
+
+const scGraphInstances = 2
+
+func NewSCGraph(chains []*TxChain) *SCGraph {
+	g := &SCGraph{}
+	for _, chain := range chains {
+		for instance := range scGraphInstances {
+			for hop := range chain.Hops {
+				g.Nodes = append(g.Nodes, SCNode{
+					Chain:    chain,
+					Instance: instance,
+					Hop:      hop,
+				})
+				// consecutive hops of a chain instance
+				if hop > 0 {
+					to := len(g.Nodes) - 1
+					g.Edges = append(g.Edges, SCEdge{
+						Type: SCEdgeSibling,
+						From: to - 1,
+						To:   to,
+					})
+				}
+			}
+		}
+	}
+
+	for i := range g.Nodes {
+		for j := i + 1; j < len(g.Nodes); j++ {
+			a, b := g.Nodes[i], g.Nodes[j]
+			if a.Chain == b.Chain && a.Instance == b.Instance {
+				continue
+			}
+			hopA, hopB := a.Chain.Hops[a.Hop], b.Chain.Hops[b.Hop]
+			accessA, accessB, ok := hopA.Conflicts(hopB)
+			if !ok {
+				continue
+			}
+			g.Edges = append(g.Edges, SCEdge{
+				Type:       SCEdgeConflict,
+				From:       i,
+				To:         j,
+				FromAccess: accessA,
+				ToAccess:   accessB,
+			})
+		}
+	}
+	return g
+}
+
+// SCCycle is a biconnected component of the SC-graph that holds both S-edges
+// and C-edges; any two of its edges lie on a common simple cycle, so it
+// contains at least one SC-cycle.
+type SCCycle struct {
+	Chains []string
+	Edges  []SCEdge
+}
+
+type SCAnalysis struct {
+	Graph  *SCGraph
+	Cycles []SCCycle
+	unsafe map[string]bool
+}
+
+// Safe reports whether the chain is not part of any SC-cycle, i.e. its hops may
+// run without origin ordering.
+func (analysis *SCAnalysis) Safe(chain string) bool {
+	return !analysis.unsafe[chain]
+}
+
+// Level is the weakest serialization level the chain may run at. Chains that
+// were not declared are always ordered.
+func (analysis *SCAnalysis) Level(chain string) SerializationLevel {
+	declared := slices.ContainsFunc(analysis.Graph.Nodes, func(node SCNode) bool {
+		return node.Chain.Name == chain
+	})
+	if !declared || !analysis.Safe(chain) {
+		return SerializationLevelOriginOrdering
+	}
+	return SerializationLevelNone
+}
+
+func (analysis *SCAnalysis) SafeChains() []string {
+	return analysis.chains(true)
+}
+
+func (analysis *SCAnalysis) UnsafeChains() []string {
+	return analysis.chains(false)
+}
+
+func (analysis *SCAnalysis) chains(safe bool) []string {
+	var names []string
+	for _, node := range analysis.Graph.Nodes {
+		name := node.Chain.Name
+		if analysis.Safe(name) == safe && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func AnalyzeSCGraph(g *SCGraph) *SCAnalysis {
+	analysis := &SCAnalysis{
+		Graph:  g,
+		unsafe: map[string]bool{},
+	}
+
+	for _, component := range biconnectedComponents(g) {
+		var hasS, hasC bool
+		for _, edge := range component {
+			switch edge.Type {
+			case SCEdgeSibling:
+				hasS = true
+			case SCEdgeConflict:
+				hasC = true
+			}
+		}
+		if !hasS || !hasC {
+			continue
+		}
+
+		cycle := SCCycle{
+			Edges: component,
+		}
+		for _, edge := range component {
+			for _, n := range []int{edge.From, edge.To} {
+				name := g.Nodes[n].Chain.Name
+				if !slices.Contains(cycle.Chains, name) {
+					cycle.Chains = append(cycle.Chains, name)
+				}
+				analysis.unsafe[name] = true
+			}
+		}
+		analysis.Cycles = append(analysis.Cycles, cycle)
+	}
+	return analysis
+}
+
+// Hopcroft-Tarjan edge partition into biconnected components
+func biconnectedComponents(g *SCGraph) [][]SCEdge {
+	adj := make([][]int, len(g.Nodes))
+	for i, edge := range g.Edges {
+		adj[edge.From] = append(adj[edge.From], i)
+		adj[edge.To] = append(adj[edge.To], i)
+	}
+
+	disc := make([]int, len(g.Nodes))
+	low := make([]int, len(g.Nodes))
+	time := 0
+	var stack []int
+	var components [][]SCEdge
+
+	var dfs func(u, parentEdge int)
+	dfs = func(u, parentEdge int) {
+		time++
+		disc[u] = time
+		low[u] = time
+		for _, e := range adj[u] {
+			if e == parentEdge {
+				continue
+			}
+			edge := g.Edges[e]
+			v := edge.To
+			if v == u {
+				v = edge.From
+			}
+			if disc[v] == 0 {
+				stack = append(stack, e)
+				dfs(v, e)
+				low[u] = min(low[u], low[v])
+				if low[v] >= disc[u] {
+					var component []SCEdge
+					for {
+						top := stack[len(stack)-1]
+						stack = stack[:len(stack)-1]
+						component = append(component, g.Edges[top])
+						if top == e {
+							break
+						}
+					}
+					components = append(components, component)
+				}
+			} else if disc[v] < disc[u] {
+				// back edge
+				stack = append(stack, e)
+				low[u] = min(low[u], disc[v])
+			}
+		}
+	}
+
+	for u := range g.Nodes {
+		if disc[u] == 0 {
+			dfs(u, -1)
+		}
+	}
+	return components
+}
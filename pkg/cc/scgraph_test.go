@@ -0,0 +1,86 @@
+package cc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSCGraph(t *testing.T) {
+	serviceA := "service-a"
+	serviceB := "service-b"
+
+	// a single hop chain only conflicts with itself through C-edges
+	single := NewTxChain("single").
+		Hop(NewTxHop("write", serviceA).Write("T1"))
+	// read-only and append-only chains never conflict with themselves
+	readOnly := NewTxChain("read_only").
+		Hop(NewTxHop("read", serviceA).Read("T2")).
+		Hop(NewTxHop("read", serviceB).Read("T3"))
+	appendOnly := NewTxChain("append_only").
+		Hop(NewTxHop("append", serviceA).Append("T4")).
+		Hop(NewTxHop("append", serviceB).Append("T5"))
+	// two instances write the same tables in two hops -> SC-cycle
+	transfer := NewTxChain("transfer").
+		Hop(NewTxHop("withdraw", serviceA).Write("T6")).
+		Hop(NewTxHop("deposit", serviceB).Write("T7"))
+
+	registry := NewTxChainRegistry()
+	err := registry.Declare(single, readOnly, appendOnly, transfer)
+	require.NoError(t, err)
+
+	analysis := registry.Analyze()
+	require.Equal(t, []string{"single", "read_only", "append_only"}, analysis.SafeChains())
+	require.Equal(t, []string{"transfer"}, analysis.UnsafeChains())
+	require.Len(t, analysis.Cycles, 1)
+	require.Equal(t, []string{"transfer"}, analysis.Cycles[0].Chains)
+	require.Equal(t, SerializationLevelNone, analysis.Level("read_only"))
+	require.Equal(t, SerializationLevelOriginOrdering, analysis.Level("transfer"))
+	// undeclared chains are never trusted
+	require.Equal(t, SerializationLevelOriginOrdering, analysis.Level("unknown"))
+
+	var sEdges, cEdges int
+	for _, edge := range analysis.Cycles[0].Edges {
+		switch edge.Type {
+		case SCEdgeSibling:
+			sEdges++
+		case SCEdgeConflict:
+			cEdges++
+		}
+	}
+	require.Equal(t, 2, sEdges)
+	require.Equal(t, 2, cEdges)
+}
+
+func TestSCGraphCrossChain(t *testing.T) {
+	serviceA := "service-a"
+	serviceB := "service-b"
+
+	// each chain alone is safe, but together they form an SC-cycle
+	writer := NewTxChain("writer").
+		Hop(NewTxHop("write", serviceA).Write("T1")).
+		Hop(NewTxHop("read", serviceB).Read("T2"))
+	reader := NewTxChain("reader").
+		Hop(NewTxHop("read", serviceA).Read("T1")).
+		Hop(NewTxHop("write", serviceB).Write("T2"))
+	// same table name on another service is a different table
+	other := NewTxChain("other").
+		Hop(NewTxHop("write", "service-c").Write("T1"))
+
+	registry := NewTxChainRegistry()
+	err := registry.Declare(writer)
+	require.NoError(t, err)
+	require.True(t, registry.Analyze().Safe("writer"))
+
+	err = registry.Declare(reader, other)
+	require.NoError(t, err)
+	analysis := registry.Analyze()
+	require.False(t, analysis.Safe("writer"))
+	require.False(t, analysis.Safe("reader"))
+	require.True(t, analysis.Safe("other"))
+
+	err = registry.Declare(NewTxChain("writer").Hop(NewTxHop("write", serviceA)))
+	require.ErrorIs(t, err, ErrTxChainDuplicate)
+	err = registry.Declare(NewTxChain("empty"))
+	require.ErrorIs(t, err, ErrTxChainEmptyHops)
+}
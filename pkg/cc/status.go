@@ -0,0 +1,83 @@
+package cc
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	PathTxExecutors = "/api/v1/tx/executors"
+)
+
+// TxExecutorLocation is the status resource of an executor.
+func TxExecutorLocation(execID uint64) string {
+	return fmt.Sprintf("%s/%d", PathTxExecutors, execID)
+}
+
+// TxExecutorAccepted answers a chain that runs asynchronously; its progress
+// is polled at TxExecutorLocation.
+type TxExecutorAccepted struct {
+	ExecID uint64 `json:"exec_id"`
+}
+
+// TxChainResult answers a coordinator request that waited for the downstream
+// hops of its chain.
+type TxChainResult struct {
+	// response of the commit stage
+	Response json.RawMessage  `json:"response"`
+	Executor TxExecutorStatus `json:"executor"`
+}
+
+// TxExecutorStatus is the progress of a chain as checkpointed by its
+// coordinator.
+type TxExecutorStatus struct {
+	ExecID uint64     `json:"exec_id"`
+	Status ExecStatus `json:"status"`
+	// aborted or completed, no more hops are sent
+	Done bool `json:"done"`
+	// index of the receiver the executor works on, len(receivers) once done
+	Hop        int      `json:"hop"`
+	Receivers  []string `json:"receivers"`
+	Timestamps []uint64 `json:"timestamps"`
+	// result of the commit stage
+	Result any `json:"result"`
+	// result of every hop that ran, indexed like receivers
+	Outputs []any `json:"outputs"`
+	// owned by the executor manager
+	Running bool `json:"running"`
+	// moved to TxExecutorArchive by the compactor
+	Archived bool `json:"archived"`
+}
+
+func NewTxExecutorStatus(status ExecStatus, execCtx *TxExecutorContext) TxExecutorStatus {
+	return TxExecutorStatus{
+		ExecID:     execCtx.ExecID,
+		Status:     status,
+		Done:       status == ExecStatusAborted || status == ExecStatusCompleted,
+		Hop:        currentHop(status, execCtx),
+		Receivers:  execCtx.Receivers,
+		Timestamps: execCtx.Timestamps,
+		Result:     execCtx.Result,
+		Outputs:    execCtx.Outputs,
+	}
+}
+
+// the commit stage sends hop 0, so stage i of a committed chain sends hop i+1;
+// skip executors walk the receivers directly
+func currentHop(status ExecStatus, execCtx *TxExecutorContext) int {
+	var hop int
+	switch status {
+	case ExecStatusPending:
+		hop = 0
+	case ExecStatusSkip:
+		hop = execCtx.Curr
+	case ExecStatusRollback:
+		// compensating the last executed stage
+		hop = execCtx.Curr
+	case ExecStatusAborted, ExecStatusCompleted:
+		hop = len(execCtx.Receivers)
+	default:
+		hop = execCtx.Curr + 1
+	}
+	return min(hop, len(execCtx.Receivers))
+}
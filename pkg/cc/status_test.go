@@ -0,0 +1,163 @@
+package cc
+
+import (
+	"context"
+	"testing"
+	"time"
+	"txchain/pkg/database"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func TestTxExecutorStatusHop(t *testing.T) {
+	receivers := []string{"service-a", "service-b", "service-c"}
+	tests := []struct {
+		status ExecStatus
+		curr   int
+		hop    int
+		done   bool
+	}{
+		{ExecStatusPending, 0, 0, false},
+		{ExecStatusCommitted, 0, 1, false},
+		{ExecStatusCommitted, 1, 2, false},
+		{ExecStatusCommitted, 2, 3, false},
+		{ExecStatusForceComplete, 1, 2, false},
+		{ExecStatusRollback, 1, 1, false},
+		{ExecStatusSkip, 2, 2, false},
+		{ExecStatusCompleted, 2, 3, true},
+		{ExecStatusAborted, 0, 3, true},
+	}
+	for _, test := range tests {
+		execCtx := &TxExecutorContext{
+			ExecID:     7,
+			Receivers:  receivers,
+			Timestamps: []uint64{1, 2, 3},
+			Curr:       test.curr,
+		}
+		status := NewTxExecutorStatus(test.status, execCtx)
+		require.Equal(t, test.hop, status.Hop, "%+v", test)
+		require.Equal(t, test.done, status.Done, "%+v", test)
+		require.Equal(t, uint64(7), status.ExecID)
+	}
+	require.Equal(t, "/api/v1/tx/executors/7", TxExecutorLocation(7))
+}
+
+func TestTxManagerExecutorStatus(t *testing.T) {
+	pgc, err := database.NewContainerTablesTx(t, "17.1")
+	defer func() {
+		if pgc != nil {
+			testcontainers.CleanupContainer(t, pgc.Container)
+		}
+	}()
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	conn, err := pgxpool.New(ctx, pgc.Endpoint())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	txMgr := NewTxManager(conn, 4, []string{"service-a"})
+
+	_, err = txMgr.ExecutorStatus(42)
+	require.ErrorIs(t, err, pgx.ErrNoRows)
+
+	execCtx := defaultExecCtx()
+	execCtx.Receivers = []string{"service-a", "service-b"}
+	execCtx.Timestamps = []uint64{3, 5}
+	execCtx.Status = ExecStatusCommitted
+	execCtx.Result = "created"
+	require.NoError(t, InsertCheckpointExecutorContext(conn, execCtx))
+
+	status, err := txMgr.ExecutorStatus(execCtx.ExecID)
+	require.NoError(t, err)
+	require.Equal(t, TxExecutorStatus{
+		ExecID:     execCtx.ExecID,
+		Status:     ExecStatusCommitted,
+		Hop:        1,
+		Receivers:  execCtx.Receivers,
+		Timestamps: execCtx.Timestamps,
+		Result:     "created",
+	}, status)
+
+	// finished executors are still found once archived
+	execCtx.Status = ExecStatusCompleted
+	execCtx.Curr = 1
+	require.NoError(t, UpdateCheckpointExecutorContext(conn, execCtx))
+	_, err = conn.Exec(ctx, `UPDATE TxExecutor SET updated_at = NOW() - INTERVAL '2 hours';`)
+	require.NoError(t, err)
+	compactor := NewTxResultCompactor(conn, TxResultCompactorOption{
+		ExecutorRetention: time.Hour,
+		Archive:           true,
+	})
+	n, err := compactor.CompactExecutors(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+
+	status, err = txMgr.ExecutorStatus(execCtx.ExecID)
+	require.NoError(t, err)
+	require.True(t, status.Done)
+	require.True(t, status.Archived)
+	require.Equal(t, 2, status.Hop)
+}
+
+func TestTxExecutorIdempotencyKey(t *testing.T) {
+	pgc, err := database.NewContainerTablesTx(t, "17.1")
+	defer func() {
+		if pgc != nil {
+			testcontainers.CleanupContainer(t, pgc.Container)
+		}
+	}()
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	conn, err := pgxpool.New(ctx, pgc.Endpoint())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	txMgr := NewTxManager(conn, 4, []string{"service-a"})
+	newExecCtx := func(service, key string) *TxExecutorContext {
+		execCtx := defaultExecCtx()
+		execCtx.CtrlCtx.Service = service
+		execCtx.CtrlCtx.IdempotencyKey = key
+		return execCtx
+	}
+
+	first := newExecCtx("service-a", "key-1")
+	first.Result = "created"
+	first.Status = ExecStatusCommitted
+	require.NoError(t, InsertCheckpointExecutorContext(conn, first))
+
+	// keys are unique per coordinator service
+	require.ErrorIs(t, InsertCheckpointExecutorContext(conn, newExecCtx("service-a", "key-1")), ErrTxExecutorDuplicate)
+	require.NoError(t, InsertCheckpointExecutorContext(conn, newExecCtx("service-b", "key-1")))
+	require.NoError(t, InsertCheckpointExecutorContext(conn, newExecCtx("service-a", "")))
+	require.NoError(t, InsertCheckpointExecutorContext(conn, newExecCtx("service-a", "")))
+
+	status, err := txMgr.ExecutorByKey("service-a", "key-1")
+	require.NoError(t, err)
+	require.Equal(t, first.ExecID, status.ExecID)
+	require.Equal(t, "created", status.Result)
+	_, err = txMgr.ExecutorByKey("service-a", "key-2")
+	require.ErrorIs(t, err, pgx.ErrNoRows)
+
+	// archived executors keep their key
+	first.Status = ExecStatusCompleted
+	require.NoError(t, UpdateCheckpointExecutorContext(conn, first))
+	_, err = conn.Exec(ctx, `UPDATE TxExecutor SET updated_at = NOW() - INTERVAL '2 hours' WHERE exec_id = $1;`, first.ExecID)
+	require.NoError(t, err)
+	compactor := NewTxResultCompactor(conn, TxResultCompactorOption{
+		ExecutorRetention: time.Hour,
+		Archive:           true,
+	})
+	n, err := compactor.CompactExecutors(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+
+	status, err = txMgr.ExecutorByKey("service-a", "key-1")
+	require.NoError(t, err)
+	require.Equal(t, first.ExecID, status.ExecID)
+	require.True(t, status.Archived)
+}
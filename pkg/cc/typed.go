@@ -0,0 +1,156 @@
+package cc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrTxExecDecode = errors.New("failed to decode tx executor value")
+)
+
+type TypedStageFunc[In, Out any] func(input In) (result Out, output In, err error)
+type TypedRollbackFunc[In any] func(input In) (output In, err error)
+type TypedCompleteFunc[In any] func(input In) (output In, err error)
+
+// TypedTxExecutor runs a chain whose state is In and whose result is Out.
+// Checkpoints are reloaded as plain JSON values, so the input and result are
+// decoded back into In and Out and recovered executors hand their stages the
+// same Go types as the original run.
+type TypedTxExecutor[In, Out any] struct {
+	exec *TxExecutor
+}
+
+func NewTypedTxExecutor[In, Out any](execCtx *TxExecutorContext, checkpointer CheckpointFunc) (*TypedTxExecutor[In, Out], error) {
+	input, err := DecodeTxExecValue[In](execCtx.Input)
+	if err != nil {
+		return nil, err
+	}
+	execCtx.Input = input
+
+	if execCtx.Result != nil {
+		result, err := DecodeTxExecValue[Out](execCtx.Result)
+		if err != nil {
+			return nil, err
+		}
+		execCtx.Result = result
+	}
+
+	return &TypedTxExecutor[In, Out]{
+		exec: NewTxExecutor(execCtx, checkpointer),
+	}, nil
+}
+
+func (exec *TypedTxExecutor[In, Out]) CommitStage(stage *TypedTxExecutorStage[In, Out]) *TypedTxExecutor[In, Out] {
+	exec.exec.CommitStage(stage.stage)
+	return exec
+}
+
+func (exec *TypedTxExecutor[In, Out]) Stage(stage *TypedTxExecutorStage[In, Out]) *TypedTxExecutor[In, Out] {
+	exec.exec.Stage(stage.stage)
+	return exec
+}
+
+// Executor returns the untyped executor, e.g. to send it to the TxExecutorManager.
+func (exec *TypedTxExecutor[In, Out]) Executor() *TxExecutor {
+	return exec.exec
+}
+
+func (exec *TypedTxExecutor[In, Out]) Context() *TxExecutorContext {
+	return exec.exec.execCtx
+}
+
+func (exec *TypedTxExecutor[In, Out]) Run() (Out, error) {
+	result, err := exec.exec.Run()
+	if err != nil {
+		var zero Out
+		return zero, err
+	}
+	return DecodeTxExecValue[Out](result)
+}
+
+func (exec *TypedTxExecutor[In, Out]) SyncRun() (Out, error) {
+	result, err := exec.exec.SyncRun()
+	out, decodeErr := DecodeTxExecValue[Out](result)
+	if err != nil {
+		return out, err
+	}
+	return out, decodeErr
+}
+
+type TypedTxExecutorStage[In, Out any] struct {
+	stage *TxExecutorStage
+}
+
+func NewTypedExecutorStage[In, Out any]() *TypedTxExecutorStage[In, Out] {
+	return &TypedTxExecutorStage[In, Out]{
+		stage: NewExecutorStage(),
+	}
+}
+
+func (stage *TypedTxExecutorStage[In, Out]) Stage(f TypedStageFunc[In, Out]) *TypedTxExecutorStage[In, Out] {
+	stage.stage.Stage(func(v any) (any, any, error) {
+		input, err := DecodeTxExecValue[In](v)
+		if err != nil {
+			return nil, nil, err
+		}
+		return f(input)
+	})
+	return stage
+}
+
+func (stage *TypedTxExecutorStage[In, Out]) RollbackStage(f TypedRollbackFunc[In]) *TypedTxExecutorStage[In, Out] {
+	stage.stage.RollbackStage(func(v any) (any, error) {
+		input, err := DecodeTxExecValue[In](v)
+		if err != nil {
+			return nil, err
+		}
+		return f(input)
+	})
+	return stage
+}
+
+func (stage *TypedTxExecutorStage[In, Out]) CompleteStage(f TypedCompleteFunc[In]) *TypedTxExecutorStage[In, Out] {
+	stage.stage.CompleteStage(func(v any) (any, error) {
+		input, err := DecodeTxExecValue[In](v)
+		if err != nil {
+			return nil, err
+		}
+		return f(input)
+	})
+	return stage
+}
+
+func (stage *TypedTxExecutorStage[In, Out]) Timeout(d time.Duration) *TypedTxExecutorStage[In, Out] {
+	stage.stage.Timeout(d)
+	return stage
+}
+
+// DecodeTxExecValue converts a value reloaded from a checkpoint into T. Values
+// that already are a T are returned as is, anything else goes through the same
+// JSON encoding the checkpoint used, so json tags are honoured.
+func DecodeTxExecValue[T any](v any) (T, error) {
+	var value T
+	switch v := v.(type) {
+	case T:
+		return v, nil
+	case nil:
+		return value, nil
+	case json.RawMessage:
+		if err := json.Unmarshal(v, &value); err != nil {
+			return value, fmt.Errorf("%w: %v", ErrTxExecDecode, err)
+		}
+		return value, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return value, fmt.Errorf("%w: %v", ErrTxExecDecode, err)
+	}
+	if err := json.Unmarshal(b, &value); err != nil {
+		return value, fmt.Errorf("%w: %v", ErrTxExecDecode, err)
+	}
+	return value, nil
+}
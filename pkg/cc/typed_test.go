@@ -0,0 +1,118 @@
+package cc
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type typedInput struct {
+	UserID string `json:"user_id"`
+	Values []int  `json:"values"`
+}
+
+type typedResult struct {
+	EventID uint64 `json:"event_id"`
+}
+
+func typedPushStage(i int) TypedStageFunc[typedInput, typedResult] {
+	return func(input typedInput) (typedResult, typedInput, error) {
+		input.Values = append(input.Values, i)
+		return typedResult{EventID: uint64(i)}, input, nil
+	}
+}
+
+func typedStages(exec *TypedTxExecutor[typedInput, typedResult]) *TypedTxExecutor[typedInput, typedResult] {
+	return exec.
+		CommitStage(NewTypedExecutorStage[typedInput, typedResult]().Stage(typedPushStage(1))).
+		Stage(NewTypedExecutorStage[typedInput, typedResult]().Stage(typedPushStage(2))).
+		Stage(NewTypedExecutorStage[typedInput, typedResult]().Stage(typedPushStage(3)))
+}
+
+func TestTypedTxExecutorRecovery(t *testing.T) {
+	var checkpoint []byte
+	checkpointer := func(execCtx *TxExecutorContext) error {
+		b, err := json.Marshal(execCtx)
+		checkpoint = b
+		return err
+	}
+
+	execCtx := defaultExecCtx()
+	execCtx.Input = typedInput{UserID: "alice"}
+	exec, err := NewTypedTxExecutor[typedInput, typedResult](execCtx, checkpointer)
+	require.NoError(t, err)
+	exec = typedStages(exec)
+
+	result, err := exec.Run()
+	require.NoError(t, err)
+	require.Equal(t, typedResult{EventID: 1}, result)
+
+	require.True(t, exec.Executor().Next())
+	require.NoError(t, exec.Executor().Execute())
+	require.NoError(t, exec.Executor().Checkpoint())
+
+	// reloaded checkpoints hold plain JSON values
+	var recoveredCtx *TxExecutorContext
+	require.NoError(t, json.Unmarshal(checkpoint, &recoveredCtx))
+	require.IsType(t, map[string]any{}, recoveredCtx.Input)
+	require.IsType(t, map[string]any{}, recoveredCtx.Result)
+
+	recovered, err := NewTypedTxExecutor[typedInput, typedResult](recoveredCtx, checkpointer)
+	require.NoError(t, err)
+	recovered = typedStages(recovered)
+	require.Equal(t, typedInput{UserID: "alice", Values: []int{1, 2}}, recovered.Context().Input)
+
+	result, err = recovered.SyncRun()
+	require.NoError(t, err)
+	require.Equal(t, typedResult{EventID: 1}, result)
+	require.Equal(t, typedInput{UserID: "alice", Values: []int{1, 2, 3}}, recovered.Context().Input)
+}
+
+func TestTypedTxExecutorRollback(t *testing.T) {
+	var rolledBack []typedInput
+	pop := func(input typedInput) (typedInput, error) {
+		rolledBack = append(rolledBack, input)
+		input.Values = input.Values[:len(input.Values)-1]
+		return input, nil
+	}
+
+	execCtx := defaultExecCtx()
+	execCtx.Input = map[string]any{"user_id": "bob", "values": []any{float64(1)}}
+	execCtx.Status = ExecStatusRollback
+	execCtx.Curr = 1
+	exec, err := NewTypedTxExecutor[typedInput, typedResult](execCtx, func(*TxExecutorContext) error { return nil })
+	require.NoError(t, err)
+	exec.
+		CommitStage(NewTypedExecutorStage[typedInput, typedResult]().Stage(typedPushStage(1))).
+		Stage(NewTypedExecutorStage[typedInput, typedResult]().Stage(typedPushStage(2)).RollbackStage(pop))
+
+	require.True(t, exec.Executor().Next())
+	require.NoError(t, exec.Executor().Rollback())
+	require.Equal(t, []typedInput{{UserID: "bob", Values: []int{1}}}, rolledBack)
+	require.Equal(t, typedInput{UserID: "bob", Values: []int{}}, exec.Context().Input)
+}
+
+func TestDecodeTxExecValue(t *testing.T) {
+	value, err := DecodeTxExecValue[typedInput](typedInput{UserID: "a"})
+	require.NoError(t, err)
+	require.Equal(t, typedInput{UserID: "a"}, value)
+
+	value, err = DecodeTxExecValue[typedInput](nil)
+	require.NoError(t, err)
+	require.Equal(t, typedInput{}, value)
+
+	value, err = DecodeTxExecValue[typedInput](json.RawMessage(`{"user_id":"b","values":[4]}`))
+	require.NoError(t, err)
+	require.Equal(t, typedInput{UserID: "b", Values: []int{4}}, value)
+
+	pointer, err := DecodeTxExecValue[*typedInput](map[string]any{"user_id": "c"})
+	require.NoError(t, err)
+	require.Equal(t, &typedInput{UserID: "c"}, pointer)
+
+	_, err = DecodeTxExecValue[typedInput](map[string]any{"values": "not a list"})
+	require.ErrorIs(t, err, ErrTxExecDecode)
+
+	_, err = NewTypedTxExecutor[typedInput, typedResult](&TxExecutorContext{Input: []any{1}}, nil)
+	require.ErrorIs(t, err, ErrTxExecDecode)
+}
@@ -0,0 +1,305 @@
+package cc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+	"txchain/pkg/format"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrTxWebhookInvalid       = errors.New("invalid tx webhook")
+	ErrTxWebhookHost          = errors.New("tx webhook host is not allowed")
+	ErrTxWebhookRequest       = errors.New("failed to perform webhook request")
+	ErrTxWebhookRejected      = errors.New("tx webhook rejected the notification")
+	ErrTxWebhookEmptyNotifier = errors.New("empty tx webhook notifier")
+	ErrTxWebhookOutbox        = errors.New("failed to deliver tx webhook outbox")
+	ErrTxWebhookShutdown      = errors.New("tx webhook outbox did not stop in time")
+)
+
+// NotifyFunc posts the terminal status of a chain to its webhook.
+type NotifyFunc = func(webhook string, status TxExecutorStatus) error
+
+// ValidateWebhook accepts absolute http and https urls whose host, with or
+// without its port, is one of hosts. No webhook is accepted without hosts.
+func ValidateWebhook(webhook string, hosts []string) error {
+	u, err := url.ParseRequestURI(webhook)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrTxWebhookInvalid, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return fmt.Errorf("%w: %s", ErrTxWebhookInvalid, webhook)
+	}
+	if !slices.ContainsFunc(hosts, func(host string) bool {
+		return strings.EqualFold(host, u.Host) || strings.EqualFold(host, u.Hostname())
+	}) {
+		return fmt.Errorf("%w: %s", ErrTxWebhookHost, u.Host)
+	}
+	return nil
+}
+
+// HTTPNotifier posts the status of a finished chain to its webhook. Client
+// errors other than timeouts and throttling are never retried. Redirects are
+// not followed, they could leave the allowed hosts.
+func HTTPNotifier(client *http.Client) NotifyFunc {
+	noRedirect := *client
+	noRedirect.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return func(webhook string, status TxExecutorStatus) error {
+		b, err := json.Marshal(status)
+		if err != nil {
+			return errors.Join(err, format.ErrJsonEncode)
+		}
+
+		req, err := http.NewRequest(http.MethodPost, webhook, bytes.NewReader(b))
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrTxWebhookRejected, err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := noRedirect.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		switch {
+		case resp.StatusCode < 300:
+			return nil
+		case resp.StatusCode == http.StatusRequestTimeout,
+			resp.StatusCode == http.StatusTooManyRequests,
+			resp.StatusCode >= 500:
+			return fmt.Errorf("%w: %d", ErrTxWebhookRequest, resp.StatusCode)
+		default:
+			return fmt.Errorf("%w: %d", ErrTxWebhookRejected, resp.StatusCode)
+		}
+	}
+}
+
+const (
+	DefaultWebhookInterval    = time.Second
+	DefaultWebhookMaxAttempts = 10
+	DefaultWebhookBatchSize   = 100
+)
+
+type TxWebhookOutboxOption struct {
+	// time between two deliveries of the due notifications
+	Interval time.Duration
+	// posts of a notification before it is given up
+	MaxAttempts int
+	// notifications posted per delivery
+	BatchSize int
+}
+
+// TxWebhookOutbox posts the notifications queued in TxWebhookOutbox by the
+// terminal checkpoints. A failed post is retried after the backoff of its
+// attempts until MaxAttempts, a rejected one or one whose host is no longer
+// allowed is dropped.
+type TxWebhookOutbox struct {
+	conn        *pgxpool.Pool
+	notifier    NotifyFunc
+	retryFunc   RetryFunc
+	hosts       []string
+	interval    time.Duration
+	maxAttempts int
+	batchSize   int
+	lifecycle
+}
+
+type webhookNotification struct {
+	outboxID uint64
+	webhook  string
+	status   TxExecutorStatus
+	attempts int
+}
+
+func NewTxWebhookOutbox(conn *pgxpool.Pool, options ...TxWebhookOutboxOption) *TxWebhookOutbox {
+	var option TxWebhookOutboxOption
+	if len(options) > 0 {
+		option = options[0]
+	}
+	if option.Interval <= 0 {
+		option.Interval = DefaultWebhookInterval
+	}
+	if option.MaxAttempts <= 0 {
+		option.MaxAttempts = DefaultWebhookMaxAttempts
+	}
+	if option.BatchSize <= 0 {
+		option.BatchSize = DefaultWebhookBatchSize
+	}
+
+	return &TxWebhookOutbox{
+		conn:        conn,
+		notifier:    emptyNotifier,
+		retryFunc:   ExponentialBackoffRetry(time.Minute),
+		interval:    option.Interval,
+		maxAttempts: option.MaxAttempts,
+		batchSize:   option.BatchSize,
+		lifecycle:   newLifecycle(),
+	}
+}
+
+func emptyNotifier(webhook string, status TxExecutorStatus) error {
+	return ErrTxWebhookEmptyNotifier
+}
+
+func (o *TxWebhookOutbox) Notifier(f NotifyFunc) *TxWebhookOutbox {
+	o.notifier = f
+	return o
+}
+
+// Hosts sets the hosts webhooks may be posted to.
+func (o *TxWebhookOutbox) Hosts(hosts []string) *TxWebhookOutbox {
+	o.hosts = hosts
+	return o
+}
+
+// AllowedHosts returns the hosts webhooks may be posted to, coordinators
+// reject the other webhooks.
+func (o *TxWebhookOutbox) AllowedHosts() []string {
+	return o.hosts
+}
+
+func (o *TxWebhookOutbox) RetryFunc(f RetryFunc) *TxWebhookOutbox {
+	o.retryFunc = f
+	return o
+}
+
+// Start runs the outbox in a new goroutine.
+func (o *TxWebhookOutbox) Start() {
+	o.goLoop(o.run)
+}
+
+// Run delivers the due notifications every interval until Shutdown is called.
+func (o *TxWebhookOutbox) Run() {
+	o.runLoop(o.run)
+}
+
+func (o *TxWebhookOutbox) run() {
+	ticker := time.NewTicker(o.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-o.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), o.interval)
+			if _, err := o.Deliver(ctx); err != nil {
+				log.Println("deliver tx webhooks:", err)
+			}
+			cancel()
+		}
+	}
+}
+
+func (o *TxWebhookOutbox) Shutdown(ctx context.Context) error {
+	return o.shutdown(ctx, ErrTxWebhookShutdown, nil)
+}
+
+// Deliver posts the due notifications once and returns how many were posted.
+func (o *TxWebhookOutbox) Deliver(ctx context.Context) (int, error) {
+	notifications, err := o.due(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrTxWebhookOutbox, err)
+	}
+
+	delivered := 0
+	var errs []error
+	for _, n := range notifications {
+		if o.stopped() {
+			break
+		}
+		err := ValidateWebhook(n.webhook, o.hosts)
+		if err == nil {
+			err = o.notifier(n.webhook, n.status)
+		}
+		switch {
+		case err == nil:
+			delivered++
+			err = o.remove(ctx, n.outboxID)
+		case errors.Is(err, ErrTxWebhookInvalid),
+			errors.Is(err, ErrTxWebhookHost),
+			errors.Is(err, ErrTxWebhookRejected),
+			n.attempts+1 >= o.maxAttempts:
+			log.Println("give up tx webhook:", n.status.ExecID, err)
+			err = o.remove(ctx, n.outboxID)
+		default:
+			err = o.postpone(ctx, n.outboxID, o.retryFunc(n.attempts+1))
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return delivered, fmt.Errorf("%w: %v", ErrTxWebhookOutbox, err)
+	}
+	return delivered, nil
+}
+
+func (o *TxWebhookOutbox) due(ctx context.Context) ([]webhookNotification, error) {
+	query := `
+		SELECT outbox_id, webhook, content, attempts
+		FROM TxWebhookOutbox
+		WHERE next_at <= NOW()
+		ORDER BY next_at, outbox_id
+		LIMIT @limit;
+	`
+	args := pgx.NamedArgs{
+		"limit": o.batchSize,
+	}
+
+	rows, err := o.conn.Query(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []webhookNotification
+	for rows.Next() {
+		var n webhookNotification
+		var b []byte
+		if err := rows.Scan(&n.outboxID, &n.webhook, &b, &n.attempts); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &n.status); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+func (o *TxWebhookOutbox) remove(ctx context.Context, outboxID uint64) error {
+	query := `
+		DELETE FROM TxWebhookOutbox
+		WHERE outbox_id = $1;
+	`
+	_, err := o.conn.Exec(ctx, query, outboxID)
+	return err
+}
+
+func (o *TxWebhookOutbox) postpone(ctx context.Context, outboxID uint64, d time.Duration) error {
+	query := `
+		UPDATE TxWebhookOutbox
+		SET
+			attempts = attempts + 1,
+			next_at = NOW() + $2 * INTERVAL '1 millisecond'
+		WHERE outbox_id = $1;
+	`
+	_, err := o.conn.Exec(ctx, query, outboxID, d.Milliseconds())
+	return err
+}
@@ -0,0 +1,160 @@
+package cc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"txchain/pkg/database"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func TestHTTPNotifier(t *testing.T) {
+	codes := []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusBadRequest, http.StatusNoContent, http.StatusFound}
+	var received []TxExecutorStatus
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var status TxExecutorStatus
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&status))
+		received = append(received, status)
+		if codes[0] == http.StatusFound {
+			w.Header().Set("Location", "http://169.254.169.254/")
+		}
+		w.WriteHeader(codes[0])
+		codes = codes[1:]
+	}))
+	defer server.Close()
+
+	notify := HTTPNotifier(server.Client())
+	status := TxExecutorStatus{ExecID: 7, Status: ExecStatusCompleted, Done: true}
+	require.ErrorIs(t, notify(server.URL, status), ErrTxWebhookRequest)
+	require.ErrorIs(t, notify(server.URL, status), ErrTxWebhookRequest)
+	require.ErrorIs(t, notify(server.URL, status), ErrTxWebhookRejected)
+	require.NoError(t, notify(server.URL, status))
+	require.Len(t, received, 4)
+	require.Equal(t, uint64(7), received[3].ExecID)
+
+	// redirects are not followed
+	require.ErrorIs(t, notify(server.URL, status), ErrTxWebhookRejected)
+	require.Len(t, received, 5)
+}
+
+func TestValidateWebhook(t *testing.T) {
+	hosts := []string{"example.com", "hooks.local:8080"}
+	require.NoError(t, ValidateWebhook("https://example.com/hooks", hosts))
+	require.NoError(t, ValidateWebhook("http://example.com:9000/hooks", hosts))
+	require.NoError(t, ValidateWebhook("http://hooks.local:8080/hooks", hosts))
+	require.ErrorIs(t, ValidateWebhook("ftp://example.com/hooks", hosts), ErrTxWebhookInvalid)
+	require.ErrorIs(t, ValidateWebhook("/hooks", hosts), ErrTxWebhookInvalid)
+	require.ErrorIs(t, ValidateWebhook("http://user@example.com/hooks", hosts), ErrTxWebhookInvalid)
+	require.ErrorIs(t, ValidateWebhook("http://hooks.local:9000/hooks", hosts), ErrTxWebhookHost)
+	require.ErrorIs(t, ValidateWebhook("http://169.254.169.254/latest", hosts), ErrTxWebhookHost)
+	require.ErrorIs(t, ValidateWebhook("https://example.com/hooks", nil), ErrTxWebhookHost)
+}
+
+func TestCheckpointArgs(t *testing.T) {
+	execCtx := defaultExecCtx()
+	execCtx.ExecID = 3
+	execCtx.CtrlCtx.Webhook = "http://hooks/chain"
+
+	// the webhook is only queued with the terminal checkpoint
+	execCtx.Status = ExecStatusCommitted
+	args, err := checkpointArgs(execCtx)
+	require.NoError(t, err)
+	require.Equal(t, "", args[3])
+	require.Nil(t, args[4])
+
+	execCtx.Status = ExecStatusCompleted
+	args, err = checkpointArgs(execCtx)
+	require.NoError(t, err)
+	require.Equal(t, "http://hooks/chain", args[3])
+	var status TxExecutorStatus
+	require.NoError(t, json.Unmarshal(args[4].([]byte), &status))
+	require.Equal(t, uint64(3), status.ExecID)
+	require.True(t, status.Done)
+}
+
+func TestTxWebhookOutbox(t *testing.T) {
+	pgc, err := database.NewContainerTablesTx(t, "17.1")
+	defer func() {
+		if pgc != nil {
+			testcontainers.CleanupContainer(t, pgc.Container)
+		}
+	}()
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	conn, err := pgxpool.New(ctx, pgc.Endpoint())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	codes := []int{http.StatusServiceUnavailable, http.StatusNoContent}
+	var received []TxExecutorStatus
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var status TxExecutorStatus
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&status))
+		received = append(received, status)
+		w.WriteHeader(codes[0])
+		codes = codes[1:]
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	outbox := NewTxWebhookOutbox(conn, TxWebhookOutboxOption{MaxAttempts: 2}).
+		Notifier(HTTPNotifier(server.Client())).
+		Hosts([]string{u.Host}).
+		RetryFunc(ConstantRetry(0))
+
+	insert := func(webhook string) *TxExecutorContext {
+		execCtx := defaultExecCtx()
+		execCtx.CtrlCtx.Webhook = webhook
+		require.NoError(t, InsertCheckpointExecutorContext(conn, execCtx))
+		execCtx.Status = ExecStatusCompleted
+		require.NoError(t, UpdateCheckpointExecutorContext(conn, execCtx))
+		// a checkpoint written again does not queue the webhook twice
+		require.NoError(t, UpdateCheckpointExecutorContext(conn, execCtx))
+		return execCtx
+	}
+	queued := func() int {
+		var n int
+		require.NoError(t, conn.QueryRow(ctx, `SELECT COUNT(*) FROM TxWebhookOutbox;`).Scan(&n))
+		return n
+	}
+
+	execCtx := insert(server.URL + "/hooks")
+	// a host that is no longer allowed is dropped without a post
+	insert("http://169.254.169.254/latest")
+	require.Equal(t, 2, queued())
+
+	// a failed post is retried
+	n, err := outbox.Deliver(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+	require.Equal(t, 1, queued())
+
+	n, err = outbox.Deliver(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Equal(t, 0, queued())
+	require.Len(t, received, 2)
+	require.Equal(t, execCtx.ExecID, received[1].ExecID)
+	require.Equal(t, ExecStatusCompleted, received[1].Status)
+
+	// the retries are bounded
+	codes = []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable}
+	insert(server.URL + "/hooks")
+	for range 2 {
+		_, err = outbox.Deliver(ctx)
+		require.NoError(t, err)
+	}
+	require.Equal(t, 0, queued())
+	require.Len(t, received, 4)
+
+	outbox.Start()
+	require.NoError(t, outbox.Shutdown(ctx))
+}
@@ -51,13 +51,16 @@ const (
 	testDBPassword = "postgres"
 	testDBData     = "/data/postgres"
 
-	tableUser             = "Users"
-	tableEvent            = "Events"
-	tableEventLog         = "EventLogs"
-	tableTxResult         = "TxResult"
-	tableTxExecutor       = "TxExecutor"
-	tableTxSenderClocks   = "TxSenderClocks"
-	tableTxReceiverClocks = "TxReceiverClocks"
+	tableUser              = "Users"
+	tableEvent             = "Events"
+	tableEventLog          = "EventLogs"
+	tableTxResult          = "TxResult"
+	tableTxResultArchive   = "TxResultArchive"
+	tableTxExecutor        = "TxExecutor"
+	tableTxExecutorArchive = "TxExecutorArchive"
+	tableTxSenderClocks    = "TxSenderClocks"
+	tableTxReceiverClocks  = "TxReceiverClocks"
+	tableTxWebhookOutbox   = "TxWebhookOutbox"
 
 	scriptUser     = "schema/users.sql"
 	scriptEvent    = "schema/events.sql"
@@ -66,7 +69,7 @@ const (
 )
 
 var (
-	txTables       = []string{tableTxResult, tableTxExecutor, tableTxSenderClocks, tableTxReceiverClocks}
+	txTables       = []string{tableTxResult, tableTxResultArchive, tableTxExecutor, tableTxExecutorArchive, tableTxSenderClocks, tableTxReceiverClocks, tableTxWebhookOutbox}
 	userTables     = append(txTables, tableUser)
 	eventTables    = append(txTables, tableEvent)
 	eventLogTables = append(txTables, tableEventLog)
@@ -47,11 +47,20 @@ type TableEvent struct {
 
 var _ EventStore = (*TableEvent)(nil)
 
-func NewTableEvent(conn *pgxpool.Pool) *TableEvent {
-	return &TableEvent{
+func NewTableEvent(conn *pgxpool.Pool, hooks ...TxHooks) *TableEvent {
+	table := &TableEvent{
 		conn:    conn,
 		TxTable: NewTxTable[EventStoreAPI](conn),
 	}
+	table.InstallHooks(
+		hooks,
+		EventStoreAPICreateEvent,
+		EventStoreAPIUpdateEvent,
+		EventStoreAPIDeleteEvent,
+		EventStoreAPIAddParticipant,
+		EventStoreAPIRemoveParticipant,
+	)
+	return table
 }
 
 func (table *TableEvent) GetEvent(ctx context.Context, eventID int64) (*Event, error) {
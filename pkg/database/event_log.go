@@ -52,11 +52,13 @@ type TableEventLog struct {
 	conn *pgxpool.Pool
 }
 
-func NewTableEventLog(conn *pgxpool.Pool) *TableEventLog {
-	return &TableEventLog{
+func NewTableEventLog(conn *pgxpool.Pool, hooks ...TxHooks) *TableEventLog {
+	table := &TableEventLog{
 		conn:    conn,
 		TxTable: NewTxTable[EventLogStoreAPI](conn),
 	}
+	table.InstallHooks(hooks, EventLogStoreAPICreateEventLog)
+	return table
 }
 
 func (table *TableEventLog) CreateEventLog(
@@ -69,7 +71,7 @@ func (table *TableEventLog) CreateEventLog(
 
 	lifecycle := NewTxLifeCycle[EventLogStoreAPI, int64](table.TxTable)
 	return lifecycle.Start(
-		EventLogStoreAPIGetEventLogs,
+		EventLogStoreAPICreateEventLog,
 		ctx,
 		func(ctx context.Context, tx pgx.Tx) (int64, error) {
 			var content string
@@ -1,13 +1,22 @@
 
--- local timestamp
+-- local timestamp, (lo, ts] is the block reserved by origin
 CREATE TABLE IF NOT EXISTS TxSenderClocks (
   clock_id BIGINT GENERATED ALWAYS AS IDENTITY,
   prt BIGINT NOT NULL,
   svc VARCHAR(20) NOT NULL,
   ts BIGINT NOT NULL,
+  lo BIGINT NOT NULL DEFAULT 0,
+  origin VARCHAR(20) NOT NULL DEFAULT '',
   UNIQUE (svc, prt)
 );
 
+-- databases created before the blocks: the clocks reserved nothing, so their
+-- blocks are closed instead of being skipped as unused on recovery
+ALTER TABLE TxSenderClocks ADD COLUMN IF NOT EXISTS lo BIGINT;
+UPDATE TxSenderClocks SET lo = ts WHERE lo IS NULL;
+ALTER TABLE TxSenderClocks ALTER COLUMN lo SET DEFAULT 0, ALTER COLUMN lo SET NOT NULL;
+ALTER TABLE TxSenderClocks ADD COLUMN IF NOT EXISTS origin VARCHAR(20) NOT NULL DEFAULT '';
+
 CREATE TABLE IF NOT EXISTS TxReceiverClocks (
   clock_id BIGINT GENERATED ALWAYS AS IDENTITY,
   prt BIGINT NOT NULL,
@@ -16,19 +25,137 @@ CREATE TABLE IF NOT EXISTS TxReceiverClocks (
   UNIQUE (svc, prt)
 );
 
--- local executor information
+-- unordered hops delivered above the receiver clock
+CREATE TABLE IF NOT EXISTS TxReceiverDone (
+  done_id BIGINT GENERATED ALWAYS AS IDENTITY,
+  prt BIGINT NOT NULL,
+  svc VARCHAR(20) NOT NULL,
+  ts BIGINT NOT NULL,
+  UNIQUE (svc, prt, ts)
+);
+
+-- local executor information, idem_key is the client idempotency key of the
+-- coordinator service svc
 CREATE TABLE IF NOT EXISTS TxExecutor (
   exec_id BIGINT GENERATED ALWAYS AS IDENTITY,
   status BIGINT NOT NULL,
-  checkpoint JSONB NOT NULL
+  checkpoint JSONB NOT NULL,
+  svc VARCHAR(20) NOT NULL DEFAULT '',
+  idem_key VARCHAR(255),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (exec_id)
+);
+
+-- databases created before the archive
+ALTER TABLE TxExecutor ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+DO $$
+BEGIN
+  IF NOT EXISTS (
+    SELECT 1 FROM pg_constraint
+    WHERE conrelid = 'txexecutor'::regclass AND contype = 'p'
+  ) THEN
+    ALTER TABLE TxExecutor ADD PRIMARY KEY (exec_id);
+  END IF;
+END $$;
+
+-- recovery pages through the unfinished executors
+CREATE INDEX IF NOT EXISTS TxExecutorStatusIndex ON TxExecutor (status, exec_id);
+
+-- databases created before the idempotency keys
+ALTER TABLE TxExecutor ADD COLUMN IF NOT EXISTS svc VARCHAR(20) NOT NULL DEFAULT '';
+ALTER TABLE TxExecutor ADD COLUMN IF NOT EXISTS idem_key VARCHAR(255);
+
+-- a retried client request finds the chain it started
+CREATE UNIQUE INDEX IF NOT EXISTS TxExecutorIdempotencyIndex ON TxExecutor (svc, idem_key)
+  WHERE idem_key IS NOT NULL;
+
+-- timestamp sent to the receiver svc by each hop of an executor, so they are
+-- found without reading the checkpoints. Rows outlive archived and compacted
+-- executors until the block of their timestamp is closed.
+CREATE TABLE IF NOT EXISTS TxExecutorHop (
+  hop_id BIGINT GENERATED ALWAYS AS IDENTITY,
+  exec_id BIGINT NOT NULL,
+  prt BIGINT NOT NULL,
+  svc VARCHAR(20) NOT NULL,
+  ts BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS TxExecutorHopIndex ON TxExecutorHop (svc, prt, ts);
+
+-- terminal status of a chain waiting to be posted to its webhook, written with
+-- the terminal checkpoint
+CREATE TABLE IF NOT EXISTS TxWebhookOutbox (
+  outbox_id BIGINT GENERATED ALWAYS AS IDENTITY,
+  exec_id BIGINT NOT NULL,
+  webhook TEXT NOT NULL,
+  content JSONB NOT NULL,
+  attempts BIGINT NOT NULL DEFAULT 0,
+  next_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (outbox_id),
+  UNIQUE (exec_id)
+);
+
+CREATE INDEX IF NOT EXISTS TxWebhookOutboxDueIndex ON TxWebhookOutbox (next_at);
+
+-- finished executors past their retention
+CREATE TABLE IF NOT EXISTS TxExecutorArchive (
+  exec_id BIGINT NOT NULL,
+  status BIGINT NOT NULL,
+  checkpoint JSONB NOT NULL,
+  svc VARCHAR(20) NOT NULL DEFAULT '',
+  idem_key VARCHAR(255),
+  updated_at TIMESTAMPTZ NOT NULL,
+  archived_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (exec_id)
 );
 
+ALTER TABLE TxExecutorArchive ADD COLUMN IF NOT EXISTS svc VARCHAR(20) NOT NULL DEFAULT '';
+ALTER TABLE TxExecutorArchive ADD COLUMN IF NOT EXISTS idem_key VARCHAR(255);
+
+CREATE INDEX IF NOT EXISTS TxExecutorArchiveIdempotencyIndex ON TxExecutorArchive (svc, idem_key)
+  WHERE idem_key IS NOT NULL;
+
 -- result for all partitions
 CREATE TABLE IF NOT EXISTS TxResult (
   result_id BIGINT GENERATED ALWAYS AS IDENTITY,
   prt BIGINT NOT NULL,
   svc VARCHAR(20) NOT NULL,
   ts BIGINT NOT NULL,
+  -- compensations reuse the timestamp of the hop they undo
+  rollback BOOLEAN NOT NULL DEFAULT FALSE,
   content JSONB,
-  UNIQUE (svc, prt, ts)
-);
\ No newline at end of file
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE (svc, prt, ts, rollback)
+);
+
+-- databases created before the compaction
+ALTER TABLE TxResult ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+-- databases created before the compensation results
+ALTER TABLE TxResult ADD COLUMN IF NOT EXISTS rollback BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE TxResult DROP CONSTRAINT IF EXISTS txresult_svc_prt_ts_key;
+
+DO $$
+BEGIN
+  IF NOT EXISTS (
+    SELECT 1 FROM pg_constraint
+    WHERE conrelid = 'txresult'::regclass AND conname = 'txresult_svc_prt_ts_rollback_key'
+  ) THEN
+    ALTER TABLE TxResult ADD CONSTRAINT txresult_svc_prt_ts_rollback_key UNIQUE (svc, prt, ts, rollback);
+  END IF;
+END $$;
+
+-- results compacted below the watermarks
+CREATE TABLE IF NOT EXISTS TxResultArchive (
+  result_id BIGINT GENERATED ALWAYS AS IDENTITY,
+  prt BIGINT NOT NULL,
+  svc VARCHAR(20) NOT NULL,
+  ts BIGINT NOT NULL,
+  rollback BOOLEAN NOT NULL DEFAULT FALSE,
+  content JSONB,
+  created_at TIMESTAMPTZ NOT NULL,
+  archived_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE TxResultArchive ADD COLUMN IF NOT EXISTS rollback BOOLEAN NOT NULL DEFAULT FALSE;
\ No newline at end of file
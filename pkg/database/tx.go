@@ -2,12 +2,13 @@ package database
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"txchain/pkg/format"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/mitchellh/mapstructure"
 )
 
 type contextKey int
@@ -18,11 +19,13 @@ const (
 
 var (
 	ErrNoTxResult           = errors.New("no tx result")
+	ErrTxResultDecode       = errors.New("failed to decode recorded tx result")
 	ErrTxAlreadyExecuted    = errors.New("tx had already executed")
 	ErrLifeCycleStartHooks  = errors.New("failed to execute lifecycle start hooks")
 	ErrLifeCycleBeforeHooks = errors.New("failed to execute lifecycle before hooks")
 	ErrLifeCycleAfterHooks  = errors.New("failed to execute lifecycle after hooks")
 	ErrLifeCycleEndHooks    = errors.New("failed to execute lifecycle end hooks")
+	ErrLifeCyclePanic       = errors.New("lifecycle panicked")
 )
 
 type HookFunc = func(ctx context.Context) error
@@ -42,26 +45,22 @@ func UnwrapResult[R any](
 	ctx context.Context,
 	resultFunc func(ctx context.Context) (R, error)) (R, error) {
 	r, err := resultFunc(ctx)
-	if err == nil {
-		return r, nil
-	}
-	panic(err)
-
-	if !errors.Is(err, ErrTxAlreadyExecuted) {
+	if err == nil || !errors.Is(err, ErrTxAlreadyExecuted) {
 		return r, err
 	}
 
+	// duplicate hop -> return the result recorded by the first execution
 	traceCtx, ok := format.GetTraceContext(ctx)
 	if !ok {
-		return r, err
+		return r, errors.Join(format.ErrNoTraceCtx, err)
 	}
 
-	r, ok = UnmarshalResult[R](traceCtx)
+	recorded, ok := GetResult(traceCtx)
 	if !ok {
-		return r, err
+		return r, errors.Join(ErrNoTxResult, err)
 	}
 
-	return r, nil
+	return DecodeResult[R](recorded)
 }
 
 func GetResult(traceCtx *format.TraceContext) (any, bool) {
@@ -74,17 +73,41 @@ func SetResult(traceCtx *format.TraceContext, value any) {
 
 func UnmarshalResult[R any](traceCtx *format.TraceContext) (R, bool) {
 	var r R
-	var result Result[R]
 	v, ok := traceCtx.Get(contextKeyTxResult)
 	if !ok {
 		return r, false
 	}
 
-	err := mapstructure.Decode(v, &result)
+	r, err := DecodeResult[R](v)
 	if err != nil {
 		return r, false
 	}
-	return result.Value, true
+	return r, true
+}
+
+// DecodeResult converts a result set by a lifecycle or reloaded from TxResult
+// into R. Recorded results are decoded with the same json encoding they were
+// stored with, so json tags of the handler's type are honoured.
+func DecodeResult[R any](v any) (R, error) {
+	var result Result[R]
+	switch v := v.(type) {
+	case Result[R]:
+		return v.Value, nil
+	case json.RawMessage:
+		if err := json.Unmarshal(v, &result); err != nil {
+			return result.Value, fmt.Errorf("%w: %v", ErrTxResultDecode, err)
+		}
+		return result.Value, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return result.Value, fmt.Errorf("%w: %v", ErrTxResultDecode, err)
+	}
+	if err := json.Unmarshal(b, &result); err != nil {
+		return result.Value, fmt.Errorf("%w: %v", ErrTxResultDecode, err)
+	}
+	return result.Value, nil
 }
 
 type TxLifeCycle[API comparable, R any] struct {
@@ -127,6 +150,11 @@ func (cycle *TxLifeCycle[API, R]) Start(
 		return r, err
 	}
 	defer func() {
+		// a panicking cycle must not commit its partial effects
+		if p := recover(); p != nil {
+			_ = commit(ErrLifeCyclePanic)
+			panic(p)
+		}
 		err = commit(err)
 	}()
 
@@ -136,19 +164,21 @@ func (cycle *TxLifeCycle[API, R]) Start(
 			return r, errors.Join(ErrLifeCycleBeforeHooks, err)
 		}
 	}
+	completed := false
 	defer func() {
-		if err == nil {
+		if completed && err == nil {
 			var afterHookErr error
 			for _, hook := range cycle.table.afterHooks[api] {
 				afterHookErr = hook(ctx, tx)
 				if afterHookErr != nil {
-					err = errors.Join(ErrLifeCycleAfterHooks, err)
+					err = errors.Join(ErrLifeCycleAfterHooks, afterHookErr, err)
 				}
 			}
 		}
 	}()
 
 	r, err = cycleFunc(ctx, tx)
+	completed = true
 
 	traceCtx, ok := format.GetTraceContext(ctx)
 	if !ok {
@@ -171,6 +201,27 @@ func NewTxTable[API comparable](conn *pgxpool.Pool) *TxTable[API] {
 	}
 }
 
+// TxHooks are passed to the store tables, which install them on every
+// mutating api, e.g. the exactly-once dedup hooks of the concurrency control.
+// The database layer cannot depend on that package itself.
+type TxHooks struct {
+	Before TxHookFunc
+	After  TxHookFunc
+}
+
+func (thm *TxHookMap[API]) InstallHooks(hooks []TxHooks, apis ...API) {
+	for _, api := range apis {
+		for _, hook := range hooks {
+			if hook.Before != nil {
+				thm.BeforeHook(api, hook.Before)
+			}
+			if hook.After != nil {
+				thm.AfterHook(api, hook.After)
+			}
+		}
+	}
+}
+
 // Start and end hooks are INDEPENDENT on the result of the tx execution.
 // Before and after hooks are DEPENDENT on the result of the tx execution.
 type TxHookMap[API comparable] struct {
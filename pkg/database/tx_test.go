@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"txchain/pkg/format"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+type testTxResult struct {
+	EventID int64  `json:"event_id"`
+	Name    string `json:"event_name"`
+}
+
+func TestDecodeResult(t *testing.T) {
+	// results of the current execution
+	r, err := DecodeResult[testTxResult](NewResult(testTxResult{EventID: 1}))
+	require.NoError(t, err)
+	require.Equal(t, testTxResult{EventID: 1}, r)
+
+	// results recorded by a previous execution
+	b, err := json.Marshal(NewResult(testTxResult{EventID: 2, Name: "meeting"}))
+	require.NoError(t, err)
+	r, err = DecodeResult[testTxResult](json.RawMessage(b))
+	require.NoError(t, err)
+	require.Equal(t, testTxResult{EventID: 2, Name: "meeting"}, r)
+
+	id, err := DecodeResult[int64](map[string]any{"Value": float64(3)})
+	require.NoError(t, err)
+	require.Equal(t, int64(3), id)
+
+	v, err := DecodeResult[any](json.RawMessage(`{"Value":null}`))
+	require.NoError(t, err)
+	require.Nil(t, v)
+
+	_, err = DecodeResult[int64](json.RawMessage(`{"Value":"three"}`))
+	require.ErrorIs(t, err, ErrTxResultDecode)
+}
+
+func TestUnwrapResult(t *testing.T) {
+	ctx := format.InsertTraceContext(context.Background())
+	traceCtx, ok := format.GetTraceContext(ctx)
+	require.True(t, ok)
+
+	errFailed := errors.New("failed")
+	_, err := UnwrapResult(ctx, func(ctx context.Context) (int64, error) {
+		return -1, errFailed
+	})
+	require.ErrorIs(t, err, errFailed)
+
+	// duplicate hops need the recorded result
+	_, err = UnwrapResult(ctx, func(ctx context.Context) (int64, error) {
+		return -1, ErrTxAlreadyExecuted
+	})
+	require.ErrorIs(t, err, ErrNoTxResult)
+
+	SetResult(traceCtx, json.RawMessage(`{"Value":{"event_id":4,"event_name":"meeting"}}`))
+	r, err := UnwrapResult(ctx, func(ctx context.Context) (testTxResult, error) {
+		return testTxResult{}, errors.Join(ErrLifeCycleBeforeHooks, ErrTxAlreadyExecuted)
+	})
+	require.NoError(t, err)
+	require.Equal(t, testTxResult{EventID: 4, Name: "meeting"}, r)
+}
+
+func TestInstallHooks(t *testing.T) {
+	hook := func(ctx context.Context, tx pgx.Tx) error { return nil }
+
+	// tables only run the hooks they were given
+	table := NewTableUser(nil)
+	require.Empty(t, table.beforeHooks)
+	require.Empty(t, table.afterHooks)
+
+	table = NewTableUser(nil, TxHooks{Before: hook, After: hook}, TxHooks{Before: hook})
+	require.Len(t, table.beforeHooks[UserStoreAPICreateUser], 2)
+	require.Len(t, table.afterHooks[UserStoreAPICreateUser], 1)
+	require.Empty(t, table.beforeHooks[UserStoreAPIGetUser])
+}
@@ -47,11 +47,20 @@ type TableUser struct {
 
 var _ UserStore = (*TableUser)(nil)
 
-func NewTableUser(conn *pgxpool.Pool) *TableUser {
-	return &TableUser{
+func NewTableUser(conn *pgxpool.Pool, hooks ...TxHooks) *TableUser {
+	table := &TableUser{
 		conn:    conn,
 		TxTable: NewTxTable[UserStoreAPI](conn),
 	}
+	table.InstallHooks(
+		hooks,
+		UserStoreAPICreateUser,
+		UserStoreAPIDeleteUser,
+		UserStoreAPIUpdateName,
+		UserStoreAPIAddHostEvent,
+		UserStoreAPIRemoveHostEvent,
+	)
+	return table
 }
 
 func (table *TableUser) GetUser(ctx context.Context, userID int64) (*User, error) {
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"txchain/pkg/format"
+)
+
+var (
+	ErrMiddlewareTxPeer = errors.New("tx control endpoints are restricted to peers")
+)
+
+// TxPeer restricts the control endpoints of the concurrency control, e.g.
+// advancing a receiver clock or resending an executor, to peers presenting the
+// shared token. Every request is rejected while no token is configured.
+func TxPeer(token string) Middlerware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got := r.Header.Get(headerTxPeerToken)
+			if token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				format.WriteJsonResponse(w, format.NewErrorResponse(ErrMiddlewareTxPeer, nil), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
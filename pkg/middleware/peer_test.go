@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"txchain/pkg/format"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxPeer(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		format.WriteJsonResponse(w, struct{}{}, http.StatusOK)
+	})
+	serve := func(token, presented string) int {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/tx/cc/advance", nil)
+		if presented != "" {
+			r.Header.Set(headerTxPeerToken, presented)
+		}
+		w := httptest.NewRecorder()
+		Chain(ok, TxPeer(token)).ServeHTTP(w, r)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusOK, serve("secret", "secret"))
+	require.Equal(t, http.StatusForbidden, serve("secret", ""))
+	require.Equal(t, http.StatusForbidden, serve("secret", "guess"))
+	// no token configured -> no peer is trusted
+	require.Equal(t, http.StatusForbidden, serve("", ""))
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"txchain/pkg/format"
+)
+
+var (
+	ErrMiddlewarePanic = errors.New("handler panicked")
+)
+
+// Recover converts a panicking handler into a json 500 response. Hops that
+// panicked are retried by their sender like any other server error.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			// aborted handlers are handled by the server
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+
+			log.Printf("panic serving %s %s: %v\n%s", r.Method, r.URL.Path, p, debug.Stack())
+			format.WriteJsonResponse(w, format.NewErrorResponse(ErrMiddlewarePanic, fmt.Errorf("%v", p)), http.StatusInternalServerError)
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"txchain/pkg/format"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecover(t *testing.T) {
+	handler := Chain(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("panic") != "" {
+				panic("boom")
+			}
+			format.WriteJsonResponse(w, struct{}{}, http.StatusOK)
+		}),
+		Recover,
+	)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?panic=1", nil))
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+
+	var resp format.ErrorResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	require.Contains(t, resp.ErrorMsg, ErrMiddlewarePanic.Error())
+	require.Contains(t, resp.ErrorMsg, "boom")
+
+	// aborted handlers still abort the connection
+	aborted := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}), Recover)
+	require.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		aborted.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+}
@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"txchain/pkg/cc"
+	"txchain/pkg/format"
+
+	"github.com/stretchr/testify/require"
+)
+
+// run with -race: ordered hops of every partition arrive in random order while
+// the filters and clocks are read and updated concurrently
+func TestTxParticipantConcurrency(t *testing.T) {
+	partitions := uint64(8)
+	hops := 200
+	serviceTx := "service-tx"
+	serviceA := "service-a"
+
+	// the handler marks every clock persisted, so no database is needed
+	txMgr := cc.NewTxManager(nil, partitions, []string{serviceA, serviceTx})
+
+	var mu sync.Mutex
+	delivered := make([][]uint64, partitions)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceCtx, ok := format.GetTraceContext(r.Context())
+		require.True(t, ok)
+		stageCtx, ok := cc.GetTxStageCtx(r.Context())
+		require.True(t, ok)
+
+		mu.Lock()
+		delivered[stageCtx.Partition] = append(delivered[stageCtx.Partition], stageCtx.Timestamp)
+		mu.Unlock()
+
+		cc.SetReceiverClockPersisted(traceCtx)
+		w.WriteHeader(http.StatusOK)
+	})
+	server := Chain(handler, TxParticipant(txMgr, nil, serviceA))
+
+	send := func(partition, timestamp uint64) int {
+		stageCtx := &cc.TxStageContext{
+			Partition: partition,
+			Service:   serviceTx,
+			Timestamp: timestamp,
+			Attrs:     []string{"hop"},
+			Level:     SerializationLevelOriginOrdering,
+		}
+		b, err := json.Marshal(Input{Value: timestamp})
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/a", bytes.NewReader(b))
+		req.Header.Add(headerTxStageContext, stageCtx.Encode())
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	var stop atomic.Bool
+	var background sync.WaitGroup
+	// filters of other attrs never drop a hop but race with the lookups
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		filterMgr := txMgr.FilterMgr
+		for i := 0; !stop.Load(); i++ {
+			partition := uint64(i) % partitions
+			filterMgr.AddReqFilter(partition, serviceTx, []string{"other"})
+			filterMgr.AddRespFilter(partition, serviceTx, []string{"other"})
+			filterMgr.RemoveReqFilter(partition, serviceTx, []string{"other"})
+			filterMgr.ClearRespFilter(partition, serviceTx)
+		}
+	}()
+	// clock flushes and gap checks read the clocks while hops move them
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		for !stop.Load() {
+			_ = txMgr.ReceiverClockMgr.Range(func(partition uint64, service string, timestamp uint64) error {
+				return nil
+			})
+			_ = txMgr.OriginMgr.Gaps(0)
+		}
+	}()
+
+	var wg sync.WaitGroup
+	r := rand.New(rand.NewSource(42))
+	for partition := range partitions {
+		for _, ts := range r.Perm(hops) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				require.Equal(t, http.StatusOK, send(partition, uint64(ts+1)))
+			}()
+		}
+	}
+	wg.Wait()
+	stop.Store(true)
+	background.Wait()
+
+	expected := make([]uint64, hops)
+	for i := range expected {
+		expected[i] = uint64(i + 1)
+	}
+	for partition := range partitions {
+		require.True(t, slices.Equal(expected, delivered[partition]), "partition %d", partition)
+		require.Equal(t, uint64(hops), txMgr.OriginMgr.Clock(partition, serviceTx))
+	}
+}
@@ -2,12 +2,12 @@ package middleware
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"time"
 	"txchain/pkg/cc"
-	"txchain/pkg/database"
 	"txchain/pkg/format"
 
 	"github.com/jackc/pgx/v5"
@@ -15,18 +15,31 @@ import (
 )
 
 var (
-	ErrMiddlewareTxGuard           = errors.New("failed to acuquire tx lock")
-	ErrMiddlewareTxExecutor        = errors.New("failed to create tx executor")
-	ErrMiddlewareTxMiddsingCtrlCtx = errors.New("missing control context")
+	ErrMiddlewareTxGuard              = errors.New("failed to acuquire tx lock")
+	ErrMiddlewareTxExecutor           = errors.New("failed to create tx executor")
+	ErrMiddlewareTxMiddsingCtrlCtx    = errors.New("missing control context")
+	ErrMiddlewareTxReceiverClock      = errors.New("failed to persist receiver clock")
+	ErrMiddlewareTxSerializationLevel = errors.New("invalid serialization level")
+	ErrMiddlewareTxSaturated          = errors.New("tx executor queue saturated")
+	ErrMiddlewareTxOrigin             = errors.New("tx hop was not admitted")
+	ErrMiddlewareTxWait               = errors.New("invalid tx wait")
+	ErrMiddlewareTxStatus             = errors.New("failed to get tx executor status")
+	ErrMiddlewareTxWebhook            = errors.New("invalid tx webhook")
+	ErrMiddlewareTxIdempotencyKey     = errors.New("invalid idempotency key")
+	ErrMiddlewareTxReplay             = errors.New("failed to replay tx executor")
+	ErrMiddlewareTxInFlight           = errors.New("tx executor of the idempotency key is still pending")
+	ErrMiddlewareTxReplayAborted      = errors.New("tx executor of the idempotency key was aborted")
+	ErrMiddlewareTxDeadline           = errors.New("invalid tx deadline")
+	ErrMiddlewareTxDeadlineExceeded   = errors.New("tx deadline exceeded")
+	ErrMiddlewareTxPartition          = errors.New("failed to partition tx request")
 )
 
 func TxParticipant(mgr *cc.TxManager, logger Logger, participant string) Middlerware {
+	if logger == nil {
+		logger = &NopLogger{}
+	}
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if logger == nil {
-				logger = &NopLogger{}
-			}
-
 			loggerID := r.Header.Get(headerTxLoggerID)
 			if loggerID == "" {
 				loggerID = DefaultLoggerID
@@ -55,6 +68,23 @@ func TxParticipant(mgr *cc.TxManager, logger Logger, participant string) Middler
 
 			ctx = cc.SetTxStageCtx(ctx, stageCtx)
 
+			if encodedDeadline := r.Header.Get(headerTxDeadline); encodedDeadline != "" {
+				deadline, err := cc.ParseTxDeadline(encodedDeadline)
+				if err != nil {
+					format.WriteJsonResponse(w, format.NewErrorResponse(ErrMiddlewareTxDeadline, err), http.StatusBadRequest)
+					return
+				}
+				// the sender already gave up on the hop
+				if !time.Now().Before(deadline) {
+					session.Log("Deadline Exceeded: %v", deadline)
+					format.WriteJsonResponse(w, format.NewErrorResponse(ErrMiddlewareTxDeadlineExceeded, nil), http.StatusGatewayTimeout)
+					return
+				}
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithDeadline(ctx, deadline)
+				defer cancel()
+			}
+
 			session.Log("Stage Ctx: %v", stageCtx)
 			partition := stageCtx.Partition
 			service := stageCtx.Service
@@ -71,16 +101,33 @@ func TxParticipant(mgr *cc.TxManager, logger Logger, participant string) Middler
 				return
 			}
 
-			writer := w
-			if dropResp {
-				writer = httptest.NewRecorder()
-			}
+			// buffer the response so the receiver clock is durable before the
+			// sender can observe the hop as delivered
+			writer := httptest.NewRecorder()
 
-			session.Log("Lock Partition: %d", partition)
 			originMgr := mgr.OriginMgr
-			originMgr.Acquire(cc.NewWaitMsg(partition, service, timestamp))
-			session.Log("Origin TS: %d", timestamp)
-			defer originMgr.Release(partition, service)
+			ordered := stageCtx.Level.Ordered()
+			admitted := false
+			session.Log("Serialization Level: %s ordered(%v)", stageCtx.Level, ordered)
+			if ordered {
+				session.Log("Lock Partition: %d", partition)
+				acquired, err := originMgr.Acquire(ctx, cc.NewWaitMsg(partition, service, timestamp))
+				session.Log("Origin TS: %d acquired(%v) err(%v)", timestamp, acquired, err)
+				// the sender gave up on this attempt or retried it
+				if err != nil {
+					format.WriteJsonResponse(w, format.NewErrorResponse(ErrMiddlewareTxOrigin, err), http.StatusServiceUnavailable)
+					return
+				}
+				// outdated hops were already admitted once and must not advance the clock again
+				admitted = acquired
+			}
+			// failed or panicking hops give their turn back without advancing
+			// the clock
+			defer func() {
+				if admitted {
+					originMgr.Abandon(partition, service)
+				}
+			}()
 
 			recorder := mgr.Instrumenter
 
@@ -89,26 +136,104 @@ func TxParticipant(mgr *cc.TxManager, logger Logger, participant string) Middler
 			session.Log("Call Visit After")
 			recorder.VisitAfter(ctx)
 
+			// a failed hop has no effects, its timestamp is offered again to
+			// the retry; a committed hop that still failed is replayed by the
+			// dedup hooks
+			if writer.Code >= 300 {
+				session.Log("Hop Failed: %d", writer.Code)
+				copyResponse(w, writer)
+				return
+			}
+
+			if ordered {
+				err = persistOrderedHop(mgr, traceCtx, partition, service, timestamp)
+			} else {
+				err = persistUnorderedHop(mgr, traceCtx, partition, service, timestamp)
+			}
+			if err != nil {
+				session.Log("Persist Receiver Clock: %v", err)
+				format.WriteJsonResponse(w, format.NewErrorResponse(ErrMiddlewareTxReceiverClock, err), http.StatusInternalServerError)
+				return
+			}
+			if admitted {
+				originMgr.Release(partition, service)
+				admitted = false
+			}
+
 			if dropResp {
 				format.WriteJsonResponse(w, format.NewErrorResponse(cc.ErrTxResponseDropped, nil), http.StatusServiceUnavailable)
 				return
 			}
+
+			copyResponse(w, writer)
 		})
 	}
 }
 
+func persistOrderedHop(
+	mgr *cc.TxManager,
+	traceCtx *format.TraceContext,
+	partition uint64,
+	service string,
+	timestamp uint64,
+) error {
+	if cc.ReceiverClockPersisted(traceCtx) {
+		return nil
+	}
+	return mgr.PersistReceiverClock(partition, service, timestamp)
+}
+
+// an unordered hop may run ahead of the clock: it is recorded as done and the
+// clock only persists the contiguous prefix of delivered hops
+func persistUnorderedHop(
+	mgr *cc.TxManager,
+	traceCtx *format.TraceContext,
+	partition uint64,
+	service string,
+	timestamp uint64,
+) error {
+	if !cc.ReceiverClockPersisted(traceCtx) {
+		if err := mgr.PersistReceiverDone(partition, service, timestamp); err != nil {
+			return err
+		}
+	}
+
+	originMgr := mgr.OriginMgr
+	if !originMgr.Complete(partition, service, timestamp) {
+		return nil
+	}
+	return mgr.PersistReceiverClock(partition, service, originMgr.Clock(partition, service))
+}
+
+type TxCoordinatorOption struct {
+	// weakest level the chain may run at, e.g. SCAnalysis.Level of the
+	// declared chain. Clients may only ask for a stricter one.
+	Level SerializationLevel
+	// configured address of the coordinator, recovery resends the request
+	// there. The host named by the client is never trusted.
+	Addr string
+}
+
 func TxCoordinator[T cc.Partition](
 	conn *pgxpool.Pool,
 	mgr *cc.TxManager,
 	logger Logger,
 	service string,
 	receivers []string,
+	options ...TxCoordinatorOption,
 ) Middlerware {
+	if logger == nil {
+		logger = &NopLogger{}
+	}
+	var option TxCoordinatorOption
+	if len(options) > 0 {
+		option = options[0]
+	}
+	if option.Level == "" {
+		option.Level = DefSerializationLevel
+	}
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if logger == nil {
-				logger = &NopLogger{}
-			}
 
 			loggerID := r.Header.Get(headerTxLoggerID)
 			if loggerID == "" {
@@ -126,7 +251,6 @@ func TxCoordinator[T cc.Partition](
 			var ctx context.Context
 
 			prtMgr := mgr.SenderPrtMgr
-			clockMgr := mgr.SenderClockMgr
 			ctx = r.Context()
 
 			encodedExecCtx := r.Header.Get(headerTxExecutorContext)
@@ -147,10 +271,24 @@ func TxCoordinator[T cc.Partition](
 				prtMgr.Lock(partition)
 				defer prtMgr.Unlock(partition)
 				next.ServeHTTP(w, r.WithContext(ctx))
+				skipTxExecutor(mgr, session, execCtx)
 				return
 			}
 
 			// New request
+			release, admitted := mgr.ExecMgr.Admit()
+			if !admitted {
+				session.Log("Saturated: %v", mgr.ExecMgr.Metrics())
+				format.WriteJsonResponse(w, format.NewErrorResponse(ErrMiddlewareTxSaturated, nil), http.StatusTooManyRequests)
+				return
+			}
+			// held until the executor of the chain was sent
+			defer func() {
+				if admitted {
+					release()
+				}
+			}()
+
 			encodedCtrlCtx := r.Header.Get(headerTxControlContext)
 			if encodedCtrlCtx == "" {
 				ctrlCtx = &cc.TxControlContext{}
@@ -163,14 +301,80 @@ func TxCoordinator[T cc.Partition](
 			}
 			ctrlCtx.LoggerID = loggerID
 			ctrlCtx.Service = service
+			if ctrlCtx.Level == "" {
+				ctrlCtx.Level = SerializationLevel(r.Header.Get(headerTxSerializationLevel))
+			}
+			if !ctrlCtx.Level.Valid() {
+				format.WriteJsonResponse(w, format.NewErrorResponse(ErrMiddlewareTxSerializationLevel, nil), http.StatusBadRequest)
+				return
+			}
+			// a conflicting chain stays ordered whatever the client asks for
+			ctrlCtx.Level = option.Level.Stricter(ctrlCtx.Level)
+			if !ctrlCtx.Async {
+				ctrlCtx.Async = preferAsync(r)
+			}
+			if ctrlCtx.Wait == 0 {
+				if wait := r.Header.Get(headerTxWait); wait != "" {
+					ctrlCtx.Wait, err = time.ParseDuration(wait)
+					if err != nil {
+						format.WriteJsonResponse(w, format.NewErrorResponse(ErrMiddlewareTxWait, err), http.StatusBadRequest)
+						return
+					}
+				}
+			}
+			if ctrlCtx.Wait < 0 {
+				format.WriteJsonResponse(w, format.NewErrorResponse(ErrMiddlewareTxWait, nil), http.StatusBadRequest)
+				return
+			}
+			if ctrlCtx.Webhook == "" {
+				ctrlCtx.Webhook = r.Header.Get(headerTxWebhook)
+			}
+			if ctrlCtx.Webhook != "" {
+				if err = cc.ValidateWebhook(ctrlCtx.Webhook, mgr.Webhooks.AllowedHosts()); err != nil {
+					format.WriteJsonResponse(w, format.NewErrorResponse(ErrMiddlewareTxWebhook, err), http.StatusBadRequest)
+					return
+				}
+			}
+			if ctrlCtx.IdempotencyKey == "" {
+				ctrlCtx.IdempotencyKey = r.Header.Get(headerIdempotencyKey)
+			}
+			if len(ctrlCtx.IdempotencyKey) > maxIdempotencyKeyLen {
+				format.WriteJsonResponse(w, format.NewErrorResponse(ErrMiddlewareTxIdempotencyKey, nil), http.StatusBadRequest)
+				return
+			}
+			var deadline time.Time
+			if encodedDeadline := r.Header.Get(headerTxDeadline); encodedDeadline != "" {
+				deadline, err = cc.ParseTxDeadline(encodedDeadline)
+				if err != nil {
+					format.WriteJsonResponse(w, format.NewErrorResponse(ErrMiddlewareTxDeadline, err), http.StatusBadRequest)
+					return
+				}
+			}
+			// a retried request must not start a second chain
+			if ctrlCtx.IdempotencyKey != "" && replayTxExecutor(mgr, session, w, ctrlCtx) {
+				return
+			}
 			req := UnmarshalRequest[T](r)
 			keys := req.Keys()
-			ctrlCtx.Partition = prtMgr.Partition(keys...)
+			ctrlCtx.Partition, err = prtMgr.Partition(keys...)
+			if err != nil {
+				format.WriteJsonResponse(w, format.NewErrorResponse(ErrMiddlewareTxPartition, err), http.StatusInternalServerError)
+				return
+			}
 
 			execCtx = &cc.TxExecutorContext{}
 			execCtx.Status = cc.ExecStatusPending
 			execCtx.CtrlCtx = ctrlCtx
 			execCtx.Input = req
+			// recovery resends the request to the coordinator
+			execCtx.Method = r.Method
+			execCtx.Endpoint = requestEndpoint(option.Addr, r)
+			execCtx.Deadline = mgr.ExecMgr.ChainDeadline(deadline)
+			// no timestamps are reserved for a chain that cannot finish in time
+			if execCtx.Expired(time.Now()) {
+				format.WriteJsonResponse(w, format.NewErrorResponse(ErrMiddlewareTxDeadlineExceeded, nil), http.StatusGatewayTimeout)
+				return
+			}
 
 			recorder := mgr.Instrumenter
 
@@ -179,116 +383,233 @@ func TxCoordinator[T cc.Partition](
 			if err = createTxExecutor(
 				conn,
 				prtMgr,
-				clockMgr,
+				mgr.Allocator,
 				session,
 				execCtx,
 				receivers,
 			); err != nil {
+				// a concurrent retry started the chain first
+				if errors.Is(err, cc.ErrTxExecutorDuplicate) && replayTxExecutor(mgr, session, w, ctrlCtx) {
+					return
+				}
 				format.WriteJsonResponse(w, format.NewErrorResponse(ErrMiddlewareTxExecutor, err), http.StatusInternalServerError)
 				return
 			}
 
 			session.Log("Exec Ctx: %v", execCtx)
+			if ctrlCtx.Async {
+				// the executor is durable, recovery resumes it like a chain
+				// whose coordinator crashed before answering
+				w.Header().Set(headerLocation, cc.TxExecutorLocation(execCtx.ExecID))
+				format.WriteJsonResponse(w, cc.TxExecutorAccepted{ExecID: execCtx.ExecID}, http.StatusAccepted)
+				req := r.WithContext(context.WithoutCancel(ctx))
+				admitted = !mgr.GoChain(func() {
+					runTxChainAsync(mgr, logger, loggerID, next, req, execCtx, release)
+				})
+				return
+			}
+			if ctrlCtx.Wait > 0 {
+				waitTxChain(mgr, session, next, w, r.WithContext(ctx), execCtx)
+				return
+			}
+
 			recorder.VisitBefore(ctx)
 			next.ServeHTTP(w, r.WithContext(ctx))
 			recorder.VisitAfter(ctx)
+			skipTxExecutor(mgr, session, execCtx)
 		})
 	}
 }
 
+// runTxChainAsync runs the commit stage of an accepted chain. The response is
+// only logged, the client polls the executor status instead. It takes over
+// the admission of the chain.
+func runTxChainAsync(
+	mgr *cc.TxManager,
+	logger Logger,
+	loggerID string,
+	next http.Handler,
+	r *http.Request,
+	execCtx *cc.TxExecutorContext,
+	release func(),
+) {
+	defer release()
+	session := logger.Session(loggerID)
+	defer session.Done()
+
+	ctx := r.Context()
+	writer := httptest.NewRecorder()
+	mgr.Instrumenter.VisitBefore(ctx)
+	next.ServeHTTP(writer, r)
+	mgr.Instrumenter.VisitAfter(ctx)
+	session.Log("Async Tx Chain: exec(%d) code(%d)", execCtx.ExecID, writer.Code)
+	skipTxExecutor(mgr, session, execCtx)
+}
+
+// waitTxChain runs the commit stage and blocks until the executor finished
+// its hops, the wait passed or the client left. The executor still
+// checkpoints every hop, a chain that is not done is answered with 202 and
+// its status resource.
+func waitTxChain(
+	mgr *cc.TxManager,
+	session LoggerSession,
+	next http.Handler,
+	w http.ResponseWriter,
+	r *http.Request,
+	execCtx *cc.TxExecutorContext,
+) {
+	ctx := r.Context()
+	execID := execCtx.ExecID
+	timer := time.NewTimer(execCtx.CtrlCtx.Wait)
+	defer timer.Stop()
+
+	writer := httptest.NewRecorder()
+	mgr.Instrumenter.VisitBefore(ctx)
+	next.ServeHTTP(writer, r)
+	mgr.Instrumenter.VisitAfter(ctx)
+	skipTxExecutor(mgr, session, execCtx)
+	// the commit stage failed, nothing to wait for
+	if writer.Code >= 300 {
+		copyResponse(w, writer)
+		return
+	}
+
+	// an executor that is not owned anymore already finished
+	if done, ok := mgr.ExecMgr.Watch(execID); ok {
+		select {
+		case <-done:
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+	}
+
+	status, err := mgr.ExecutorStatus(execID)
+	if err != nil {
+		format.WriteJsonResponse(w, format.NewErrorResponse(ErrMiddlewareTxStatus, err), http.StatusInternalServerError)
+		return
+	}
+	session.Log("Wait Tx Chain: exec(%d) status(%d)", execID, status.Status)
+
+	result := cc.TxChainResult{
+		Executor: status,
+	}
+	if writer.Body.Len() > 0 {
+		result.Response = writer.Body.Bytes()
+	}
+	switch {
+	case status.Status == cc.ExecStatusCompleted:
+		format.WriteJsonResponse(w, result, writer.Code)
+	case status.Done:
+		// the later hops were rolled back
+		format.WriteJsonResponse(w, result, http.StatusConflict)
+	default:
+		w.Header().Set(headerLocation, cc.TxExecutorLocation(execID))
+		format.WriteJsonResponse(w, result, http.StatusAccepted)
+	}
+}
+
+func preferAsync(r *http.Request) bool {
+	for _, value := range r.Header.Values(headerPrefer) {
+		for _, pref := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(pref), preferRespondAsync) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// replayTxExecutor answers a retried request with the chain its idempotency
+// key started: the result of the commit stage once it committed, a conflict
+// otherwise. It reports false if the key did not start a chain.
+func replayTxExecutor(
+	mgr *cc.TxManager,
+	session LoggerSession,
+	w http.ResponseWriter,
+	ctrlCtx *cc.TxControlContext,
+) bool {
+	status, err := mgr.ExecutorByKey(ctrlCtx.Service, ctrlCtx.IdempotencyKey)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false
+	}
+	if err != nil {
+		format.WriteJsonResponse(w, format.NewErrorResponse(ErrMiddlewareTxReplay, err), http.StatusInternalServerError)
+		return true
+	}
+	session.Log("Replay Tx Executor: key(%s) exec(%d) status(%d)", ctrlCtx.IdempotencyKey, status.ExecID, status.Status)
+
+	w.Header().Set(headerIdempotentReplayed, "true")
+	w.Header().Set(headerLocation, cc.TxExecutorLocation(status.ExecID))
+	switch {
+	// a rolled back chain still committed its first hop
+	case status.Result != nil:
+		format.WriteJsonResponse(w, status.Result, http.StatusOK)
+	case status.Status == cc.ExecStatusPending:
+		format.WriteJsonResponse(w, format.NewErrorResponse(ErrMiddlewareTxInFlight, nil), http.StatusConflict)
+	default:
+		format.WriteJsonResponse(w, format.NewErrorResponse(ErrMiddlewareTxReplayAborted, nil), http.StatusConflict)
+	}
+	return true
+}
+
+// an aborted chain still owns the timestamps reserved for its receivers,
+// which must be delivered as no-op hops or later hops wait forever
+func skipTxExecutor(
+	mgr *cc.TxManager,
+	session LoggerSession,
+	execCtx *cc.TxExecutorContext,
+) {
+	if execCtx.Status != cc.ExecStatusAborted || len(execCtx.Timestamps) == 0 {
+		return
+	}
+
+	executor := cc.NewTxExecutor(execCtx, mgr.Checkpointer())
+	if err := mgr.ExecMgr.SendSkip(executor); err != nil {
+		// the executor stays pending and is skipped again on recovery
+		session.Log("Skip Tx Executor: %v", err)
+	}
+}
+
+// the timestamps come from the blocks reserved by the allocator, so a chain
+// only waits for the database when a block runs out
 func createTxExecutor(
 	conn *pgxpool.Pool,
 	prtMgr *cc.TxPartitionManager,
-	clockMgr *cc.TxClockManager,
+	allocator *cc.TxTimestampAllocator,
 	session LoggerSession,
 	execCtx *cc.TxExecutorContext,
 	receivers []string,
 ) (err error) {
-	var b []byte
-
 	partition := execCtx.CtrlCtx.Partition
 	prtMgr.Lock(partition)
 	defer prtMgr.Unlock(partition)
 
-	tsMap := map[string]uint64{}
-	timestamps := []uint64{}
-	for _, receiver := range receivers {
-		if ts, ok := tsMap[receiver]; !ok {
-			ts := clockMgr.Get(partition, receiver)
-			timestamps = append(timestamps, ts+1)
-			tsMap[receiver] = ts + 1
-		} else {
-			timestamps = append(timestamps, ts+1)
-			tsMap[receiver]++
-		}
+	timestamps, tsMap, err := allocator.Reserve(context.Background(), partition, execCtx.CtrlCtx.Service, receivers)
+	if err != nil {
+		return err
 	}
 	session.Log("ts-map: %v", tsMap)
 	execCtx.Receivers = receivers
 	execCtx.Timestamps = timestamps
 
-	b, err = json.Marshal(execCtx)
+	err = cc.InsertCheckpointExecutorContext(conn, execCtx)
+	session.Log("Tx executor err: %v", err)
 	if err != nil {
 		return err
 	}
+	allocator.Commit(partition, tsMap)
+	return nil
+}
 
-	ctx := context.Background()
-	tx, commit, err := database.BeginTx(ctx, conn)
-	if err != nil {
-		return err
-	}
-	defer func() {
-		err = commit(err)
-		session.Log("Tx executor err: %v", err)
-		if err == nil {
-			// update sender clocks
-			for service, newTs := range tsMap {
-				clockMgr.Set(partition, service, newTs)
-			}
-		}
-	}()
-
-	insertQuery := `
-		INSERT INTO TxExecutor (status, checkpoint)
-		VALUES (@status, @checkpoint)
-		RETURNING exec_id;
-	`
-	args := pgx.NamedArgs{
-		"status":     cc.ExecStatusPending,
-		"checkpoint": b,
-	}
-
-	row := tx.QueryRow(ctx, insertQuery, args)
-	if err = row.Scan(&execCtx.ExecID); err != nil {
-		return err
-	}
-
-	batch := &pgx.Batch{}
-	count := 0
-	// upsert
-	timestampQuery := `
-		INSERT INTO TxSenderClocks (prt, svc, ts)
-		VALUES (@partition, @service, @timestamp)
-		ON CONFLICT (prt, svc)
-		DO UPDATE SET
-			ts = @timestamp;
-	`
-	for service, newTs := range tsMap {
-		args = pgx.NamedArgs{
-			"partition": partition,
-			"service":   service,
-			"timestamp": newTs,
-		}
-		batch.Queue(timestampQuery, args)
-		count++
-	}
-
-	results := tx.SendBatch(ctx, batch)
-	defer results.Close()
+func requestEndpoint(addr string, r *http.Request) string {
+	return strings.TrimSuffix(addr, "/") + r.URL.RequestURI()
+}
 
-	for range count {
-		if _, err = results.Exec(); err != nil {
-			return err
-		}
+func copyResponse(w http.ResponseWriter, recorder *httptest.ResponseRecorder) {
+	header := w.Header()
+	for key, values := range recorder.Header() {
+		header[key] = values
 	}
-	return nil
+	w.WriteHeader(recorder.Code)
+	_, _ = w.Write(recorder.Body.Bytes())
 }
@@ -11,6 +11,7 @@ import (
 	"net/http/httptest"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 	"txchain/pkg/cc"
@@ -48,7 +49,7 @@ func TestTxMiddlewares(t *testing.T) {
 	var txMgr *cc.TxManager
 	var serverTx, serverA, serverB, serverC *httptest.Server
 	var addrTx, addrA, addrB, addrC string
-	var connTx *pgxpool.Pool
+	var connTx, connC *pgxpool.Pool
 	type APIService int
 
 	const api APIService = 0
@@ -134,6 +135,7 @@ func TestTxMiddlewares(t *testing.T) {
 	{
 		_, conn, close := initServer(t)
 		defer close()
+		connC = conn
 
 		txMgr = cc.NewTxManager(conn, partitions, []string{serviceC, serviceTx})
 		txMgr.Instrumenter.Recorder(traceRecorderC)
@@ -171,15 +173,13 @@ func TestTxMiddlewares(t *testing.T) {
 				return
 			}
 
-			timestamps := execCtx.Timestamps
-			ctrlCtx := execCtx.CtrlCtx
 			dryRun := execCtx.Recovered && execCtx.Status == cc.ExecStatusPending
 			stageA := cc.NewExecutorStage()
-			stageA.Stage(httpStageFunc(client, ctrlCtx, serverAHTTPMethod, addrA, timestamps[0], dryRun))
+			stageA.Stage(httpStageFunc(client, execCtx, serverAHTTPMethod, addrA, 0, dryRun))
 			stageB := cc.NewExecutorStage()
-			stageB.Stage(httpStageFunc(client, ctrlCtx, serverBHTTPMethod, addrB, timestamps[1], false))
+			stageB.Stage(httpStageFunc(client, execCtx, serverBHTTPMethod, addrB, 1, false))
 			stageC := cc.NewExecutorStage()
-			stageC.Stage(httpStageFunc(client, ctrlCtx, serverCHTTPMethod, addrC, timestamps[2], false))
+			stageC.Stage(httpStageFunc(client, execCtx, serverCHTTPMethod, addrC, 2, false))
 			checkpointer := cc.DefaultCheckpointer(conn)
 
 			executor := cc.NewTxExecutor(execCtx, checkpointer)
@@ -245,8 +245,8 @@ func TestTxMiddlewares(t *testing.T) {
 					var errResp format.ErrorResponse
 					err = json.Unmarshal(body, &errResp)
 					require.NoError(t, err)
-					t.Log(errResp)
-					t.Fatal()
+					t.Error(errResp)
+					return
 				}
 
 				body, err := io.ReadAll(resp.Body)
@@ -317,6 +317,646 @@ func TestTxMiddlewares(t *testing.T) {
 
 	totalCount := int(partitions * concurrency)
 	testAllExecutor(t, connTx, totalCount, cc.ExecStatusCompleted, time.Second)
+	testReceiverClocks(t, connC, serviceTx, totalCount)
+}
+
+func TestTxParticipantSerializationLevel(t *testing.T) {
+	type APIService int
+
+	const api APIService = 0
+	partitions := uint64(10)
+	partition := uint64(1)
+	serviceTx := "service-tx"
+	serviceA := "service-a"
+
+	_, conn, close := initServer(t)
+	defer close()
+
+	txMgr := cc.NewTxManager(conn, partitions, []string{serviceA, serviceTx})
+	middlewares := []Middlerware{
+		TxParticipant(txMgr, nil, serviceA),
+		ValidateBody[Input],
+	}
+	mux := http.NewServeMux()
+	mux.Handle("POST /a", Chain(serverHandler(conn, api), middlewares...))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+	addr := server.URL + "/a"
+	send := func(timestamp uint64, level SerializationLevel) int {
+		stageCtx := &cc.TxStageContext{
+			Partition: partition,
+			Service:   serviceTx,
+			Timestamp: timestamp,
+			Level:     level,
+		}
+		return testSendHop(t, client, addr, stageCtx, Input{Value: timestamp})
+	}
+
+	// ordered hop waits for timestamp 1
+	ordered := make(chan int, 1)
+	go func() {
+		ordered <- send(2, SerializationLevelOriginOrdering)
+	}()
+
+	// unordered hop bypasses the origin queue
+	require.Equal(t, http.StatusOK, send(3, SerializationLevelNone))
+	select {
+	case <-ordered:
+		t.Fatal("ordered hop delivered before its predecessor")
+	case <-time.After(500 * time.Millisecond):
+	}
+	testReceiverClocks(t, conn, serviceTx, 0)
+
+	// an unset level keeps the origin ordering
+	require.Equal(t, http.StatusOK, send(1, ""))
+	require.Equal(t, http.StatusOK, <-ordered)
+
+	// the clock covers the unordered hop once every predecessor was delivered
+	require.Eventually(t, func() bool {
+		return txMgr.OriginMgr.Clock(partition, serviceTx) == 3
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, http.StatusOK, send(4, SerializationLevelNone))
+	testReceiverClocks(t, conn, serviceTx, 4)
+
+	// replaying an unordered hop does not move the clock
+	require.Equal(t, http.StatusOK, send(3, SerializationLevelNone))
+	testReceiverClocks(t, conn, serviceTx, 4)
+}
+
+func TestTxParticipantFailedHop(t *testing.T) {
+	partition := uint64(1)
+	serviceTx := "service-tx"
+	serviceA := "service-a"
+
+	// the handler marks every clock persisted, so no database is needed
+	txMgr := cc.NewTxManager(nil, 4, []string{serviceA, serviceTx})
+	var mu sync.Mutex
+	failures := map[uint64]int{}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceCtx, ok := format.GetTraceContext(r.Context())
+		require.True(t, ok)
+		stageCtx, ok := cc.GetTxStageCtx(r.Context())
+		require.True(t, ok)
+		mu.Lock()
+		code := failures[stageCtx.Timestamp]
+		delete(failures, stageCtx.Timestamp)
+		mu.Unlock()
+		if code != 0 {
+			w.WriteHeader(code)
+			return
+		}
+		cc.SetReceiverClockPersisted(traceCtx)
+		w.WriteHeader(http.StatusOK)
+	})
+	server := Chain(handler, TxParticipant(txMgr, nil, serviceA))
+
+	send := func(timestamp uint64) int {
+		stageCtx := &cc.TxStageContext{
+			Partition: partition,
+			Service:   serviceTx,
+			Timestamp: timestamp,
+			Level:     SerializationLevelOriginOrdering,
+		}
+		b, err := json.Marshal(Input{Value: timestamp})
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/a", bytes.NewReader(b))
+		req.Header.Add(headerTxStageContext, stageCtx.Encode())
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w.Code
+	}
+	fail := func(timestamp uint64, code int) {
+		mu.Lock()
+		failures[timestamp] = code
+		mu.Unlock()
+	}
+
+	// the clock does not move past a failed hop
+	fail(1, http.StatusInternalServerError)
+	require.Equal(t, http.StatusInternalServerError, send(1))
+	require.Equal(t, uint64(0), txMgr.OriginMgr.Clock(partition, serviceTx))
+
+	// later hops still wait for the retry
+	ordered := make(chan int, 1)
+	go func() {
+		ordered <- send(2)
+	}()
+	select {
+	case <-ordered:
+		t.Fatal("hop delivered before its failed predecessor")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	require.Equal(t, http.StatusOK, send(1))
+	require.Equal(t, uint64(1), txMgr.OriginMgr.Clock(partition, serviceTx))
+	require.Equal(t, http.StatusOK, <-ordered)
+	require.Equal(t, uint64(2), txMgr.OriginMgr.Clock(partition, serviceTx))
+
+	// client errors do not advance the clock either
+	fail(3, http.StatusConflict)
+	require.Equal(t, http.StatusConflict, send(3))
+	require.Equal(t, uint64(2), txMgr.OriginMgr.Clock(partition, serviceTx))
+	require.Equal(t, http.StatusOK, send(3))
+	require.Equal(t, uint64(3), txMgr.OriginMgr.Clock(partition, serviceTx))
+}
+
+func TestTxParticipantDeadline(t *testing.T) {
+	partition := uint64(1)
+	serviceTx := "service-tx"
+	serviceA := "service-a"
+
+	// the handler marks every clock persisted, so no database is needed
+	txMgr := cc.NewTxManager(nil, 4, []string{serviceA, serviceTx})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceCtx, ok := format.GetTraceContext(r.Context())
+		require.True(t, ok)
+		_, ok = r.Context().Deadline()
+		require.True(t, ok)
+		cc.SetReceiverClockPersisted(traceCtx)
+		w.WriteHeader(http.StatusOK)
+	})
+	server := Chain(handler, TxParticipant(txMgr, nil, serviceA))
+
+	send := func(timestamp uint64, deadline string) int {
+		stageCtx := &cc.TxStageContext{
+			Partition: partition,
+			Service:   serviceTx,
+			Timestamp: timestamp,
+			Level:     SerializationLevelOriginOrdering,
+		}
+		b, err := json.Marshal(Input{Value: timestamp})
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/a", bytes.NewReader(b))
+		req.Header.Add(headerTxStageContext, stageCtx.Encode())
+		req.Header.Add(headerTxDeadline, deadline)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusBadRequest, send(1, "tomorrow"))
+	// the sender already gave up
+	require.Equal(t, http.StatusGatewayTimeout, send(1, cc.FormatTxDeadline(time.Now().Add(-time.Second))))
+
+	// a hop stops waiting for its predecessor once its deadline passed
+	start := time.Now()
+	require.Equal(t, http.StatusServiceUnavailable, send(2, cc.FormatTxDeadline(time.Now().Add(100*time.Millisecond))))
+	require.Less(t, time.Since(start), 5*time.Second)
+
+	require.Equal(t, http.StatusOK, send(1, cc.FormatTxDeadline(time.Now().Add(time.Minute))))
+	require.Equal(t, http.StatusOK, send(2, cc.FormatTxDeadline(time.Now().Add(time.Minute))))
+	require.Equal(t, uint64(2), txMgr.OriginMgr.Clock(partition, serviceTx))
+}
+
+func TestTxParticipantRollback(t *testing.T) {
+	type APIService int
+
+	const (
+		apiAdd APIService = iota
+		apiSub
+	)
+	partitions := uint64(10)
+	serviceTx := "service-tx"
+	serviceA := "service-a"
+
+	_, conn, cleanup := initServer(t)
+	defer cleanup()
+
+	// the effects only run if the dedup hooks let the hop through
+	var balance atomic.Int64
+	handler := func(api APIService, sign int64) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			table := database.NewTxTable[APIService](conn)
+			table.BeforeHook(api, cc.TxDedupBeforeHook)
+			table.AfterHook(api, cc.TxDedupAfterHook)
+
+			req := UnmarshalRequest[Input](r)
+			result, err := database.UnwrapResult(r.Context(), func(ctx context.Context) (int64, error) {
+				lifecycle := database.NewTxLifeCycle[APIService, int64](table)
+				return lifecycle.Start(api, ctx, func(ctx context.Context, tx pgx.Tx) (int64, error) {
+					return balance.Add(sign * int64(req.Value)), nil
+				})
+			})
+			if err != nil {
+				format.WriteJsonResponse(w, format.NewErrorResponse(err, nil), http.StatusInternalServerError)
+				return
+			}
+			format.WriteJsonResponse(w, result, http.StatusOK)
+		})
+	}
+
+	txMgr := cc.NewTxManager(conn, partitions, []string{serviceA, serviceTx})
+	middlewares := []Middlerware{
+		TxParticipant(txMgr, nil, serviceA),
+		ValidateBody[Input],
+	}
+	mux := http.NewServeMux()
+	mux.Handle("POST /add", Chain(handler(apiAdd, 1), middlewares...))
+	mux.Handle("POST /sub", Chain(handler(apiSub, -1), middlewares...))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+	execCtx := &cc.TxExecutorContext{
+		ExecID: 1,
+		CtrlCtx: &cc.TxControlContext{
+			Partition: 1,
+			Service:   serviceTx,
+			Level:     SerializationLevelOriginOrdering,
+		},
+		Receivers:  []string{serviceA},
+		Timestamps: []uint64{1},
+		Input:      Input{Value: 5},
+	}
+
+	add := cc.NewHTTPStage[Input, json.RawMessage](client, http.MethodPost, server.URL, "/add", 0, execCtx)
+	sub := cc.NewHTTPStage[Input, json.RawMessage](client, http.MethodPost, server.URL, "/sub", 0, execCtx)
+	aborted := make(chan struct{})
+	checkpointer := func(execCtx *cc.TxExecutorContext) error {
+		if execCtx.Status == cc.ExecStatusAborted {
+			close(aborted)
+		}
+		return nil
+	}
+	executor := cc.NewTxExecutor(execCtx, checkpointer).
+		CommitStage(cc.NewExecutorStage().Stage(func(input any) (any, any, error) {
+			return nil, input, nil
+		})).
+		Stage(cc.NewExecutorStage().Stage(add.StageFunc()).RollbackStage(sub.RollbackFunc())).
+		Stage(cc.NewExecutorStage().Stage(func(input any) (any, any, error) {
+			return nil, nil, cc.ErrTxExecRollback
+		}))
+	_, err := executor.Run()
+	require.NoError(t, err)
+
+	execMgr := cc.NewTxExecutorManager(cc.ConstantRetry(1)).
+		Advancer(func(string, uint64, string, uint64, SerializationLevel) error { return nil })
+	go execMgr.Run()
+	defer execMgr.Shutdown(context.Background())
+	execMgr.Send(executor)
+
+	select {
+	case <-aborted:
+	case <-time.After(10 * time.Second):
+		t.Fatal("executor did not roll back")
+	}
+	// the compensation ran at the timestamp of the hop instead of replaying it
+	require.Equal(t, int64(0), balance.Load())
+	testReceiverClocks(t, conn, serviceTx, 1)
+
+	// retries of either hop are replayed
+	stageCtx := &cc.TxStageContext{
+		Partition: 1,
+		Service:   serviceTx,
+		Timestamp: 1,
+		Level:     SerializationLevelOriginOrdering,
+	}
+	require.Equal(t, http.StatusOK, testSendHop(t, client, server.URL+"/add", stageCtx, Input{Value: 5}))
+	stageCtx.Rollback = true
+	require.Equal(t, http.StatusOK, testSendHop(t, client, server.URL+"/sub", stageCtx, Input{Value: 5}))
+	require.Equal(t, int64(0), balance.Load())
+	require.Equal(t, 2, testCountTxResults(t, conn, serviceTx))
+}
+
+func testCountTxResults(t *testing.T, conn *pgxpool.Pool, service string) int {
+	t.Helper()
+
+	var count int
+	query := `
+		SELECT COUNT(*)
+		FROM TxResult
+		WHERE svc = $1;
+	`
+	require.NoError(t, conn.QueryRow(context.Background(), query, service).Scan(&count))
+	return count
+}
+
+func TestTxCoordinatorSerializationLevel(t *testing.T) {
+	_, conn, cleanup := initServer(t)
+	defer cleanup()
+
+	serviceTx := "service-tx"
+	txMgr := cc.NewTxManager(conn, 4, []string{serviceTx})
+
+	levels := make(chan SerializationLevel, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		execCtx, ok := cc.GetTxExecCtx(r.Context())
+		require.True(t, ok)
+		levels <- execCtx.CtrlCtx.Level
+		w.WriteHeader(http.StatusOK)
+	})
+	newServer := func(options ...TxCoordinatorOption) *httptest.Server {
+		middlewares := []Middlerware{
+			ValidateBody[*Input],
+			TxCoordinator[*Input](conn, txMgr, nil, serviceTx, nil, options...),
+		}
+		return httptest.NewServer(Chain(handler, middlewares...))
+	}
+	send := func(server *httptest.Server, level SerializationLevel) int {
+		b, err := json.Marshal(Input{Value: 1})
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodPost, server.URL, bytes.NewReader(b))
+		require.NoError(t, err)
+		req.Header.Add(headerTxSerializationLevel, string(level))
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// chains are ordered unless declared safe, clients cannot opt out
+	ordered := newServer()
+	defer ordered.Close()
+	require.Equal(t, http.StatusOK, send(ordered, SerializationLevelNone))
+	require.Equal(t, SerializationLevelOriginOrdering, <-levels)
+
+	// a safe chain runs unordered, but the client may still ask for ordering
+	safe := newServer(TxCoordinatorOption{Level: SerializationLevelNone})
+	defer safe.Close()
+	require.Equal(t, http.StatusOK, send(safe, ""))
+	require.Equal(t, SerializationLevelNone, <-levels)
+	require.Equal(t, http.StatusOK, send(safe, SerializationLevelOriginOrdering))
+	require.Equal(t, SerializationLevelOriginOrdering, <-levels)
+
+	require.Equal(t, http.StatusBadRequest, send(safe, "serializable"))
+}
+
+func TestTxCoordinatorAsync(t *testing.T) {
+	_, conn, cleanup := initServer(t)
+	defer cleanup()
+
+	serviceTx := "service-tx"
+	serviceA := "service-a"
+	txMgr := cc.NewTxManager(conn, 4, []string{serviceTx})
+
+	release := make(chan struct{})
+	handled := make(chan error, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		execCtx, ok := cc.GetTxExecCtx(r.Context())
+		require.True(t, ok)
+		execCtx.Status = cc.ExecStatusCommitted
+		execCtx.Result = "done"
+		err := r.Context().Err()
+		if err == nil {
+			err = cc.UpdateCheckpointExecutorContext(conn, execCtx)
+		}
+		handled <- err
+		w.WriteHeader(http.StatusOK)
+	})
+	middlewares := []Middlerware{
+		ValidateBody[*Input],
+		TxCoordinator[*Input](conn, txMgr, nil, serviceTx, []string{serviceA}),
+	}
+	server := httptest.NewServer(Chain(handler, middlewares...))
+	defer server.Close()
+
+	b, err := json.Marshal(Input{Value: 1})
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodPost, server.URL, bytes.NewReader(b))
+	require.NoError(t, err)
+	req.Header.Add(headerPrefer, preferRespondAsync)
+
+	// answered before the commit stage runs
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	var accepted cc.TxExecutorAccepted
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&accepted))
+	require.NotZero(t, accepted.ExecID)
+	require.Equal(t, cc.TxExecutorLocation(accepted.ExecID), resp.Header.Get(headerLocation))
+
+	status, err := txMgr.ExecutorStatus(accepted.ExecID)
+	require.NoError(t, err)
+	require.Equal(t, cc.ExecStatusPending, status.Status)
+	require.Equal(t, []string{serviceA}, status.Receivers)
+
+	// the chain outlives the request
+	close(release)
+	require.NoError(t, <-handled)
+	status, err = txMgr.ExecutorStatus(accepted.ExecID)
+	require.NoError(t, err)
+	require.Equal(t, cc.ExecStatusCommitted, status.Status)
+	require.Equal(t, "done", status.Result)
+}
+
+func TestTxCoordinatorWait(t *testing.T) {
+	_, conn, cleanup := initServer(t)
+	defer cleanup()
+
+	serviceTx := "service-tx"
+	txMgr := cc.NewTxManager(conn, 4, []string{serviceTx})
+	go txMgr.ExecMgr.Run()
+	defer txMgr.ExecMgr.Shutdown(context.Background())
+
+	// the second hop of a chain waits for release
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		execCtx, ok := cc.GetTxExecCtx(r.Context())
+		require.True(t, ok)
+		input := UnmarshalRequest[*Input](r)
+
+		commitStage := cc.NewExecutorStage().Stage(func(v any) (any, any, error) {
+			return Result{Result: input.Value}, v, nil
+		})
+		hopStage := cc.NewExecutorStage().Stage(func(v any) (any, any, error) {
+			if input.Value > 1 {
+				<-release
+			}
+			return Result{Result: input.Value + 1}, v, nil
+		})
+		executor := cc.NewTxExecutor(execCtx, cc.DefaultCheckpointer(conn)).
+			CommitStage(commitStage).
+			Stage(hopStage)
+		res, err := executor.Run()
+		require.NoError(t, err)
+		require.NoError(t, executor.Checkpoint())
+		txMgr.ExecMgr.Send(executor)
+		format.WriteJsonResponse(w, res, http.StatusCreated)
+	})
+	middlewares := []Middlerware{
+		ValidateBody[*Input],
+		TxCoordinator[*Input](conn, txMgr, nil, serviceTx, []string{"service-a", "service-b"}),
+	}
+	server := httptest.NewServer(Chain(handler, middlewares...))
+	defer server.Close()
+
+	send := func(value uint64, wait string) (*http.Response, cc.TxChainResult) {
+		b, err := json.Marshal(Input{Value: value})
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodPost, server.URL, bytes.NewReader(b))
+		require.NoError(t, err)
+		req.Header.Add(headerTxWait, wait)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var result cc.TxChainResult
+		if resp.StatusCode < 300 {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		}
+		return resp, result
+	}
+
+	// every hop finished before the response
+	resp, result := send(1, "5s")
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Equal(t, cc.ExecStatusCompleted, result.Executor.Status)
+	require.JSONEq(t, `{"result":1}`, string(result.Response))
+	require.Equal(t, []any{
+		map[string]any{"result": float64(1)},
+		map[string]any{"result": float64(2)},
+	}, result.Executor.Outputs)
+
+	// the wait passed, the client polls the executor instead
+	resp, result = send(2, "50ms")
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	require.Equal(t, cc.TxExecutorLocation(result.Executor.ExecID), resp.Header.Get(headerLocation))
+	require.Equal(t, cc.ExecStatusCommitted, result.Executor.Status)
+	require.False(t, result.Executor.Done)
+
+	close(release)
+	require.Eventually(t, func() bool {
+		status, err := txMgr.ExecutorStatus(result.Executor.ExecID)
+		require.NoError(t, err)
+		return status.Status == cc.ExecStatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	resp, _ = send(3, "soon")
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestTxCoordinatorIdempotencyKey(t *testing.T) {
+	_, conn, cleanup := initServer(t)
+	defer cleanup()
+
+	serviceTx := "service-tx"
+	txMgr := cc.NewTxManager(conn, 4, []string{serviceTx})
+
+	var mu sync.Mutex
+	chains := 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		chains++
+		mu.Unlock()
+		execCtx, ok := cc.GetTxExecCtx(r.Context())
+		require.True(t, ok)
+		input := UnmarshalRequest[*Input](r)
+		if input.Value == 0 {
+			execCtx.Status = cc.ExecStatusAborted
+			require.NoError(t, cc.UpdateCheckpointExecutorContext(conn, execCtx))
+			format.WriteJsonResponse(w, format.NewErrorResponse(ErrMiddlewareTxExecutor, nil), http.StatusInternalServerError)
+			return
+		}
+		execCtx.Status = cc.ExecStatusCommitted
+		execCtx.Result = Result{Result: input.Value}
+		require.NoError(t, cc.UpdateCheckpointExecutorContext(conn, execCtx))
+		format.WriteJsonResponse(w, execCtx.Result, http.StatusCreated)
+	})
+	middlewares := []Middlerware{
+		ValidateBody[*Input],
+		TxCoordinator[*Input](conn, txMgr, nil, serviceTx, nil),
+	}
+	server := httptest.NewServer(Chain(handler, middlewares...))
+	defer server.Close()
+
+	send := func(value uint64, key string) (*http.Response, string) {
+		b, err := json.Marshal(Input{Value: value})
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodPost, server.URL, bytes.NewReader(b))
+		require.NoError(t, err)
+		req.Header.Add(headerIdempotencyKey, key)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, string(body)
+	}
+
+	resp, body := send(1, "key-1")
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.JSONEq(t, `{"result":1}`, body)
+
+	// a retry replays the result of the original chain
+	resp, body = send(1, "key-1")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "true", resp.Header.Get(headerIdempotentReplayed))
+	require.JSONEq(t, `{"result":1}`, body)
+
+	resp, _ = send(2, "key-2")
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	// a chain aborted by its commit stage is not started again
+	resp, _ = send(0, "key-3")
+	require.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	resp, _ = send(0, "key-3")
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	mu.Lock()
+	require.Equal(t, 3, chains)
+	mu.Unlock()
+}
+
+func TestTxCoordinatorDeadline(t *testing.T) {
+	_, conn, cleanup := initServer(t)
+	defer cleanup()
+
+	serviceTx := "service-tx"
+	txMgr := cc.NewTxManager(conn, 4, []string{serviceTx})
+	txMgr.ExecMgr.ChainTimeout(time.Minute)
+
+	deadlines := make(chan time.Time, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		execCtx, ok := cc.GetTxExecCtx(r.Context())
+		require.True(t, ok)
+		deadlines <- execCtx.Deadline
+		w.WriteHeader(http.StatusOK)
+	})
+	middlewares := []Middlerware{
+		ValidateBody[*Input],
+		TxCoordinator[*Input](conn, txMgr, nil, serviceTx, nil),
+	}
+	server := httptest.NewServer(Chain(handler, middlewares...))
+	defer server.Close()
+
+	send := func(deadline string) int {
+		b, err := json.Marshal(Input{Value: 1})
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodPost, server.URL, bytes.NewReader(b))
+		require.NoError(t, err)
+		if deadline != "" {
+			req.Header.Add(headerTxDeadline, deadline)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// the configured timeout bounds every chain
+	require.Equal(t, http.StatusOK, send(""))
+	require.WithinDuration(t, time.Now().Add(time.Minute), <-deadlines, 5*time.Second)
+
+	// an earlier deadline of the client wins
+	deadline := time.Now().Add(10 * time.Second)
+	require.Equal(t, http.StatusOK, send(cc.FormatTxDeadline(deadline)))
+	require.True(t, deadline.Equal(<-deadlines))
+
+	require.Equal(t, http.StatusGatewayTimeout, send(cc.FormatTxDeadline(time.Now().Add(-time.Second))))
+	require.Equal(t, http.StatusBadRequest, send("soon"))
+	require.Empty(t, deadlines)
 }
 
 func serverHandler[API comparable](
@@ -326,7 +966,7 @@ func serverHandler[API comparable](
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		table := database.NewTxTable[API](conn)
 		table.BeforeHook(api, cc.TxDedupBeforeHook)
-		table.AfterHook(api, cc.TxDedupBeforeHook)
+		table.AfterHook(api, cc.TxDedupAfterHook)
 
 		req := UnmarshalRequest[Input](r)
 		database.UnwrapResult(r.Context(), func(ctx context.Context) (uint64, error) {
@@ -368,51 +1008,18 @@ func initServer(t *testing.T) (
 
 func httpStageFunc(
 	client *http.Client,
-	ctrlCtx *cc.TxControlContext,
+	execCtx *cc.TxExecutorContext,
 	method, addr string,
-	timestamp uint64,
+	hop int,
 	dryRun bool,
 ) cc.StageFunc {
+	stage := cc.NewHTTPStage[Input, json.RawMessage](client, method, addr, "", hop, execCtx).DryRun(dryRun)
 	return func(input any) (result any, output any, err error) {
-		var s Input
-		var ok bool
-		var b []byte
-		var req *http.Request
-		var resp *http.Response
-		s, ok = input.(Input)
-		if !ok {
-			s, err = format.UnmarshalInput[Input](input)
-			if err != nil {
-				return nil, nil, err
-			}
-		}
-
-		b, err = json.Marshal(s)
-		if err != nil {
-			return nil, nil, err
-		}
-
-		req, err = http.NewRequest(method, addr, bytes.NewReader(b))
-		if err != nil {
-			return nil, nil, err
-		}
-
-		stageCtx := &cc.TxStageContext{
-			Partition: ctrlCtx.Partition,
-			Service:   ctrlCtx.Service,
-			Timestamp: timestamp,
-			Attrs:     ctrlCtx.Attrs,
-			DryRun:    dryRun,
-		}
-		req.Header.Add(headerTxLoggerID, ctrlCtx.LoggerID)
-		req.Header.Add(headerTxStageContext, stageCtx.Encode())
-
-		resp, err = client.Do(req)
+		s, err := cc.DecodeTxExecValue[Input](input)
 		if err != nil {
 			return nil, nil, err
 		}
-		defer resp.Body.Close()
-		if resp.StatusCode >= 300 {
+		if _, err = stage.Do(s); err != nil {
 			return nil, nil, err
 		}
 		return s, s, nil
@@ -443,3 +1050,49 @@ func testAllExecutor(
 		return statusCount == count
 	}, timeout, 500*time.Millisecond, statusCount)
 }
+
+func testReceiverClocks(
+	t *testing.T,
+	conn *pgxpool.Pool,
+	service string,
+	count int,
+) {
+	t.Helper()
+
+	// every partition starts from 0, so the clocks add up to the delivered hops
+	query := `
+		SELECT COALESCE(SUM(ts), 0)
+		FROM TxReceiverClocks
+		WHERE svc = $1;
+	`
+	var sum int
+	row := conn.QueryRow(context.Background(), query, service)
+	err := row.Scan(&sum)
+	require.NoError(t, err)
+	require.Equal(t, count, sum)
+}
+
+func testSendHop(
+	t *testing.T,
+	client *http.Client,
+	addr string,
+	stageCtx *cc.TxStageContext,
+	input Input,
+) int {
+	t.Helper()
+
+	b, err := json.Marshal(input)
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPost, addr, bytes.NewReader(b))
+	require.NoError(t, err)
+	req.Header.Add(headerTxStageContext, stageCtx.Encode())
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	_, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode
+}
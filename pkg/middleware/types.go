@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"net/http"
+	"txchain/pkg/cc"
 )
 
 type contextKey string
@@ -12,24 +13,39 @@ const (
 )
 
 const (
-	headerTxStageContext       = "X-Tx-Stage-Context"
+	headerTxStageContext       = cc.HeaderKeyStageCtx
 	headerTxControlContext     = "X-Tx-Control-Context"
-	headerTxExecutorContext    = "X-Tx-Executor-Context"
-	headerTxLoggerID           = "X-Tx-Logger-ID"
-	headerTxSerializationLevek = "X-Tx-Serialization-Level"
+	headerTxExecutorContext    = cc.HeaderKeyExecCtx
+	headerTxLoggerID           = cc.HeaderKeyLoggerID
+	headerTxSerializationLevel = "X-Tx-Serialization-Level"
+	headerTxWait               = "X-Tx-Wait"
+	headerTxWebhook            = "X-Tx-Webhook"
+	headerTxDeadline           = cc.HeaderKeyDeadline
+	headerPrefer               = "Prefer"
+	headerIdempotencyKey       = "Idempotency-Key"
+	headerIdempotentReplayed   = "Idempotent-Replayed"
+	headerLocation             = "Location"
+	headerTxPeerToken          = cc.HeaderKeyPeerToken
 )
 
-type SerializationLevel string
+const (
+	// RFC 7240 preference for an asynchronous chain
+	preferRespondAsync = "respond-async"
+	// size of the idem_key column
+	maxIdempotencyKeyLen = 255
+)
+
+type SerializationLevel = cc.SerializationLevel
 
 const (
-	SerializationLevelNone           = "none"
-	SerializationLevelOriginOrdering = "origin-ordering"
+	SerializationLevelNone           = cc.SerializationLevelNone
+	SerializationLevelOriginOrdering = cc.SerializationLevelOriginOrdering
 )
 
 const (
 	DefaultLoggerID = "default"
 
-	DefSerializationLevel = "none"
+	DefSerializationLevel = SerializationLevelOriginOrdering
 )
 
 type Middlerware func(next http.Handler) http.Handler
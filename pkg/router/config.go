@@ -6,6 +6,10 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 	"txchain/pkg/cc"
 	"txchain/pkg/database"
 	"txchain/pkg/middleware"
@@ -15,6 +19,7 @@ import (
 
 var (
 	ErrDatabaseConnection = errors.New("unable to connect to database")
+	ErrConfigInvalid      = errors.New("invalid config")
 )
 
 const (
@@ -26,6 +31,7 @@ const (
 const (
 	ConfigServerHost          = "SERVER_HOST"
 	ConfigServerPort          = "SERVER_PORT"
+	ConfigServiceName         = "SERVICE_NAME"
 	ConfigTableUser           = "USER_TABLE"
 	ConfigTableEvent          = "EVENT_TABLE"
 	ConfigTableEventLog       = "EVENT_LOG_TABLE"
@@ -33,6 +39,16 @@ const (
 	ConfigServiceEventAddr    = "EVENT_SERVICE"
 	ConfigServiceEventLogAddr = "EVENT_LOG_SERVICE"
 	ConfigDatabaseURL         = "DATABASE_URL"
+	ConfigTxResultRetention   = "TX_RESULT_RETENTION"
+	ConfigTxResultArchive     = "TX_RESULT_ARCHIVE"
+	ConfigTxExecutorRetention = "TX_EXECUTOR_RETENTION"
+	ConfigTxTimestampBlock    = "TX_TIMESTAMP_BLOCK"
+	ConfigTxGapThreshold      = "TX_GAP_THRESHOLD"
+	ConfigTxChainTimeout      = "TX_CHAIN_TIMEOUT"
+	ConfigTxStageTimeout      = "TX_STAGE_TIMEOUT"
+	ConfigTxDeadlinePolicy    = "TX_DEADLINE_POLICY"
+	ConfigTxWebhookHosts      = "TX_WEBHOOK_HOSTS"
+	ConfigTxPeerToken         = "TX_PEER_TOKEN"
 )
 
 type Config struct {
@@ -46,8 +62,12 @@ type Config struct {
 	DBConn *pgxpool.Pool
 	DB     *database.DB
 	Peers  map[string]string
-	TxMgr  *cc.TxManager
-	Logger middleware.Logger
+	// shared by the services, authenticates the tx control endpoints
+	PeerToken string
+	// presents the peer token to the control endpoints of the peers
+	PeerClient *http.Client
+	TxMgr      *cc.TxManager
+	Logger     middleware.Logger
 }
 
 func NewConfig(
@@ -71,6 +91,12 @@ func NewConfig(
 
 	cfg.Ctx = context.Background()
 
+	cfg.PeerToken = cfg.Getenv(ConfigTxPeerToken)
+	cfg.PeerClient = &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: cc.NewPeerTransport(cfg.PeerToken, nil),
+	}
+
 	cfg.DBURL = cfg.Getenv(ConfigDatabaseURL)
 	conn, err := pgxpool.New(context.Background(), cfg.DBURL)
 	if err != nil {
@@ -84,13 +110,13 @@ func NewConfig(
 	}()
 
 	if cfg.Getenv(ConfigTableUser) == "true" {
-		cfg.DB.UserStore = database.NewTableUser(cfg.DBConn)
+		cfg.DB.UserStore = database.NewTableUser(cfg.DBConn, cc.DedupTxHooks())
 	}
 	if cfg.Getenv(ConfigTableEvent) == "true" {
-		cfg.DB.EventStore = database.NewTableEvent(cfg.DBConn)
+		cfg.DB.EventStore = database.NewTableEvent(cfg.DBConn, cc.DedupTxHooks())
 	}
 	if cfg.Getenv(ConfigTableEventLog) == "true" {
-		cfg.DB.EventLogStore = database.NewTableEventLog(cfg.DBConn)
+		cfg.DB.EventLogStore = database.NewTableEventLog(cfg.DBConn, cc.DedupTxHooks())
 	}
 	log.Println(cfg.Getenv(ConfigServiceUserAddr), cfg.Getenv(ConfigServiceEventAddr), cfg.Getenv(ConfigServiceEventLogAddr))
 	cfg.Peers[ServiceUser] = "http://" + cfg.Getenv(ConfigServiceUserAddr)
@@ -99,6 +125,80 @@ func NewConfig(
 
 	services := []string{ServiceUser, ServiceEvent, ServiceEventLog}
 	cfg.TxMgr = cc.NewTxManager(cfg.DBConn, 0, services)
+	cfg.TxMgr.ExecMgr.
+		Advancer(cc.HTTPAdvancer(cfg.PeerClient, cfg.Peers))
+	// chains may only post their webhooks to the configured hosts
+	var webhookHosts []string
+	for _, host := range strings.Split(cfg.Getenv(ConfigTxWebhookHosts), ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			webhookHosts = append(webhookHosts, host)
+		}
+	}
+	cfg.TxMgr.Webhooks.
+		Notifier(cc.HTTPNotifier(&http.Client{Timeout: 30 * time.Second})).
+		Hosts(webhookHosts)
+
+	if timeout := cfg.Getenv(ConfigTxChainTimeout); timeout != "" {
+		chainTimeout, err := time.ParseDuration(timeout)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrConfigInvalid, ConfigTxChainTimeout, err)
+		}
+		cfg.TxMgr.ExecMgr.ChainTimeout(chainTimeout)
+	}
+	if timeout := cfg.Getenv(ConfigTxStageTimeout); timeout != "" {
+		stageTimeout, err := time.ParseDuration(timeout)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrConfigInvalid, ConfigTxStageTimeout, err)
+		}
+		cfg.TxMgr.ExecMgr.StageTimeout(stageTimeout)
+	}
+	if policy := cc.DeadlinePolicy(cfg.Getenv(ConfigTxDeadlinePolicy)); policy != "" {
+		if !policy.Valid() {
+			return nil, fmt.Errorf("%w: %s: %s", ErrConfigInvalid, ConfigTxDeadlinePolicy, policy)
+		}
+		cfg.TxMgr.ExecMgr.DeadlinePolicy(policy)
+	}
+
+	compactorOption := cc.TxResultCompactorOption{
+		Archive: cfg.Getenv(ConfigTxResultArchive) == "true",
+	}
+	if retention := cfg.Getenv(ConfigTxResultRetention); retention != "" {
+		compactorOption.Retention, err = time.ParseDuration(retention)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrConfigInvalid, ConfigTxResultRetention, err)
+		}
+	}
+	if retention := cfg.Getenv(ConfigTxExecutorRetention); retention != "" {
+		compactorOption.ExecutorRetention, err = time.ParseDuration(retention)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrConfigInvalid, ConfigTxExecutorRetention, err)
+		}
+	}
+	cfg.TxMgr.Compactor = cc.NewTxResultCompactor(cfg.DBConn, compactorOption)
+
+	if block := cfg.Getenv(ConfigTxTimestampBlock); block != "" {
+		blockSize, err := strconv.ParseUint(block, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrConfigInvalid, ConfigTxTimestampBlock, err)
+		}
+		cfg.TxMgr.Allocator.BlockSize(blockSize)
+	}
+
+	// the gap monitor and the compactor ask senders about timestamps sent to
+	// this service
+	if service := cfg.Getenv(ConfigServiceName); service != "" {
+		gapOption := cc.TxGapMonitorOption{}
+		if threshold := cfg.Getenv(ConfigTxGapThreshold); threshold != "" {
+			gapOption.Threshold, err = time.ParseDuration(threshold)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %v", ErrConfigInvalid, ConfigTxGapThreshold, err)
+			}
+		}
+		resolver := cc.NewHTTPGapResolver(cfg.PeerClient, cfg.Peers)
+		cfg.TxMgr.GapMonitor = cc.NewTxGapMonitor(cfg.TxMgr.OriginMgr, service, resolver, cfg.TxMgr.AdvanceReceiver, gapOption)
+		// results are only compacted below the watermarks of their senders
+		cfg.TxMgr.Compactor.Senders(service, resolver)
+	}
 
 	return cfg, nil
 }
@@ -1,16 +1,33 @@
 package router
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"path"
 	"path/filepath"
+	"syscall"
+	"time"
 	"txchain/pkg/middleware"
 )
 
+var (
+	ErrServerShutdown = errors.New("failed to shut down server")
+	ErrServerRecovery = errors.New("failed to recover tx manager")
+)
+
+const (
+	DefaultShutdownTimeout = 30 * time.Second
+	// in-flight requests run this long before their contexts are canceled
+	DefaultDrainTimeout      = 10 * time.Second
+	DefaultTxShutdownTimeout = 30 * time.Second
+)
+
 type RouterMode string
 
 type Route struct {
@@ -175,15 +192,18 @@ func (r *Engine) Handler() http.Handler {
 	for _, route := range routes {
 		path := fmt.Sprintf("%s %s", route.method, route.path)
 		log.Println(path)
-		mux.Handle(path, route.handler)
+		mux.Handle(path, middleware.Recover(route.handler))
 	}
 	r.mux = mux
 	return r.mux
 }
 
+// Run serves until an interrupt or SIGTERM, then drains in-flight hops, stops
+// the executors after their current stage checkpoints and flushes the clocks.
 func (r *Engine) Run() error {
 	interrupts := []os.Signal{
 		os.Interrupt,
+		syscall.SIGTERM,
 	}
 	ctx, cancel := signal.NotifyContext(r.cfg.Ctx, interrupts...)
 	defer cancel()
@@ -192,5 +212,87 @@ func (r *Engine) Run() error {
 	host, port := r.cfg.Getenv(ConfigServerHost), r.cfg.Getenv(ConfigServerPort)
 	addr := fmt.Sprintf("%s:%s", host, port)
 
-	return http.ListenAndServe(addr, r.mux)
+	if r.mux == nil {
+		r.Handler()
+	}
+	// canceled on shutdown, so hops waiting for their origin turn return
+	reqCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: r.mux,
+		BaseContext: func(net.Listener) context.Context {
+			return reqCtx
+		},
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	// the clocks and reserved blocks are restored before any hop or chain
+	// is served
+	txMgr := r.cfg.TxMgr
+	if txMgr != nil {
+		if err := txMgr.RecoveryMgr.Restore(); err != nil {
+			_ = ln.Close()
+			return fmt.Errorf("%w: %v", ErrServerRecovery, err)
+		}
+		txMgr.Start()
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(ln)
+	}()
+
+	// recovery resends executors to this server, so it runs once listening
+	if txMgr != nil {
+		if err := txMgr.RecoveryMgr.ResendExecutors(); err != nil {
+			return r.shutdown(srv, cancelRequests, fmt.Errorf("%w: %v", ErrServerRecovery, err))
+		}
+	}
+
+	select {
+	case err := <-serveErr:
+		return r.shutdown(srv, cancelRequests, err)
+	case <-ctx.Done():
+		log.Println("shutting down:", context.Cause(ctx))
+		return r.shutdown(srv, cancelRequests, nil)
+	}
+}
+
+func (r *Engine) shutdown(srv *http.Server, cancelRequests context.CancelFunc, err error) error {
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultShutdownTimeout)
+	defer cancel()
+
+	// srv.Shutdown does not cancel the requests, hops still waiting for
+	// their origin turn after the drain give up and are resent by their
+	// coordinators
+	drain := time.AfterFunc(DefaultDrainTimeout, cancelRequests)
+	defer drain.Stop()
+
+	// stop accepting requests and wait for the in-flight hops
+	if shutdownErr := srv.Shutdown(ctx); shutdownErr != nil {
+		err = errors.Join(err, fmt.Errorf("%w: %v", ErrServerShutdown, shutdownErr))
+		cancelRequests()
+		_ = srv.Close()
+	}
+
+	// the server may have used up its timeout, the tx manager still flushes
+	// its clocks
+	txCtx, txCancel := context.WithTimeout(context.Background(), DefaultTxShutdownTimeout)
+	defer txCancel()
+	if txMgr := r.cfg.TxMgr; txMgr != nil {
+		err = errors.Join(err, txMgr.Shutdown(txCtx))
+	}
+	if r.cfg.DBConn != nil {
+		r.cfg.DBConn.Close()
+	}
+	return err
 }
@@ -23,6 +23,7 @@ func getDefaultEnv() map[string]string {
 	return map[string]string{
 		router.ConfigServerHost:          "localhost",
 		router.ConfigServerPort:          "8100",
+		router.ConfigServiceName:         router.ServiceUser,
 		router.ConfigTableUser:           "true",
 		router.ConfigDatabaseURL:         "localhost:5432", // TODO: just a placeholder
 		router.ConfigServiceUserAddr:     "localhost:8100",